@@ -0,0 +1,306 @@
+package build
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strings"
+
+	"github.com/bhojpur/build/pkg/cpp/diag"
+	cparser "github.com/bhojpur/build/pkg/cpp/parser"
+	"golang.org/x/tools/imports"
+)
+
+// goBufferOrder is the order the declarations specific to a target are collected in.
+var goBufferOrder = []Buf{BufDoc, BufConst, BufTypes, BufUnions, BufMain, BufHelpers, BufLayoutTests}
+
+// newMultiArchProcess parses and translates the headers once per target listed in Arches,
+// the first target is the primary one, its output provides the shared files.
+func newMultiArchProcess(cfg Config, opts Options, diags *collector) (*process, error) {
+	var (
+		targets []*process
+		names   []string
+		seen    = make(map[string]string)
+	)
+	for _, arch := range cfg.Parser.Arches {
+		goos, goarch, err := cparser.GoTarget(arch)
+		if err != nil {
+			return nil, errorAt(opts.ConfigPath, diag.CodeConfig, err)
+		}
+		name := archSuffix(goos, goarch)
+		if prev, ok := seen[name]; ok {
+			return nil, errorAt(opts.ConfigPath, diag.CodeConfig,
+				fmt.Errorf("arches %s and %s are both built as %s", prev, arch, name))
+		}
+		seen[name] = arch
+
+		archCfg := cfg
+		parserCfg := *cfg.Parser
+		parserCfg.Arch = arch
+		parserCfg.Arches = nil
+		parserCfg.SourcesPaths = append([]string(nil), cfg.Parser.SourcesPaths...)
+		parserCfg.IncludePaths = append([]string(nil), cfg.Parser.IncludePaths...)
+		archCfg.Parser = &parserCfg
+		if cfg.Translator != nil {
+			translatorCfg := *cfg.Translator
+			archCfg.Translator = &translatorCfg
+		}
+		t, err := newProcess(archCfg, opts, diags)
+		if err != nil {
+			list := diag.FromError(err, diag.CodeParse)
+			for i := range list {
+				list[i].Message = fmt.Sprintf("arch %s: %s", arch, list[i].Message)
+			}
+			return nil, list
+		}
+		t.goOS, t.goArch = goos, goarch
+		targets = append(targets, t)
+		names = append(names, name)
+	}
+	for _, t := range targets {
+		t.gen.SetArches(names)
+	}
+	c := targets[0]
+	c.targets = targets
+	return c, nil
+}
+
+func archSuffix(goos, goarch string) string {
+	if len(goos) > 0 {
+		return goos + "_" + goarch
+	}
+	return goarch
+}
+
+// constraint returns the build constraint terms of a target, a target that is not bound
+// to an OS excludes the systems other targets with the same GOARCH are bound to.
+func (c *process) constraint(targets []*process) []string {
+	if len(c.goOS) > 0 {
+		return []string{c.goOS, c.goArch}
+	}
+	terms := []string{c.goArch}
+	for _, t := range targets {
+		if t.goArch == c.goArch && len(t.goOS) > 0 {
+			terms = append(terms, "!"+t.goOS)
+		}
+	}
+	return terms
+}
+
+// mergeTargets keeps the declarations that are identical across all targets in the
+// shared Go files and moves the rest into types_<goarch>.go files, one per target.
+func (c *process) mergeTargets(noCGO bool) error {
+	archDecls := make([][]string, len(c.targets))
+	shared := make(map[Buf]*bytes.Buffer, len(goBufferOrder))
+	for _, opt := range goBufferOrder {
+		name := goBufferNames[opt]
+		if opt == BufMain {
+			name = c.cfg.Generator.PackageName
+		}
+		files := make([]*goFile, len(c.targets))
+		for i, t := range c.targets {
+			buf := t.goBuffers[opt]
+			if buf == nil || buf.Len() == 0 {
+				continue
+			}
+			f, err := parseGoFile(name, buf.Bytes())
+			if err != nil {
+				return err
+			}
+			files[i] = f
+		}
+		// the declarations of the other targets are kept even if the primary has none
+		for i, f := range files {
+			if f == nil {
+				continue
+			}
+			for _, decl := range f.decls {
+				if !isSharedDecl(decl, files) {
+					archDecls[i] = append(archDecls[i], decl.text)
+				}
+			}
+		}
+		primary := files[0]
+		if primary == nil {
+			continue
+		}
+		var common []string
+		for _, decl := range primary.decls {
+			if isSharedDecl(decl, files) {
+				common = append(common, decl.text)
+			}
+		}
+		if len(common) == 0 && len(primary.decls) > 0 {
+			shared[opt] = nil
+			continue
+		}
+		// the header of the primary target lists all of them, not just its own arch,
+		// as SetArches has been called on every generator before writing the files
+		buf := new(bytes.Buffer)
+		buf.WriteString(primary.header)
+		for _, text := range common {
+			fmt.Fprintf(buf, "\n\n%s", text)
+		}
+		buf.WriteString("\n")
+		shared[opt] = buf
+	}
+	// the leak check hooks don't depend on the target
+	shared[BufLeakCheck] = c.goBuffers[BufLeakCheck]
+	shared[BufNoLeakCheck] = c.goBuffers[BufNoLeakCheck]
+	c.goBuffers = shared
+
+	c.archBuffers = make(map[string]*bytes.Buffer, len(c.targets))
+	for i, t := range c.targets {
+		if len(archDecls[i]) == 0 {
+			continue
+		}
+		buf := new(bytes.Buffer)
+		t.gen.WriteArchPackageHeader(buf, t.constraint(c.targets))
+		if !noCGO {
+			t.gen.WriteIncludes(buf)
+		}
+		for _, text := range archDecls[i] {
+			fmt.Fprintf(buf, "%s\n\n", text)
+		}
+		c.archBuffers["types_"+archSuffix(t.goOS, t.goArch)] = buf
+	}
+	return nil
+}
+
+type goFile struct {
+	header string
+	decls  []goDecl
+	index  map[string]string
+}
+
+type goDecl struct {
+	key  string
+	text string
+}
+
+func isSharedDecl(decl goDecl, files []*goFile) bool {
+	for _, f := range files {
+		if f == nil {
+			return false
+		}
+		if text, ok := f.index[decl.key]; !ok || text != decl.text {
+			return false
+		}
+	}
+	return true
+}
+
+// parseGoFile splits a generated file into its header, that ends with the imports,
+// and the top-level declarations keyed by their names.
+func parseGoFile(name string, src []byte) (*goFile, error) {
+	if formatted, err := imports.Process(name+".go", src, nil); err == nil {
+		src = formatted
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, name+".go", src, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("process: cannot split %s.go between arches: %v", name, err)
+	}
+	offset := func(pos token.Pos) int {
+		return fset.Position(pos).Offset
+	}
+	f := &goFile{
+		index: make(map[string]string),
+	}
+	headerEnd := offset(file.Name.End())
+	for _, decl := range file.Decls {
+		start := offset(decl.Pos())
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				headerEnd = offset(d.End())
+				continue
+			}
+			if d.Doc != nil {
+				start = offset(d.Doc.Pos())
+			}
+		case *ast.FuncDecl:
+			if d.Doc != nil {
+				start = offset(d.Doc.Pos())
+			}
+		}
+		key := declKey(decl)
+		for n := 1; ; n++ {
+			if _, ok := f.index[key]; !ok {
+				break
+			}
+			key = fmt.Sprintf("%s#%d", declKey(decl), n)
+		}
+		text := string(src[start:offset(decl.End())])
+		f.decls = append(f.decls, goDecl{key: key, text: text})
+		f.index[key] = text
+	}
+	f.header = string(src[:headerEnd])
+	return f, nil
+}
+
+func declKey(decl ast.Decl) string {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if d.Recv != nil && len(d.Recv.List) > 0 {
+			return fmt.Sprintf("func (%s) %s", recvTypeName(d.Recv.List[0].Type), d.Name.Name)
+		}
+		return "func " + d.Name.Name
+	case *ast.GenDecl:
+		var names []string
+		for _, spec := range d.Specs {
+			switch s := spec.(type) {
+			case *ast.TypeSpec:
+				names = append(names, s.Name.Name)
+			case *ast.ValueSpec:
+				for _, id := range s.Names {
+					names = append(names, id.Name)
+				}
+			}
+		}
+		return d.Tok.String() + " " + strings.Join(names, ",")
+	}
+	return ""
+}
+
+func recvTypeName(expr ast.Expr) string {
+	switch x := expr.(type) {
+	case *ast.StarExpr:
+		return "*" + recvTypeName(x.X)
+	case *ast.Ident:
+		return x.Name
+	}
+	return ""
+}
+
+func sortedBufferNames(m map[string]*bytes.Buffer) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
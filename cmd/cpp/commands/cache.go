@@ -0,0 +1,229 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/bhojpur/build"
+	"github.com/bhojpur/build/pkg/cpp/diag"
+	"github.com/bhojpur/build/pkg/cpp/parser"
+)
+
+// cacheVersion changes when the layout of the cache entries does.
+const cacheVersion = 2
+
+// Cache keeps the hashes of the inputs and the outputs of a package, the package
+// is up to date when neither its inputs nor its outputs have changed since.
+// The inputs are the config, every header that has been read, the predefines,
+// the flags that affect the output and the generator binary itself.
+type Cache struct {
+	path  string
+	key   string
+	entry *cacheEntry
+}
+
+type cacheEntry struct {
+	Version int               `json:"version"`
+	Key     string            `json:"key"`
+	Inputs  map[string]string `json:"inputs"`
+	Outputs map[string]string `json:"outputs"`
+	// Diagnostics are replayed when the package is up to date.
+	Diagnostics diag.List `json:"diagnostics,omitempty"`
+}
+
+// OpenCache loads the cache entry of the package config from dir,
+// it's fine for the entry to be missing.
+func OpenCache(dir string, opts build.Options) (*Cache, error) {
+	absConfig, err := filepath.Abs(opts.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	absOutput, err := filepath.Abs(opts.OutputPath)
+	if err != nil {
+		return nil, err
+	}
+	key, err := cacheKey(opts, absOutput)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cache{
+		path: filepath.Join(dir, hashString(absConfig + "\x00" + absOutput)[:16]+".json"),
+		key:  key,
+	}
+	data, err := ioutil.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Version != cacheVersion {
+		// a broken or outdated entry is as good as none
+		return c, nil
+	}
+	c.entry = &entry
+	return c, nil
+}
+
+// UpToDate reports whether the package has been generated with the same inputs
+// and its files haven't been touched since.
+func (c *Cache) UpToDate() bool {
+	if c.entry == nil || c.entry.Key != c.key || len(c.entry.Outputs) == 0 {
+		return false
+	}
+	return hashesMatch(c.entry.Inputs) && hashesMatch(c.entry.Outputs)
+}
+
+// Diagnostics returns the diagnostics of the run that generated the package.
+func (c *Cache) Diagnostics() diag.List {
+	if c.entry == nil {
+		return nil
+	}
+	return c.entry.Diagnostics
+}
+
+// Store records the inputs read, the files written and the diagnostics for the result.
+func (c *Cache) Store(result *build.Result) error {
+	entry := &cacheEntry{
+		Version:     cacheVersion,
+		Key:         c.key,
+		Diagnostics: result.Diagnostics,
+	}
+	var err error
+	if entry.Inputs, err = hashFiles(result.Inputs); err != nil {
+		return err
+	}
+	outputs := make([]string, 0, len(result.Files))
+	for name := range result.Files {
+		outputs = append(outputs, filepath.Join(result.Dir, name))
+	}
+	if entry.Outputs, err = hashFiles(outputs); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(c.path, data, 0666); err != nil {
+		return err
+	}
+	c.entry = entry
+	return nil
+}
+
+// cacheKey hashes the inputs that are known before parsing.
+func cacheKey(opts build.Options, outputPath string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "version %d\n", cacheVersion)
+	if exe, err := os.Executable(); err == nil {
+		if sum, err := hashFile(exe); err == nil {
+			fmt.Fprintf(h, "exe %s\n", sum)
+		}
+	}
+	cfgData, err := ioutil.ReadFile(opts.ConfigPath)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(h, "config %s\n", hashString(string(cfgData)))
+	cfg, err := build.LoadConfig(opts)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(h, "include %q\n", cfg.Parser.IncludePaths)
+	fmt.Fprintf(h, "out %s\nnocgo %v\nccdefs %v\nccincl %v\nmaxmem %s\nnostamp %v\n",
+		outputPath, opts.NoCGO, opts.CCDefs, opts.CCIncl, opts.MaxMem, opts.NoStamp)
+	if len(opts.FromModel) > 0 {
+		modelPath, err := filepath.Abs(opts.FromModel)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "model %s\n", modelPath)
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+	arches := cfg.Parser.Arches
+	if len(arches) == 0 {
+		arches = []string{cfg.Parser.Arch}
+	}
+	for _, arch := range arches {
+		parserCfg := *cfg.Parser
+		parserCfg.Arch = arch
+		predefined, err := parser.Predefines(&parserCfg)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "predefines %s %s\n", arch, hashString(predefined))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashesMatch(hashes map[string]string) bool {
+	for path, sum := range hashes {
+		if actual, err := hashFile(path); err != nil || actual != sum {
+			return false
+		}
+	}
+	return true
+}
+
+func hashFiles(paths []string) (map[string]string, error) {
+	hashes := make(map[string]string, len(paths))
+	for _, path := range paths {
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		sum, err := hashFile(path)
+		if err != nil {
+			return nil, err
+		}
+		hashes[path] = sum
+	}
+	return hashes, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashString(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,60 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"flag"
+
+	"github.com/bhojpur/build"
+)
+
+var (
+	OutputPath = flag.String("out", "", "Specify a `dir` for the output.")
+	NoCGO      = flag.Bool("nocgo", false, "Do not include a cgo-specific header in resulting files.")
+	CcDefs     = flag.Bool("ccdefs", false, "Use built-in defines from a hosted C/C++ compiler.")
+	CcIncl     = flag.Bool("ccincl", false, "Use built-in sys include paths from a hosted C-compiler.")
+	MaxMem     = flag.String("maxmem", build.DefaultMaxMem, "Specifies platform's memory cap the generated code.")
+	Fancy      = flag.Bool("fancy", true, "Enable fancy output in the term.")
+	NoStamp    = flag.Bool("nostamp", false, "Disable printing timestamps in the output files.")
+	Debug      = flag.Bool("debug", false, "Enable some debug info.")
+	Methods    = flag.Bool("methods", false, "Print the functions that have been bound as methods.")
+	Check      = flag.Bool("check", false, "Print a diff of the files that are out of date and fail instead of writing them.")
+	CacheDir   = flag.String("cache", "", "Keep the hashes of the inputs in the `dir` and skip the packages that are up to date.")
+	FromModel  = flag.String("from-model", "", "Generate from the translation model in the `file` written by -dump-model instead of parsing the headers.")
+	DumpModel  = flag.String("dump-model", "", "Write the translation model as JSON to the `file` instead of generating the package, - for stdout.")
+
+	Diagnostics = flag.String("diagnostics", "text", "Print the diagnostics to stderr in the `format` text or json.")
+	FailOn      = flag.String("fail-on", "error", "The least `severity` of the diagnostics that fails the run, warning or error.")
+)
+
+// Options returns the generation options of the package config set by the flags.
+func Options(configPath string) build.Options {
+	return build.Options{
+		ConfigPath: configPath,
+		OutputPath: *OutputPath,
+		NoCGO:      *NoCGO,
+		CCDefs:     *CcDefs,
+		CCIncl:     *CcIncl,
+		MaxMem:     *MaxMem,
+		NoStamp:    *NoStamp,
+		FromModel:  *FromModel,
+	}
+}
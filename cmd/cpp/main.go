@@ -21,6 +21,8 @@ package main
 // THE SOFTWARE.
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
@@ -29,7 +31,10 @@ import (
 	"sync"
 	"time"
 
+	"github.com/bhojpur/build"
 	cmd "github.com/bhojpur/build/cmd/cpp/commands"
+	"github.com/bhojpur/build/pkg/cpp/diag"
+	"github.com/bhojpur/build/pkg/cpp/translator"
 	"github.com/tj/go-spin"
 )
 
@@ -62,10 +67,36 @@ func init() {
 
 func main() {
 	s := spin.New()
+	ctx := context.Background()
+
+	failOn, err := diag.ParseSeverity(*cmd.FailOn)
+	if err != nil {
+		log.Fatalln("[ERR]", err)
+	}
+	jsonOutput := false
+	switch *cmd.Diagnostics {
+	case "text":
+	case "json":
+		jsonOutput = true
+	default:
+		log.Fatalf("[ERR] unknown diagnostics format %q, must be text or json", *cmd.Diagnostics)
+	}
 
 	var wg sync.WaitGroup
+	var all diag.List
+	report := func(diags diag.List) {
+		all = append(all, diags...)
+		if jsonOutput {
+			return
+		}
+		for _, d := range diags {
+			fmt.Fprintln(os.Stderr, d)
+		}
+	}
+	cfgPaths, diags := getConfigPaths()
+	report(diags)
 	doneChan := make(chan struct{})
-	for _, cfgPath := range getConfigPaths() {
+	for _, cfgPath := range cfgPaths {
 		if *cmd.Fancy {
 			wg.Add(1)
 			go func() {
@@ -88,14 +119,7 @@ func main() {
 		if *cmd.Debug {
 			t0 = time.Now()
 		}
-		process, err := cmd.NewProcess(cfgPath, *cmd.OutputPath)
-		if err != nil {
-			log.Fatalln("[ERR]", err)
-		}
-		process.Generate(*cmd.NoCGO)
-		if err := process.Flush(*cmd.NoCGO); err != nil {
-			log.Fatalln("[ERR]", err)
-		}
+		diags := generate(ctx, cfgPath, failOn)
 		if *cmd.Debug {
 			fmt.Printf("done in %v\n", time.Now().Sub(t0))
 		}
@@ -103,19 +127,138 @@ func main() {
 			close(doneChan)
 			wg.Wait()
 		}
+		report(diags)
+	}
+	if jsonOutput {
+		if all == nil {
+			all = diag.List{}
+		}
+		enc := json.NewEncoder(os.Stderr)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(all); err != nil {
+			log.Fatalln("[ERR]", err)
+		}
+	}
+	if all.Fails(failOn) {
+		os.Exit(1)
+	}
+}
+
+// generate generates the package of the config, or only checks it or dumps its model,
+// and returns the diagnostics found along the way. An up to date package in the cache
+// reports the diagnostics of the run that generated it.
+func generate(ctx context.Context, cfgPath string, failOn diag.Severity) diag.List {
+	opts := cmd.Options(cfgPath)
+	if len(*cmd.CacheDir) > 0 && len(*cmd.DumpModel) == 0 && !*cmd.Check {
+		cache, err := cmd.OpenCache(*cmd.CacheDir, opts)
+		if err != nil {
+			return diag.FromError(err, diag.CodeCache)
+		}
+		// the method report needs the package to be generated
+		if !*cmd.Methods && cache.UpToDate() {
+			if *cmd.Debug {
+				fmt.Printf("%s is up to date\n", cfgPath)
+			}
+			return cache.Diagnostics()
+		}
+		return generateFiles(ctx, opts, cache, failOn)
+	}
+	if len(*cmd.DumpModel) > 0 {
+		model, diags, err := build.LearnModel(ctx, opts)
+		if err != nil {
+			return diag.FromError(err, diag.CodeConfig)
+		}
+		if err := dumpModel(model, *cmd.DumpModel); err != nil {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Error,
+				Pos:      diag.Position{File: *cmd.DumpModel},
+				Code:     diag.CodeWrite,
+				Message:  err.Error(),
+			})
+		}
+		return diags
+	}
+	return generateFiles(ctx, opts, nil, failOn)
+}
+
+// generateFiles generates and writes the package, the cache is only updated
+// if the diagnostics don't fail the run, so a failed run is never skipped.
+func generateFiles(ctx context.Context, opts build.Options, cache *cmd.Cache, failOn diag.Severity) diag.List {
+	result, err := build.Generate(ctx, opts)
+	if err != nil {
+		return diag.FromError(err, diag.CodeGenerate)
+	}
+	diags := result.Diagnostics
+	if *cmd.Check {
+		upToDate, err := result.Diff(os.Stdout)
+		if err != nil {
+			return append(diags, diag.FromError(err, diag.CodeWrite)...)
+		}
+		if !upToDate {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Error,
+				Pos:      diag.Position{File: opts.ConfigPath},
+				Code:     diag.CodeOutOfDate,
+				Message:  "the generated files are out of date",
+			})
+		}
+	} else if err := result.Write(); err != nil {
+		return append(diags, diag.FromError(err, diag.CodeWrite)...)
+	}
+	if cache != nil && !diags.Fails(failOn) {
+		if err := cache.Store(result); err != nil {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Warning,
+				Code:     diag.CodeCache,
+				Message:  "cannot update the cache: " + err.Error(),
+			})
+		}
+	}
+	if *cmd.Methods {
+		for _, line := range result.Methods {
+			fmt.Println(line)
+		}
+	}
+	return diags
+}
+
+func dumpModel(model *translator.Model, path string) error {
+	if path == "-" {
+		return build.WriteModel(os.Stdout, model)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := build.WriteModel(f, model); err != nil {
+		f.Close()
+		return err
 	}
+	return f.Close()
 }
 
-func getConfigPaths() (paths []string) {
+func getConfigPaths() (paths []string, diags diag.List) {
 	for _, path := range flag.Args() {
 		if info, err := os.Stat(path); err != nil {
-			log.Fatalln("[ERR] cannot locate the specified path:", path)
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Error,
+				Pos:      diag.Position{File: path},
+				Code:     diag.CodeConfig,
+				Message:  "cannot locate the specified path",
+			})
+			continue
 		} else if info.IsDir() {
 			if path, ok := configFromDir(path); ok {
 				paths = append(paths, path)
 				continue
 			}
-			log.Fatalln("[ERR] cannot find any config file in:", path)
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Error,
+				Pos:      diag.Position{File: path},
+				Code:     diag.CodeConfig,
+				Message:  "cannot find any config file in the dir",
+			})
+			continue
 		}
 		paths = append(paths, path)
 	}
@@ -0,0 +1,298 @@
+package build
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bhojpur/build/pkg/cpp/diag"
+	"github.com/bhojpur/build/pkg/cpp/translator"
+	"gopkg.in/yaml.v2"
+	yaml3 "gopkg.in/yaml.v3"
+)
+
+// decodeConfig decodes the YAML config strictly, the unknown keys are errors,
+// and checks the values that would be ignored or fail later otherwise.
+// The diagnostics point to the lines of the config.
+func decodeConfig(path string, data []byte, opts Options) (Config, diag.List) {
+	var cfg Config
+	err := yaml.UnmarshalStrict(data, &cfg)
+	if _, ok := err.(*yaml.TypeError); err != nil && !ok {
+		// a syntax error, there's nothing to validate
+		return cfg, configErrors(path, err)
+	}
+	var diags diag.List
+	if err != nil {
+		diags = configErrors(path, err)
+	}
+	var root yaml3.Node
+	if err := yaml3.Unmarshal(data, &root); err != nil {
+		return cfg, append(diags, configErrors(path, err)...)
+	}
+	v := &configValidator{
+		path:  path,
+		root:  &root,
+		diags: diags,
+	}
+	v.validate(&cfg, opts)
+	// the maps of the config are not visited in order
+	sort.SliceStable(v.diags, func(i, j int) bool {
+		a, b := v.diags[i].Pos, v.diags[j].Pos
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return cfg, v.diags
+}
+
+// configValidator checks a decoded config, the values are located in the YAML
+// by their paths of map keys and list indices.
+type configValidator struct {
+	path  string
+	root  *yaml3.Node
+	diags diag.List
+}
+
+func (v *configValidator) errorf(path []interface{}, format string, args ...interface{}) {
+	d := diag.Diagnostic{
+		Severity: diag.Error,
+		Pos:      diag.Position{File: v.path},
+		Code:     diag.CodeConfig,
+		Message:  fmt.Sprintf(format, args...),
+	}
+	if n := nodeAt(v.root, path); n != nil {
+		d.Pos.Line, d.Pos.Column = n.Line, n.Column
+	}
+	v.diags = append(v.diags, d)
+}
+
+// nodeAt returns the node at the path, or the closest parent if there's none.
+func nodeAt(root *yaml3.Node, path []interface{}) *yaml3.Node {
+	n := root
+	if n.Kind == yaml3.DocumentNode {
+		if len(n.Content) == 0 {
+			return nil
+		}
+		n = n.Content[0]
+	}
+	for _, elem := range path {
+		if n.Kind == yaml3.AliasNode {
+			n = n.Alias
+		}
+		var next *yaml3.Node
+		switch elem := elem.(type) {
+		case string:
+			if n.Kind != yaml3.MappingNode {
+				break
+			}
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if n.Content[i].Value == elem {
+					next = n.Content[i+1]
+					break
+				}
+			}
+		case int:
+			if n.Kind == yaml3.SequenceNode && elem < len(n.Content) {
+				next = n.Content[elem]
+			}
+		}
+		if next == nil {
+			return n
+		}
+		n = next
+	}
+	return n
+}
+
+// at extends the path of a value, the path is copied so it can be kept.
+func at(path []interface{}, elems ...interface{}) []interface{} {
+	return append(append(make([]interface{}, 0, len(path)+len(elems)), path...), elems...)
+}
+
+func (v *configValidator) validate(cfg *Config, opts Options) {
+	if cfg.Generator == nil {
+		v.errorf(nil, "the GENERATOR section is required")
+	} else if len(cfg.Generator.PackageName) == 0 {
+		v.errorf(at(nil, "GENERATOR"), "GENERATOR.PackageName is required")
+	}
+	// the headers are not parsed when generating from a model
+	if len(opts.FromModel) == 0 && (cfg.Parser == nil || len(cfg.Parser.SourcesPaths) == 0) {
+		v.errorf(at(nil, "PARSER"), "PARSER.SourcesPaths is required")
+	}
+	if cfg.Translator != nil {
+		v.validateTranslator(cfg.Translator, at(nil, "TRANSLATOR"))
+	}
+}
+
+func (v *configValidator) validateTranslator(cfg *translator.Config, path []interface{}) {
+	for target, specs := range cfg.Rules {
+		rulesPath := at(path, "Rules", string(target))
+		if !isOneOf(target, translator.ValidRuleTargets) {
+			v.errorf(rulesPath, "invalid rule target %q, must be one of %s", target, listOf(translator.ValidRuleTargets))
+		}
+		for i, spec := range specs {
+			specPath := at(rulesPath, i)
+			if len(spec.Action) > 0 && !isOneOf(spec.Action, translator.ValidRuleActions) {
+				v.errorf(at(specPath, "action"), "invalid rule action %q, must be one of %s",
+					spec.Action, listOf(translator.ValidRuleActions))
+			}
+			if len(spec.Transform) > 0 && !isOneOf(spec.Transform, translator.ValidRuleTransforms) {
+				v.errorf(at(specPath, "transform"), "invalid rule transform %q, must be one of %s",
+					spec.Transform, listOf(translator.ValidRuleTransforms))
+			}
+			if len(spec.Load) > 0 && !translator.IsBuiltinRule(spec.Load) {
+				v.errorf(at(specPath, "load"), "no builtin rule found: %s", spec.Load)
+			}
+			v.checkRegexp(at(specPath, "from"), spec.From)
+		}
+	}
+	for scope, rule := range cfg.ConstRules {
+		rulePath := at(path, "ConstRules", string(scope))
+		if !isOneOf(scope, translator.ValidConstScopes) {
+			v.errorf(rulePath, "invalid const rule scope %q, must be one of %s", scope, listOf(translator.ValidConstScopes))
+		}
+		if !isOneOf(rule, translator.ValidConstRules) {
+			v.errorf(rulePath, "invalid const rule %q, must be one of %s", rule, listOf(translator.ValidConstRules))
+		}
+	}
+	for scope, specs := range cfg.PtrTips {
+		v.validateTips(at(path, "PtrTips", string(scope)), scope, specs)
+	}
+	for scope, specs := range cfg.TypeTips {
+		v.validateTips(at(path, "TypeTips", string(scope)), scope, specs)
+	}
+	for i, spec := range cfg.MemTips {
+		v.validateTip(at(path, "MemTips", i), spec, false)
+	}
+	for i, rule := range cfg.ErrorRules {
+		rulePath := at(path, "ErrorRules", i)
+		v.requireRegexp(at(rulePath, "target"), rule.Target)
+		if len(rule.Success) > 0 && !translator.IsCondition(rule.Success) {
+			v.errorf(at(rulePath, "success"), "invalid success condition %q", rule.Success)
+		}
+	}
+	for i, spec := range cfg.Deallocators {
+		v.requireRegexp(at(path, "Deallocators", i, "target"), spec.Target)
+	}
+	for i, spec := range cfg.Handles {
+		handlePath := at(path, "Handles", i)
+		v.requireRegexp(at(handlePath, "target"), spec.Target)
+		v.checkRegexp(at(handlePath, "constructor"), spec.Constructor)
+		v.checkRegexp(at(handlePath, "destructor"), spec.Destructor)
+	}
+	for i, spec := range cfg.Methods {
+		v.requireRegexp(at(path, "Methods", i, "target"), spec.Target)
+	}
+}
+
+func (v *configValidator) validateTips(path []interface{}, scope translator.TipScope, specs []translator.TipSpec) {
+	if !isOneOf(scope, translator.ValidTipScopes) {
+		v.errorf(path, "invalid tip scope %q, must be one of %s", scope, listOf(translator.ValidTipScopes))
+	}
+	for i, spec := range specs {
+		v.validateTip(at(path, i), spec, scope == translator.TipScopeMacro)
+	}
+}
+
+// validateTip checks a tip spec, the tips of macros are C type names
+// rather than tips so there are no values to check for them.
+func (v *configValidator) validateTip(path []interface{}, spec translator.TipSpec, ctypes bool) {
+	v.requireRegexp(at(path, "target"), spec.Target)
+	if ctypes {
+		return
+	}
+	for i, tip := range spec.Tips {
+		// 0 keeps the default tip of a position
+		if tip == translator.NoTip || tip == "0" {
+			continue
+		}
+		v.checkTip(at(path, "tips", i), tip)
+	}
+	if len(spec.Self) > 0 && !spec.Self.IsValid() {
+		v.errorf(at(path, "self"), "invalid tip %q, must be one of %s, %s", spec.Self,
+			listOf(translator.ValidTips), listOf(translator.ValidSelfTips))
+	}
+	if len(spec.Default) > 0 {
+		v.checkTip(at(path, "default"), spec.Default)
+	}
+	if len(spec.Failure) > 0 && !translator.IsCondition(spec.Failure) {
+		v.errorf(at(path, "failure"), "invalid failure condition %q", spec.Failure)
+	}
+	for i, slice := range spec.Slices {
+		if len(slice.Ptr) == 0 || len(slice.Len) == 0 {
+			v.errorf(at(path, "slices", i), "a slice tip requires both ptr and len")
+		}
+	}
+}
+
+func (v *configValidator) checkTip(path []interface{}, tip translator.Tip) {
+	if tip.IsSelfOnly() {
+		v.errorf(path, "the %q tip is only valid as self", tip)
+	} else if !tip.IsValid() {
+		v.errorf(path, "invalid tip %q, must be one of %s", tip, listOf(translator.ValidTips))
+	}
+}
+
+func (v *configValidator) requireRegexp(path []interface{}, expr string) {
+	if len(expr) == 0 {
+		v.errorf(path, "%s is required", path[len(path)-1])
+		return
+	}
+	v.checkRegexp(path, expr)
+}
+
+func (v *configValidator) checkRegexp(path []interface{}, expr string) {
+	if len(expr) == 0 {
+		return
+	}
+	if _, err := regexp.Compile(expr); err != nil {
+		v.errorf(path, "invalid regexp: %v", err)
+	}
+}
+
+// isOneOf reports whether value is among values, a slice of its string type.
+func isOneOf(value, values interface{}) bool {
+	s := reflect.ValueOf(value).String()
+	for _, valid := range valueStrings(values) {
+		if s == valid {
+			return true
+		}
+	}
+	return false
+}
+
+func listOf(values interface{}) string {
+	return strings.Join(valueStrings(values), ", ")
+}
+
+func valueStrings(values interface{}) []string {
+	rv := reflect.ValueOf(values)
+	strs := make([]string, rv.Len())
+	for i := range strs {
+		strs[i] = rv.Index(i).String()
+	}
+	return strs
+}
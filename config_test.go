@@ -0,0 +1,98 @@
+package build
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/bhojpur/build/pkg/cpp/translator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplatesAreValid(t *testing.T) {
+	paths, err := filepath.Glob("pkg/cpp/template/*.yml")
+	require.NoError(t, err)
+	paths = append(paths, "test/det/det.yml")
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		_, diags := decodeConfig(path, data, Options{})
+		assert.Empty(t, diags, path)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	const path = "test/config/bad.yml"
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	_, diags := decodeConfig(path, data, Options{})
+	var got []string
+	for _, d := range diags {
+		got = append(got, d.String())
+	}
+	assert.Equal(t, []string{
+		`test/config/bad.yml:8:14: error: invalid const rule "evalFull", must be one of cgo, expand, eval [config]`,
+		"test/config/bad.yml:11:32: error: invalid regexp: error parsing regexp: missing closing ): `^bad_(` [config]",
+		`test/config/bad.yml:12:18: error: invalid rule action "keep", must be one of accept, ignore, replace, doc [config]`,
+		`test/config/bad.yml:13: error: field PtrTip not found in type translator.Config [config]`,
+		`test/config/bad.yml:18:9: error: target is required [config]`,
+		`test/config/bad.yml:19:42: error: invalid tip "size", must be one of sref, ref, arr, inst, userdata, out, inout, named, plain, string, raw [config]`,
+		`test/config/bad.yml:20:36: error: the "owned" tip is only valid as self [config]`,
+		`test/config/bad.yml:21:52: error: the "errno" tip is only valid as self [config]`,
+	}, got)
+}
+
+func TestSchemaEnums(t *testing.T) {
+	data, err := ioutil.ReadFile("buildc2go.schema.json")
+	require.NoError(t, err)
+	var schema interface{}
+	require.NoError(t, json.Unmarshal(data, &schema))
+	enum := func(path ...string) []string {
+		v := schema
+		for _, key := range path {
+			v = v.(map[string]interface{})[key]
+		}
+		var values []string
+		for _, value := range v.([]interface{}) {
+			values = append(values, value.(string))
+		}
+		return values
+	}
+	rules := []string{"properties", "TRANSLATOR", "properties", "Rules"}
+	rule := append(rules[:len(rules):len(rules)], "additionalProperties", "items", "properties")
+	constRules := []string{"properties", "TRANSLATOR", "properties", "ConstRules"}
+	ptrTips := []string{"properties", "TRANSLATOR", "properties", "PtrTips"}
+	assert.Equal(t, valueStrings(translator.ValidRuleTargets), enum(append(rules, "propertyNames", "enum")...))
+	assert.Equal(t, valueStrings(translator.ValidRuleActions), enum(append(rule, "action", "enum")...))
+	assert.Equal(t, valueStrings(translator.ValidRuleTransforms), enum(append(rule, "transform", "enum")...))
+	assert.Equal(t, valueStrings(translator.ValidConstScopes), enum(append(constRules, "propertyNames", "enum")...))
+	assert.Equal(t, valueStrings(translator.ValidConstRules), enum(append(constRules, "additionalProperties", "enum")...))
+	assert.Equal(t, valueStrings(translator.ValidTipScopes), enum(append(ptrTips, "propertyNames", "enum")...))
+	assert.Equal(t, valueStrings(translator.ValidTips), enum("definitions", "tip", "enum"))
+	assert.Equal(t, valueStrings(translator.ValidSelfTips), enum("definitions", "selfOnlyTip", "enum"))
+	for _, name := range enum(append(rule, "load", "enum")...) {
+		assert.True(t, translator.IsBuiltinRule(name), name)
+	}
+}
@@ -0,0 +1,104 @@
+package build
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/bhojpur/build/pkg/cpp/diag"
+	"gopkg.in/yaml.v2"
+)
+
+// collector gathers the diagnostics of all the targets of a package,
+// the helpers are generated concurrently so it's safe for concurrent use.
+type collector struct {
+	mu   sync.Mutex
+	list diag.List
+}
+
+func (c *collector) report(d diag.Diagnostic) {
+	c.mu.Lock()
+	c.list.Add(d)
+	c.mu.Unlock()
+}
+
+func (c *collector) warn(pos diag.Position, code, format string, args ...interface{}) {
+	c.report(diag.Diagnostic{
+		Severity: diag.Warning,
+		Pos:      pos,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// diagnostics returns a copy of the diagnostics collected so far.
+func (c *collector) diagnostics() diag.List {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append(diag.List(nil), c.list...)
+}
+
+// fail returns the diagnostics collected so far along with the ones of err.
+func (c *collector) fail(err error, code string) error {
+	for _, d := range diag.FromError(err, code) {
+		c.report(d)
+	}
+	return c.diagnostics()
+}
+
+// errorAt converts err into an error diagnostic about the file.
+func errorAt(file, code string, err error) diag.List {
+	return diag.List{{
+		Severity: diag.Error,
+		Pos:      diag.Position{File: file},
+		Code:     code,
+		Message:  err.Error(),
+	}}
+}
+
+var yamlLineRx = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// configErrors converts an error of the YAML decoder into diagnostics
+// that point to the lines of the config.
+func configErrors(path string, err error) diag.List {
+	msgs := []string{err.Error()}
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		msgs = typeErr.Errors
+	}
+	list := make(diag.List, 0, len(msgs))
+	for _, msg := range msgs {
+		d := diag.Diagnostic{
+			Severity: diag.Error,
+			Pos:      diag.Position{File: path},
+			Code:     diag.CodeConfig,
+			Message:  msg,
+		}
+		if m := yamlLineRx.FindStringSubmatch(msg); m != nil {
+			d.Pos.Line, _ = strconv.Atoi(m[1])
+			d.Message = m[2]
+		}
+		list = append(list, d)
+	}
+	return list
+}
@@ -1,4 +1,4 @@
-package main
+package build
 
 // Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
 
@@ -19,3 +19,163 @@ package main
 // LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhojpur/build/pkg/cpp/diag"
+	"github.com/bhojpur/build/pkg/cpp/parser"
+	"github.com/bhojpur/build/pkg/cpp/translator"
+)
+
+// DefaultMaxMem is the memory cap of the generated code when Options.MaxMem is empty.
+const DefaultMaxMem = "0x7fffffff"
+
+// Options are the settings of a generation, the zero value of each of them
+// is the default of the matching buildc2go flag.
+type Options struct {
+	// ConfigPath is the YAML config of the package.
+	ConfigPath string
+	// OutputPath is the dir the package dir is placed in.
+	OutputPath string
+	// NoCGO disables the cgo-specific parts of the generated files.
+	NoCGO bool
+	// CCDefs uses the built-in defines of the hosted C compiler.
+	CCDefs bool
+	// CCIncl uses the sys include paths of the hosted C compiler.
+	CCIncl bool
+	// MaxMem is the memory cap of the generated code, DefaultMaxMem if empty.
+	MaxMem string
+	// NoStamp disables the timestamps in the generated files.
+	NoStamp bool
+	// FromModel is a model written by WriteModel to generate from instead of parsing the headers.
+	FromModel string
+}
+
+// Result holds the generated package, nothing is written to disk until Write is called.
+type Result struct {
+	// Dir is the package dir the files belong to.
+	Dir string
+	// Files are the contents of the generated files keyed by their names in Dir.
+	Files map[string][]byte
+	// Inputs are the headers, or the model, the package has been generated from.
+	Inputs []string
+	// Methods lists the functions bound as methods and the ones kept as functions.
+	Methods []string
+	// Diagnostics are the problems found that didn't stop the generation.
+	Diagnostics diag.List
+	Stats       Stats
+}
+
+// Stats counts the declarations written to the package.
+type Stats struct {
+	Files     int
+	Consts    int
+	Types     int
+	Unions    int
+	Functions int
+	Macros    int
+	Duration  time.Duration
+}
+
+// parseMu serializes the calls, the state of the C parser is global to the process.
+var parseMu sync.Mutex
+
+// Generate parses the headers of the package described by opts.ConfigPath and
+// generates its files in memory. The context is checked between the phases,
+// a phase that has started runs to completion.
+// When the generation fails because of the config or the headers, the error is
+// a diag.List with all the diagnostics found up to that point.
+// It's safe to call Generate and LearnModel concurrently, though the calls
+// run one at a time as the C parser keeps its state in globals.
+func Generate(ctx context.Context, opts Options) (*Result, error) {
+	parseMu.Lock()
+	defer parseMu.Unlock()
+	t0 := time.Now()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	diags := new(collector)
+	mark := parser.FileMark()
+	c, err := newProcessFor(opts, diags)
+	if err != nil {
+		return nil, diags.fail(err, diag.CodeConfig)
+	}
+	if err := ctx.Err(); err != nil {
+		c.close()
+		return nil, err
+	}
+	c.generateAll(opts.NoCGO)
+	dir, files, err := c.render(opts.NoCGO)
+	if err != nil {
+		return nil, diags.fail(err, diag.CodeGenerate)
+	}
+	result := &Result{
+		Dir:     dir,
+		Files:   make(map[string][]byte, len(files)),
+		Inputs:  c.inputFiles(mark),
+		Methods: c.methods(),
+		Stats:   c.stats,
+	}
+	for _, f := range files {
+		result.Files[f.name] = f.data
+	}
+	result.Diagnostics = diags.diagnostics()
+	result.Stats.Files = len(files)
+	result.Stats.Duration = time.Since(t0)
+	return result, ctx.Err()
+}
+
+// LearnModel parses the headers of the package described by opts.ConfigPath and
+// returns the model learned by the translator, it can be written with WriteModel
+// and used later as Options.FromModel. The model of the first target is returned
+// when the config lists several Arches. The diagnostics are the problems found
+// while learning, see Generate for the error.
+func LearnModel(ctx context.Context, opts Options) (*translator.Model, diag.List, error) {
+	parseMu.Lock()
+	defer parseMu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	diags := new(collector)
+	c, err := newProcessFor(opts, diags)
+	if err != nil {
+		return nil, nil, diags.fail(err, diag.CodeConfig)
+	}
+	c.close()
+	return c.tr.Model(), diags.diagnostics(), ctx.Err()
+}
+
+// WriteModel writes a model as indented JSON.
+func WriteModel(wr io.Writer, model *translator.Model) error {
+	enc := json.NewEncoder(wr)
+	enc.SetIndent("", "  ")
+	return enc.Encode(model)
+}
+
+// inputFiles lists the files the package has been generated from,
+// the headers are the ones read since the mark.
+func (c *process) inputFiles(mark int) []string {
+	if len(c.opts.FromModel) > 0 {
+		if path, err := filepath.Abs(c.opts.FromModel); err == nil {
+			return []string{path}
+		}
+		return []string{c.opts.FromModel}
+	}
+	return parser.SourceFiles(mark)
+}
+
+func (c *process) methods() []string {
+	buf := new(bytes.Buffer)
+	if c.gen.WriteMethodReport(buf) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
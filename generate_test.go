@@ -0,0 +1,228 @@
+package build
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReproducibleOutput(t *testing.T) {
+	opts := Options{
+		ConfigPath: "test/det/det.yml",
+		NoStamp:    true,
+	}
+	first, err := Generate(context.Background(), opts)
+	require.NoError(t, err)
+	second, err := Generate(context.Background(), opts)
+	require.NoError(t, err)
+	require.NotEmpty(t, first.Files)
+	assert.Equal(t, fileNames(first.Files), fileNames(second.Files))
+	for name, data := range first.Files {
+		if bytes.Equal(data, second.Files[name]) {
+			continue
+		}
+		diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(string(data)),
+			B:        difflib.SplitLines(string(second.Files[name])),
+			FromFile: "first/" + name,
+			ToFile:   "second/" + name,
+			Context:  1,
+		})
+		t.Errorf("%s differs between runs:\n%s", name, diff)
+	}
+}
+
+func TestInputsOfEachCall(t *testing.T) {
+	_, err := Generate(context.Background(), Options{ConfigPath: "test/det/det.yml", NoStamp: true})
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	header := filepath.Join(dir, "other.h")
+	require.NoError(t, ioutil.WriteFile(header, []byte("int other(int x);\n"), 0644))
+	cfg := "GENERATOR: {PackageName: other}\nPARSER: {SourcesPaths: [other.h]}\n"
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "other.yml"), []byte(cfg), 0644))
+	result, err := Generate(context.Background(), Options{ConfigPath: filepath.Join(dir, "other.yml"), NoStamp: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{header}, result.Inputs)
+}
+
+func TestSharedFilesTargetLabel(t *testing.T) {
+	dir := t.TempDir()
+	src := "typedef struct { long n; } counter_t;\nint count(counter_t *c);\n"
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "multi.h"), []byte(src), 0644))
+	cfg := "GENERATOR: {PackageName: multi}\nPARSER: {Arches: [amd64, \"386\"], SourcesPaths: [multi.h]}\n" +
+		"TRANSLATOR: {Rules: {global: [{action: accept, from: ^count}]}}\n"
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "multi.yml"), []byte(cfg), 0644))
+	result, err := Generate(context.Background(), Options{ConfigPath: filepath.Join(dir, "multi.yml"), NoStamp: true})
+	require.NoError(t, err)
+	require.Contains(t, result.Files, "types_386.go")
+	for name, data := range result.Files {
+		if filepath.Ext(name) != ".go" {
+			continue
+		}
+		switch name {
+		case "types_amd64.go":
+			assert.Contains(t, string(data), "// Target: x86_64,", name)
+		case "types_386.go":
+			assert.Contains(t, string(data), "// Target: i386,", name)
+		default:
+			assert.NotContains(t, string(data), "// Target: ", name)
+			assert.Contains(t, string(data), "// Targets: amd64, 386,", name)
+		}
+	}
+}
+
+func TestDeclsOfSecondArchOnly(t *testing.T) {
+	dir := t.TempDir()
+	src := "#ifdef __aarch64__\ntypedef struct { int n; } arm_state_t;\nint arm_only(arm_state_t *s);\n#endif\n"
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "multi.h"), []byte(src), 0644))
+	cfg := "GENERATOR: {PackageName: multi}\nPARSER: {Arches: [amd64, aarch64], SourcesPaths: [multi.h]}\n" +
+		"TRANSLATOR: {Rules: {global: [{action: accept, from: ^arm}]}}\n"
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "multi.yml"), []byte(cfg), 0644))
+	result, err := Generate(context.Background(), Options{ConfigPath: filepath.Join(dir, "multi.yml"), NoStamp: true})
+	require.NoError(t, err)
+	require.Contains(t, result.Files, "types_arm64.go")
+	assert.Contains(t, string(result.Files["types_arm64.go"]), "C.arm_only(")
+	assert.Contains(t, string(result.Files["types_arm64.go"]), "C.arm_state_t")
+	assert.NotContains(t, result.Files, "types_amd64.go")
+}
+
+func TestTargetSizeTypes(t *testing.T) {
+	dir := t.TempDir()
+	src := "typedef __SIZE_TYPE__ size_t;\ntypedef __PTRDIFF_TYPE__ ptrdiff_t;\ntypedef __WCHAR_TYPE__ wchar_t;\n" +
+		"size_t sz_len(ptrdiff_t d, wchar_t w);\n"
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "sz.h"), []byte(src), 0644))
+	cfg := "GENERATOR: {PackageName: sz, Includes: [sz.h]}\n" +
+		"PARSER: {Arches: [amd64, \"386\", x86_64-windows, arm], SourcesPaths: [sz.h]}\n" +
+		"TRANSLATOR: {Rules: {global: [{action: accept, from: ^sz_}]}}\n"
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "sz.yml"), []byte(cfg), 0644))
+	result, err := Generate(context.Background(), Options{ConfigPath: filepath.Join(dir, "sz.yml"), NoStamp: true})
+	require.NoError(t, err)
+	for file, sig := range map[string]string{
+		"types_amd64.go":         "func sz_len(d int64, w int32) uint64",
+		"types_386.go":           "func sz_len(d int32, w int32) uint32",
+		"types_windows_amd64.go": "func sz_len(d int64, w uint16) uint64",
+		"types_arm.go":           "func sz_len(d int32, w uint32) uint32",
+	} {
+		assert.Contains(t, string(result.Files[file]), sig, file)
+	}
+}
+
+func TestUnknownArches(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "arch.h"), []byte("int arch_id(void);\n"), 0644))
+	for _, arch := range []string{"mips", "ppc64", "sparc", "armbe", "arm64be", "mips64le-linux-gnu"} {
+		for _, target := range []string{"Arch: " + arch, "Arches: [amd64, " + arch + "]"} {
+			cfg := "GENERATOR: {PackageName: arch}\nPARSER: {" + target + ", SourcesPaths: [arch.h]}\n"
+			require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "arch.yml"), []byte(cfg), 0644))
+			_, err := Generate(context.Background(), Options{ConfigPath: filepath.Join(dir, "arch.yml"), NoStamp: true})
+			if assert.Error(t, err, target) {
+				assert.Contains(t, err.Error(), `unknown arch "`+arch+`"`, target)
+			}
+		}
+	}
+}
+
+func TestOwnedStrings(t *testing.T) {
+	dir := t.TempDir()
+	src := "char *str_dup(const char *s);\nchar *str_name(void);\nvoid str_free(char *s);\n"
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "str.h"), []byte(src), 0644))
+	cfg := `GENERATOR: {PackageName: str, Includes: [str.h]}
+PARSER: {SourcesPaths: [str.h]}
+TRANSLATOR:
+  PtrTips:
+    function:
+      - {target: ^str_(dup|name)$, self: owned}
+  TypeTips:
+    function:
+      - {target: ^str_dup$, self: string}
+  Deallocators:
+    - {target: ^str_, free: str_free}
+  Rules:
+    global: [{action: accept, from: ^str_}]
+`
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "str.yml"), []byte(cfg), 0644))
+	result, err := Generate(context.Background(), Options{ConfigPath: filepath.Join(dir, "str.yml"), NoStamp: true})
+	require.NoError(t, err)
+	code := string(result.Files["str.go"])
+
+	// the string tip copies the string and frees it by the deallocator
+	assert.Contains(t, code, "func str_dup(s string) string {")
+	assert.Contains(t, code, "C.str_free((*C.char)(unsafe.Pointer(__ret)))")
+
+	// char * stays a pointer without it
+	assert.Contains(t, code, "func str_name() *byte {")
+	require.Len(t, result.Diagnostics, 1)
+	assert.Contains(t, result.Diagnostics[0].Message, "str_name: owned tip ignored")
+}
+
+func TestCallbackProxies(t *testing.T) {
+	dir := t.TempDir()
+	src := "typedef void (*plain_cb)(int v);\nvoid set_plain(plain_cb cb);\n" +
+		"typedef int (*ud_cb)(int v, void *ud);\nvoid set_ud(ud_cb cb, void *ud);\n"
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "cb.h"), []byte(src), 0644))
+	cfg := `GENERATOR: {PackageName: cb, Includes: [cb.h]}
+PARSER: {SourcesPaths: [cb.h]}
+TRANSLATOR:
+  PtrTips:
+    function:
+      - {target: ^ud_cb$, tips: ["", userdata]}
+      - {target: ^set_ud$, tips: ["", userdata]}
+  Rules:
+    global: [{action: accept, from: "^(plain|ud|set)"}]
+`
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "cb.yml"), []byte(cfg), 0644))
+	result, err := Generate(context.Background(), Options{ConfigPath: filepath.Join(dir, "cb.yml"), NoStamp: true})
+	require.NoError(t, err)
+	helpers := string(result.Files["cgo_helpers.go"])
+	require.NotEmpty(t, helpers)
+	assert.NotContains(t, helpers, "panic(")
+
+	// the callbacks without user data keep their func in a variable
+	assert.Contains(t, helpers, "var plain_cb839B7006Func plain_cb")
+	assert.Contains(t, helpers, "plain_cb839B7006Func = x")
+	assert.NotContains(t, helpers, ".(plain_cb)")
+
+	// the handles dispatch by the user data, the funcs passed as is use the variable
+	assert.Contains(t, helpers, "ud_cbC9D8A96BFunc, _ := cgoHandleValue(uintptr(cud)).(ud_cb)")
+	assert.Contains(t, helpers, "return (*C.ud_cb)(C.ud_cb_c9d8a96b), nil")
+	assert.Contains(t, helpers, "var ud_cbC9D8A96BFnFunc ud_cb")
+	assert.Contains(t, helpers, "ud_cbC9D8A96BFnFunc = x\n\t}\n\treturn (*C.ud_cb)(C.ud_cb_c9d8a96b_fn), nil")
+	assert.Contains(t, helpers, "var zero C.int\n\treturn zero")
+}
+
+func fileNames(tree map[string][]byte) []string {
+	names := make([]string, 0, len(tree))
+	for name := range tree {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -3,12 +3,14 @@ module github.com/bhojpur/build
 go 1.16
 
 require (
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/stretchr/testify v1.6.1
 	github.com/tj/go-spin v1.1.0
 	golang.org/x/sys v0.0.0-20220520151302-bc2c85ada10a // indirect
 	golang.org/x/tools v0.1.10
 	golang.org/x/xerrors v0.0.0-20220517211312-f3a8303e98df // indirect
 	gopkg.in/yaml.v2 v2.4.0
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 	modernc.org/cc v1.0.1
 	modernc.org/golex v1.0.1 // indirect
 	modernc.org/strutil v1.1.2 // indirect
@@ -0,0 +1,239 @@
+package build
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bhojpur/build/pkg/cpp/diag"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// manifestName is the file that lists the files the generator owns in the package dir,
+// the files listed by a previous run that are not generated anymore get removed.
+const manifestName = ".buildc2go-manifest.json"
+
+const manifestVersion = 1
+
+type manifest struct {
+	Version int      `json:"version"`
+	Files   []string `json:"files"`
+}
+
+// readManifest returns the files listed in the manifest of dir, none if there is no manifest.
+func readManifest(dir string) ([]string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, manifestName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, name := range m.Files {
+		// the files are never looked up outside of dir
+		if name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+			continue
+		}
+		files = append(files, name)
+	}
+	return files, nil
+}
+
+// staleFiles returns the files in dir that a previous run generated and
+// that are not among the files anymore, the hand-written files are never listed.
+func staleFiles(dir string, files []outputFile) ([]string, error) {
+	owned, err := readManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]bool, len(files))
+	for _, f := range files {
+		current[f.name] = true
+	}
+	var stale []string
+	for _, name := range owned {
+		if current[name] {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			stale = append(stale, name)
+		}
+	}
+	return stale, nil
+}
+
+// writeOutputFiles stages the files that have changed in a temporary dir next to them
+// and moves them in place only once all of them have been written, so nothing is written
+// if staging fails. Each file is replaced atomically but the package as a whole is not,
+// a rename failing halfway leaves a mix of the old and the new files and the manifest
+// still lists the stale ones, so the next run picks them up. The unchanged files are not
+// touched to keep their modification times, the stale files are removed before the
+// manifest is updated.
+func writeOutputFiles(dir string, files []outputFile) error {
+	stale, err := staleFiles(dir, files)
+	if err != nil {
+		return err
+	}
+	m := manifest{
+		Version: manifestVersion,
+		Files:   make([]string, 0, len(files)),
+	}
+	for _, f := range files {
+		m.Files = append(m.Files, f.name)
+	}
+	sort.Strings(m.Files)
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	files = append(files, outputFile{name: manifestName, data: append(data, '\n')})
+
+	stageDir, err := ioutil.TempDir(dir, ".buildc2go-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stageDir)
+	var staged []string
+	for _, f := range files {
+		if old, err := ioutil.ReadFile(filepath.Join(dir, f.name)); err == nil && bytes.Equal(old, f.data) {
+			continue
+		}
+		if err := ioutil.WriteFile(filepath.Join(stageDir, f.name), f.data, 0666); err != nil {
+			return err
+		}
+		staged = append(staged, f.name)
+	}
+	manifestStaged := false
+	for _, name := range staged {
+		if name == manifestName {
+			manifestStaged = true
+			continue
+		}
+		if err := os.Rename(filepath.Join(stageDir, name), filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	for _, name := range stale {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if !manifestStaged {
+		return nil
+	}
+	// the manifest still lists the stale files until they are gone
+	return os.Rename(filepath.Join(stageDir, manifestName), filepath.Join(dir, manifestName))
+}
+
+// outputFiles returns the files of the result sorted by their names.
+func (r *Result) outputFiles() []outputFile {
+	names := make([]string, 0, len(r.Files))
+	for name := range r.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	files := make([]outputFile, 0, len(names))
+	for _, name := range names {
+		files = append(files, outputFile{name: name, data: r.Files[name]})
+	}
+	return files
+}
+
+// Write writes the files into the package dir and removes the files a previous run
+// generated that are not part of the result anymore. The error is a diag.List.
+func (r *Result) Write() error {
+	if err := os.MkdirAll(r.Dir, 0755); err != nil {
+		return errorAt(r.Dir, diag.CodeWrite, err)
+	}
+	if err := writeOutputFiles(r.Dir, r.outputFiles()); err != nil {
+		return errorAt(r.Dir, diag.CodeWrite, err)
+	}
+	return nil
+}
+
+// Diff compares the files with the ones in the package dir and writes a unified diff
+// for each file that differs or would be removed as stale, the dir is left untouched.
+// It reports whether all the files are up to date.
+func (r *Result) Diff(wr io.Writer) (bool, error) {
+	files := r.outputFiles()
+	upToDate := true
+	for _, f := range files {
+		path := filepath.Join(r.Dir, f.name)
+		fromFile := path
+		old, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			fromFile = "/dev/null"
+		} else if err != nil {
+			return false, err
+		}
+		if bytes.Equal(old, f.data) {
+			continue
+		}
+		upToDate = false
+		var oldLines []string
+		if len(old) > 0 {
+			oldLines = difflib.SplitLines(string(old))
+		}
+		err = difflib.WriteUnifiedDiff(wr, difflib.UnifiedDiff{
+			A:        oldLines,
+			B:        difflib.SplitLines(string(f.data)),
+			FromFile: fromFile,
+			ToFile:   path,
+			Context:  3,
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+	stale, err := staleFiles(r.Dir, files)
+	if err != nil {
+		return false, err
+	}
+	for _, name := range stale {
+		path := filepath.Join(r.Dir, name)
+		old, err := ioutil.ReadFile(path)
+		if err != nil {
+			return false, err
+		}
+		upToDate = false
+		err = difflib.WriteUnifiedDiff(wr, difflib.UnifiedDiff{
+			A:        difflib.SplitLines(string(old)),
+			FromFile: path,
+			ToFile:   "/dev/null",
+			Context:  3,
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+	return upToDate, nil
+}
@@ -0,0 +1,243 @@
+package diag
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"strings"
+)
+
+// Severity tells how serious a diagnostic is, the more serious the higher.
+type Severity int
+
+const (
+	Warning Severity = iota
+	Error
+)
+
+var severityNames = map[Severity]string{
+	Warning: "warning",
+	Error:   "error",
+}
+
+func (s Severity) String() string {
+	if name, ok := severityNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+// ParseSeverity returns the severity named s.
+func ParseSeverity(s string) (Severity, error) {
+	for sev, name := range severityNames {
+		if strings.EqualFold(s, name) {
+			return sev, nil
+		}
+	}
+	return 0, fmt.Errorf("diag: unknown severity %q, must be warning or error", s)
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Severity) UnmarshalText(text []byte) error {
+	sev, err := ParseSeverity(string(text))
+	if err != nil {
+		return err
+	}
+	*s = sev
+	return nil
+}
+
+// Codes of the diagnostics, they are stable and can be used to filter diagnostics.
+const (
+	CodeConfig          = "config"
+	CodePkgConfig       = "pkg-config"
+	CodeHostCPP         = "host-cpp"
+	CodeParse           = "parse"
+	CodeTranslate       = "translate"
+	CodeMacroEval       = "macro-eval"
+	CodeMacroFunc       = "macro-func"
+	CodeBitField        = "bitfield"
+	CodeGenerate        = "generate"
+	CodeErrorRule       = "error-rule"
+	CodeOwnedTip        = "owned-tip"
+	CodeSliceTip        = "slice-tip"
+	CodeUserData        = "user-data"
+	CodeHandle          = "handle"
+	CodeMethodCollision = "method-collision"
+	CodeGofmt           = "gofmt"
+	CodeWrite           = "write"
+	CodeOutOfDate       = "out-of-date"
+	CodeCache           = "cache"
+	CodeModel           = "model"
+)
+
+// Position is the place a diagnostic refers to, a line of the YAML config
+// or of a header. The line and the column are optional.
+type Position struct {
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+}
+
+// FromPos converts a position of a token.FileSet.
+func FromPos(pos token.Position) Position {
+	return Position{
+		File:   pos.Filename,
+		Line:   pos.Line,
+		Column: pos.Column,
+	}
+}
+
+func (p Position) IsValid() bool {
+	return len(p.File) > 0
+}
+
+func (p Position) String() string {
+	s := p.File
+	if p.Line > 0 {
+		s += fmt.Sprintf(":%d", p.Line)
+		if p.Column > 0 {
+			s += fmt.Sprintf(":%d", p.Column)
+		}
+	}
+	return s
+}
+
+// Diagnostic is a problem found while generating a package.
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Pos      Position `json:"pos"`
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+}
+
+// String formats the diagnostic the way compilers do:
+// file:line:column: severity: message [code]
+func (d Diagnostic) String() string {
+	var buf strings.Builder
+	if d.Pos.IsValid() {
+		buf.WriteString(d.Pos.String())
+		buf.WriteString(": ")
+	}
+	fmt.Fprintf(&buf, "%s: %s", d.Severity, d.Message)
+	if len(d.Code) > 0 {
+		fmt.Fprintf(&buf, " [%s]", d.Code)
+	}
+	return buf.String()
+}
+
+// Handler receives the diagnostics as they are found.
+type Handler func(Diagnostic)
+
+// List is a list of diagnostics, it is also returned as an error
+// when some of them are errors.
+type List []Diagnostic
+
+// Add appends a diagnostic unless the same one is already there,
+// the targets of a package often report the same problems.
+func (l *List) Add(d Diagnostic) {
+	for _, prev := range *l {
+		if prev == d {
+			return
+		}
+	}
+	*l = append(*l, d)
+}
+
+// Error describes the first error of the list.
+func (l List) Error() string {
+	var errs []Diagnostic
+	for _, d := range l {
+		if d.Severity >= Error {
+			errs = append(errs, d)
+		}
+	}
+	switch len(errs) {
+	case 0:
+		return "no errors"
+	case 1:
+		return errs[0].String()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", errs[0], len(errs)-1)
+}
+
+// Err returns the list as an error if it has any errors, nil otherwise.
+func (l List) Err() error {
+	if l.Fails(Error) {
+		return l
+	}
+	return nil
+}
+
+// Fails reports whether any of the diagnostics is at least as serious as min.
+func (l List) Fails(min Severity) bool {
+	for _, d := range l {
+		if d.Severity >= min {
+			return true
+		}
+	}
+	return false
+}
+
+// FromError converts err into a list of error diagnostics, err is returned as is
+// if it's a List already, the parse errors keep their positions. The other errors
+// become a single diagnostic with the code.
+func FromError(err error, code string) List {
+	if err == nil {
+		return nil
+	}
+	var list List
+	if errors.As(err, &list) {
+		return list
+	}
+	var scanErrs scanner.ErrorList
+	if errors.As(err, &scanErrs) {
+		for _, e := range scanErrs {
+			list = append(list, Diagnostic{
+				Severity: Error,
+				Pos:      FromPos(e.Pos),
+				Code:     code,
+				Message:  e.Msg,
+			})
+		}
+		return list
+	}
+	var scanErr *scanner.Error
+	if errors.As(err, &scanErr) {
+		return List{{
+			Severity: Error,
+			Pos:      FromPos(scanErr.Pos),
+			Code:     code,
+			Message:  scanErr.Msg,
+		}}
+	}
+	return List{{
+		Severity: Error,
+		Code:     code,
+		Message:  err.Error(),
+	}}
+}
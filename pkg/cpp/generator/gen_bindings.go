@@ -26,6 +26,7 @@ import (
 	"io"
 	"strings"
 
+	"github.com/bhojpur/build/pkg/cpp/diag"
 	tl "github.com/bhojpur/build/pkg/cpp/translator"
 )
 
@@ -332,7 +333,7 @@ The caller is responsible for freeing the this memory via C.free.`, name, cgoSpe
 			}
 			return mem
 		}`, name, sizeofConst)
-	fmt.Fprintln(buf, "\n")
+	fmt.Fprint(buf, "\n\n")
 	fmt.Fprintf(buf, `const %s = unsafe.Sizeof([1]%s{})`, sizeofConst, cgoSpec)
 
 	helper.Source = buf.String()
@@ -614,7 +615,7 @@ func packPlain(buf io.Writer, cgoSpec tl.CGoSpec, base string, pointers uint8, l
 }
 
 func (gen *Generator) packPlainSlice(buf io.Writer, base string, pointers uint8, level uint8) {
-	postfix := gen.randPostfix()
+	postfix := namePostfix(base, string(genIndices("i", level)))
 	fmt.Fprintf(buf, "hx%2x := (*sliceHeader)(unsafe.Pointer(&v%s))\n", postfix, genIndices("i", level))
 	fmt.Fprintf(buf, "hx%2x.Data = unsafe.Pointer(ptr%d)\n", postfix, level)
 	fmt.Fprintf(buf, "hx%2x.Cap = %s\n", postfix, gen.maxMem)
@@ -842,7 +843,7 @@ func (gen *Generator) proxyValueToGo(memTip tl.Tip, varName, ptrName string,
 	case isPlain && goSpec.Slices != 0: // ex: []byte, [][4]byte
 		gen.submitHelper(sliceHeader)
 		buf := new(bytes.Buffer)
-		postfix := gen.randPostfix()
+		postfix := namePostfix(varName, ptrName)
 		fmt.Fprintf(buf, "hx%2x := (*sliceHeader)(unsafe.Pointer(&%s))\n", postfix, varName)
 		fmt.Fprintf(buf, "hx%2x.Data = unsafe.Pointer(%s)\n", postfix, ptrName)
 		fmt.Fprintf(buf, "hx%2x.Cap = %s\n", postfix, gen.maxMem)
@@ -945,10 +946,22 @@ func (gen *Generator) createProxies(funcName string, funcSpec tl.CType) (from, t
 		}
 	}
 
+	outs := make(map[int]outParam)
+	for _, out := range gen.outParams(funcName, spec) {
+		outs[out.Index] = out
+	}
+	slicePairs, _ := gen.slicePairs(funcName, spec)
+	userDataPairs := gen.userDataPairs(funcName, spec)
+	method, isMethod := gen.methodOf(funcName)
 	ptrTipRx, typeTipRx, memTipRx := gen.tr.TipRxsForSpec(tl.TipScopeFunction, funcName, funcSpec)
 	for i, param := range spec.Params {
 		var goSpec tl.GoTypeSpec
 		ptrTip := ptrTipRx.TipAt(i)
+		if _, ok := pairByPtr(slicePairs, i); ok {
+			ptrTip = tl.TipPtrArr
+		} else if isMethod && i == 0 {
+			ptrTip = tl.TipPtrRef
+		}
 		typeTip := typeTipRx.TipAt(i)
 		goSpec = gen.tr.TranslateSpec(param.Spec, ptrTip, typeTip)
 		cgoSpec := gen.tr.CGoSpec(param.Spec, true)
@@ -969,6 +982,65 @@ func (gen *Generator) createProxies(funcName string, funcSpec tl.CType) (from, t
 		if !argTip.IsValid() {
 			argTip = gen.MemTipOf(param)
 		}
+		if isMethod && i == 0 && method.Handle != nil {
+			gen.useHandle(method.Handle)
+			from[i] = proxyDecl{Name: name, Decl: fmt.Sprintf("%s := %s.Ref()", name, gen.receiverName(spec, method))}
+			continue
+		} else if isMethod && i == 0 {
+			refName = gen.receiverName(spec, method)
+		}
+		if pair, ok := pairByLen(slicePairs, i); ok {
+			value := gen.capacityName(param)
+			if !pair.Out {
+				value = fmt.Sprintf("len(%s)", gen.tr.TransformName(tl.TargetType, spec.Params[pair.Ptr].Name, public))
+			}
+			decl, ref := gen.sliceLenProxy(param, name, value)
+			from[i] = proxyDecl{Name: ref, Decl: decl}
+			continue
+		}
+		if out, ok := outs[i]; ok && out.Slice != nil {
+			capacity := gen.capacityName(spec.Params[out.Slice.Len])
+			from[i] = proxyDecl{Name: name, Decl: gen.outSliceProxy(out, name, capacity)}
+			continue
+		} else if ok {
+			decl, keepalive := gen.outParamProxy(out, name, refName)
+			from[i] = proxyDecl{Name: "&" + name, Decl: decl}
+			if len(keepalive) > 0 {
+				to = append(to, proxyDecl{Name: name, Decl: keepalive})
+			}
+			continue
+		}
+		if ptrTip == tl.TipPtrUserData {
+			j, ok := userDataPairs[i]
+			if !ok {
+				gen.warn(gen.declPos(funcName), diag.CodeUserData, "%s: no callback with user data found for param %d, passing nil", funcName, i)
+				from[i] = proxyDecl{Name: "nil"}
+				continue
+			}
+			// both the callback and its user data are taken from the handle
+			cbName := from[j].Name
+			if len(cbName) == 0 {
+				cbName = "c" + string(gen.tr.TransformName(tl.TargetType, spec.Params[j].Name, public))
+				_, seen := cNamesSeen[cbName]
+				for seen {
+					cbName = "c" + cbName
+					_, seen = cNamesSeen[cbName]
+				}
+				cNamesSeen[cbName] = struct{}{}
+			}
+			cbGoSpec := gen.tr.TranslateSpec(spec.Params[j].Spec, ptrTipRx.TipAt(j), typeTipRx.TipAt(j))
+			cbCGoSpec := gen.tr.CGoSpec(spec.Params[j].Spec, true)
+			cbProxy, _ := gen.proxyArgFromGo(memTipRx.TipAt(j), refName, cbGoSpec, cbCGoSpec)
+			from[j] = proxyDecl{Name: cbName, Decl: fmt.Sprintf("%s, _ := %s", cbName, cbProxy)}
+			from[i] = proxyDecl{Name: name, Decl: fmt.Sprintf("%s := %s.Pointer()", name, refName)}
+			continue
+		}
+		if isPaired(userDataPairs, i) {
+			if len(from[i].Name) == 0 {
+				from[i].Name = name
+			}
+			continue
+		}
 		var needKeepalive bool
 		if gen.cfg.Options.SafeStrings && goSpec.IsGoString() {
 			needKeepalive = true
@@ -1038,7 +1110,13 @@ func (gen *Generator) writeFunctionBody(wr io.Writer, decl *tl.CDecl) {
 		wr2.Line(proxy.Decl)
 	}
 	spec := decl.Spec.(*tl.CFunctionSpec)
-	if spec.Return != nil {
+	errnoRx, errno := gen.errnoTip(decl.Name)
+	switch {
+	case spec.Return != nil && errno:
+		fmt.Fprint(wr, "__ret, __err := ")
+	case errno:
+		fmt.Fprint(wr, "_, __err := ")
+	case spec.Return != nil:
 		fmt.Fprint(wr, "__ret := ")
 	}
 	fmt.Fprintf(wr, "C.%s", decl.Name)
@@ -1053,11 +1131,43 @@ func (gen *Generator) writeFunctionBody(wr io.Writer, decl *tl.CDecl) {
 	writeSpace(wr, 1)
 	// wr2 being populated above
 	wr2.WriteTo(wr)
-	if spec.Return != nil {
+	outs := gen.outParams(decl.Name, spec)
+	results := make([]string, 0, len(outs)+1)
+	for _, out := range outs {
+		goName := "__" + out.Name
+		if out.Slice != nil {
+			var written string
+			if lenRef := from[out.Slice.Len].Name; strings.HasPrefix(lenRef, "&") {
+				written = fmt.Sprintf("int(%s)", lenRef[1:])
+			} else if spec.Return != nil {
+				written = "int(__ret)"
+			}
+			if len(written) > 0 {
+				gen.submitHelper(sliceLen)
+				fmt.Fprintf(wr, "%s = %s[:sliceLen(%s, len(%s))]\n", goName, goName, written, goName)
+			}
+			results = append(results, goName)
+			continue
+		}
+		outProxy, _ := gen.proxyRetToGo(tl.NoTip, goName, strings.TrimPrefix(from[out.Index].Name, "&"), out.GoSpec, out.CGoSpec)
+		fmt.Fprintln(wr, outProxy)
+		results = append(results, goName)
+	}
+	rule, errRule := gen.errorRule(decl)
+	errRule = errRule && !errno
+	if errRule && !rule.KeepsValue() {
+		results = gen.writeErrorReturn(wr, rule, results)
+	} else if h, ok := gen.handleConstructor(decl); ok {
+		fmt.Fprintln(wr, gen.handleProxy(h))
+		results = append(results, "__v")
+	} else if owned, ok := gen.ownedReturn(decl); ok {
+		fmt.Fprintln(wr, gen.ownedReturnProxy(owned))
+		results = append(results, "__v")
+	} else if spec.Return != nil {
 		ptrTipRx, typeTipRx, memTipRx := gen.tr.TipRxsForSpec(tl.TipScopeFunction, decl.Name, decl.Spec)
 		ptrTip := ptrTipRx.Self()
 		typeTip := typeTipRx.Self()
-		if !ptrTip.IsValid() {
+		if !isReturnPtrTip(ptrTip) {
 			// defaults to ref for the returns
 			ptrTip = tl.TipPtrRef
 		}
@@ -1069,7 +1179,16 @@ func (gen *Generator) writeFunctionBody(wr io.Writer, decl *tl.CDecl) {
 			fmt.Fprintln(wr, "if ret == nil {\nreturn nil\n}")
 		}
 		fmt.Fprintln(wr, retProxy)
-		fmt.Fprintln(wr, "return __v")
+		results = append(results, "__v")
+	}
+	if errRule && rule.KeepsValue() {
+		results = gen.writeErrorReturn(wr, rule, results)
+	}
+	if errno {
+		results = gen.writeErrnoReturn(wr, errnoRx, spec.Return != nil, results)
+	}
+	if len(results) > 0 {
+		fmt.Fprintf(wr, "return %s\n", strings.Join(results, ", "))
 	}
 	writeEndFuncBody(wr)
 }
@@ -0,0 +1,162 @@
+package generator
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+
+	"github.com/bhojpur/build/pkg/cpp/diag"
+	tl "github.com/bhojpur/build/pkg/cpp/translator"
+)
+
+// bitFieldName is the name of the unexported field that keeps a bitfield value in a wrapping struct.
+func bitFieldName(goName string) string {
+	name := unexportName(goName)
+	if token.Lookup(name).IsKeyword() {
+		return name + "_"
+	}
+	return name
+}
+
+// reservedStructMethods are the names of helper methods that bitfield accessors must not take.
+var reservedStructMethods = map[string]bool{
+	"Ref":       true,
+	"Free":      true,
+	"PassRef":   true,
+	"PassValue": true,
+	"Deref":     true,
+}
+
+func bitFieldUnitType(bf *tl.CBitField) (unsigned, signed string) {
+	bits := bf.Size * 8
+	return fmt.Sprintf("uint%d", bits), fmt.Sprintf("int%d", bits)
+}
+
+func bitFieldUnitRef(base string, bf *tl.CBitField) string {
+	unitType, _ := bitFieldUnitType(bf)
+	if bf.Offset == 0 {
+		return fmt.Sprintf("(*%s)(%s)", unitType, base)
+	}
+	return fmt.Sprintf("(*%s)(unsafe.Pointer(uintptr(%s) + %d))", unitType, base, bf.Offset)
+}
+
+// bitFieldGetter returns an expression that extracts the bitfield from the storage unit
+// in C memory at base, the signed values are sign-extended.
+func bitFieldGetter(base string, bf *tl.CBitField, goSpec tl.GoTypeSpec) string {
+	unit := "*" + bitFieldUnitRef(base, bf)
+	_, signedType := bitFieldUnitType(bf)
+	bits := bf.Size * 8
+	switch {
+	case goSpec.Base == "bool":
+		return fmt.Sprintf("%s>>%d&%#x != 0", unit, bf.Shift, bf.Mask())
+	case goSpec.Base == "int" && !goSpec.Unsigned:
+		return fmt.Sprintf("%s(%s(%s<<%d) >> %d)", goSpec, signedType, unit,
+			bits-bf.Shift-bf.Width, bits-bf.Width)
+	default:
+		return fmt.Sprintf("%s(%s >> %d & %#x)", goSpec, unit, bf.Shift, bf.Mask())
+	}
+}
+
+// bitFieldSetter returns statements that store the value into the storage unit
+// in C memory at base, leaving the other bits of the unit intact.
+func bitFieldSetter(base string, bf *tl.CBitField, goSpec tl.GoTypeSpec, value string) string {
+	buf := new(bytes.Buffer)
+	unitType, _ := bitFieldUnitType(bf)
+	fmt.Fprintf(buf, "unit := %s\n", bitFieldUnitRef(base, bf))
+	if goSpec.Base == "bool" {
+		fmt.Fprintf(buf, "*unit &^= %#x << %d\n", bf.Mask(), bf.Shift)
+		fmt.Fprintf(buf, "if %s {\n*unit |= 1 << %d\n}\n", value, bf.Shift)
+		return buf.String()
+	}
+	fmt.Fprintf(buf, "*unit = *unit&^(%#x<<%d) | (%s(%s)&%#x)<<%d\n",
+		bf.Mask(), bf.Shift, unitType, value, bf.Mask(), bf.Shift)
+	return buf.String()
+}
+
+// bitFieldTruncate returns an expression that truncates the value to the width
+// of the bitfield, the same way C does upon assignment.
+func bitFieldTruncate(bf *tl.CBitField, goSpec tl.GoTypeSpec, value string) string {
+	switch {
+	case goSpec.Base == "bool":
+		return value
+	case goSpec.Base == "int" && !goSpec.Unsigned:
+		return fmt.Sprintf("%s(int64(%s) << %d >> %d)", goSpec, value, 64-bf.Width, 64-bf.Width)
+	default:
+		return fmt.Sprintf("%s & %#x", value, bf.Mask())
+	}
+}
+
+// getBitFieldHelpers generates the getters and setters of the bitfield members. The methods of raw
+// structs work on C memory directly, the wrapping structs keep the values until PassRef or Deref.
+func (gen *Generator) getBitFieldHelpers(goStructName []byte, cStructName string, spec tl.CType, raw bool) (helpers []*Helper) {
+	structSpec := spec.(*tl.CStructSpec)
+	if raw && spec.GetPointers() > 0 {
+		return nil
+	}
+	ptrTipRx, typeTipRx, _ := gen.tr.TipRxsForSpec(tl.TipScopeType, cStructName, spec)
+	buf := new(bytes.Buffer)
+	for i, m := range structSpec.Members {
+		if m.BitField == nil {
+			continue
+		}
+		const public = true
+		goName := string(gen.tr.TransformName(tl.TargetType, m.Name, public))
+		if reservedStructMethods[goName] || reservedStructMethods["Set"+goName] {
+			gen.warn(m.Pos, diag.CodeBitField, "bitfield %s.%s clashes with a method of %s, skipping accessors",
+				cStructName, m.Name, goStructName)
+			continue
+		}
+		goSpec := gen.tr.TranslateSpec(m.Spec, ptrTipRx.TipAt(i), typeTipRx.TipAt(i))
+		bf := m.BitField
+
+		buf.Reset()
+		fmt.Fprintf(buf, "func (x *%s) %s() %s {\n", goStructName, goName, goSpec)
+		if raw {
+			fmt.Fprintf(buf, "return %s\n", bitFieldGetter("unsafe.Pointer(x)", bf, goSpec))
+		} else {
+			fmt.Fprintf(buf, "return x.%s\n", bitFieldName(goName))
+		}
+		buf.WriteString("}")
+		helpers = append(helpers, &Helper{
+			Name:        fmt.Sprintf("%s.%s", goStructName, goName),
+			Description: fmt.Sprintf("%s returns the value of the %d-bit %s bitfield.", goName, bf.Width, m.Name),
+			Source:      buf.String(),
+		})
+
+		buf.Reset()
+		fmt.Fprintf(buf, "func (x *%s) Set%s(v %s) {\n", goStructName, goName, goSpec)
+		if raw {
+			buf.WriteString(bitFieldSetter("unsafe.Pointer(x)", bf, goSpec, "v"))
+		} else {
+			fmt.Fprintf(buf, "x.%s = %s\n", bitFieldName(goName), bitFieldTruncate(bf, goSpec, "v"))
+		}
+		buf.WriteString("}")
+		helpers = append(helpers, &Helper{
+			Name: fmt.Sprintf("%s.Set%s", goStructName, goName),
+			Description: fmt.Sprintf("Set%s sets the value of the %d-bit %s bitfield, the value is truncated\n"+
+				"to the width of the bitfield as C does.", goName, bf.Width, m.Name),
+			Source: buf.String(),
+		})
+	}
+	return helpers
+}
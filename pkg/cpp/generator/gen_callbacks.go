@@ -41,6 +41,75 @@ func (gen *Generator) getCallbackHelpers(goFuncName, cFuncName string, spec tl.C
 	cbCName := fmt.Sprintf("%s_%2x", cFuncName, crc)
 	cbGoName := fmt.Sprintf("%s%2X", unexportName(goFuncName), crc)
 	funcSpec := spec.(*tl.CFunctionSpec)
+	userData := gen.callbackUserData(cFuncName, funcSpec)
+
+	cgoSpec := gen.tr.CGoSpec(&tl.CTypeSpec{
+		Base: cFuncName,
+	}, true)
+	if userData >= 0 {
+		// the handles get their own proxy that finds the func by the user data,
+		// the funcs passed as they are still go through the variable
+		helpers = append(helpers, gen.getCallbackProxyHelpers(goFuncName, cFuncName,
+			cbCName, cbGoName, funcSpec, userData, true)...)
+		helpers = append(helpers, gen.getCallbackHandleHelpers(goFuncName, cbCName, cgoSpec, spec)...)
+		cbCName += "_fn"
+		cbGoName += "Fn"
+	}
+	helpers = append(helpers, gen.getCallbackProxyHelpers(goFuncName, cFuncName,
+		cbCName, cbGoName, funcSpec, userData, false)...)
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "func (x %s) PassRef() (ref *%s, allocs *cgoAllocMap)", goFuncName, cgoSpec)
+	fmt.Fprintf(buf, `{
+		if x == nil {
+			return nil, nil
+		}
+		if %sFunc == nil {
+			%sFunc = x
+		}
+		return (*%s)(C.%s), nil
+	}`, cbGoName, cbGoName, cgoSpec, cbCName)
+	helpers = append(helpers, &Helper{
+		Name:   fmt.Sprintf("%s.PassRef", goFuncName),
+		Source: buf.String(),
+	})
+
+	if spec.GetPointers() > 0 {
+		buf = new(bytes.Buffer)
+		fmt.Fprintf(buf, "func (x %s) PassValue() (ref %s, allocs *cgoAllocMap)", goFuncName, cgoSpec)
+		fmt.Fprintf(buf, `{
+		if x == nil {
+			return nil, nil
+		}
+		if %sFunc == nil {
+			%sFunc = x
+		}
+		return (%s)(C.%s), nil
+	}`, cbGoName, cbGoName, cgoSpec, cbCName)
+		helpers = append(helpers, &Helper{
+			Name:   fmt.Sprintf("%s.PassValue", goFuncName),
+			Source: buf.String(),
+		})
+	}
+
+	buf = new(bytes.Buffer)
+	fmt.Fprintf(buf, "func New%sRef(ref unsafe.Pointer) *%s", goFuncName, goFuncName)
+	fmt.Fprintf(buf, `{
+		return (*%s)(ref)
+	}`, goFuncName)
+	helpers = append(helpers, &Helper{
+		Name:   fmt.Sprintf("New%sRef", goFuncName),
+		Source: buf.String(),
+	})
+	return
+}
+
+// getCallbackProxyHelpers returns the C proxy of a callback and the exported Go func it calls,
+// the Go func gets the func to call from the handle passed as user data if byHandle is set,
+// or from a variable otherwise. A callback that finds no func returns the zero value to C.
+func (gen *Generator) getCallbackProxyHelpers(goFuncName, cFuncName, cbCName, cbGoName string,
+	funcSpec *tl.CFunctionSpec, userData int, byHandle bool) (helpers []*Helper) {
+	crc := getRefCRC(funcSpec)
 
 	var params []string
 	var paramNames []string
@@ -52,6 +121,9 @@ func (gen *Generator) getCallbackHelpers(goFuncName, cFuncName string, spec tl.C
 		paramSpec := gen.tr.NormalizeSpecPointers(param.Spec)
 		params = append(params, fmt.Sprintf("%s %s", paramSpec.AtLevel(0), param.Name))
 		paramNames = append(paramNames, param.Name)
+		if i == userData {
+			continue
+		}
 		goName := checkName(gen.tr.TransformName(tl.TargetType, param.Name, false))
 		paramNamesGo = append(paramNamesGo, fmt.Sprintf("%s%2x", goName, crc))
 	}
@@ -86,58 +158,11 @@ func (gen *Generator) getCallbackHelpers(goFuncName, cFuncName string, spec tl.C
 		Side:   CCSide,
 	})
 
-	cgoSpec := gen.tr.CGoSpec(&tl.CTypeSpec{
-		Base: cFuncName,
-	}, true)
-	buf = new(bytes.Buffer)
-	fmt.Fprintf(buf, "func (x %s) PassRef() (ref *%s, allocs *cgoAllocMap)", goFuncName, cgoSpec)
-	fmt.Fprintf(buf, `{
-		if x == nil {
-			return nil, nil
-		}
-		if %sFunc == nil {
- 			%sFunc = x
- 		}
-		return (*%s)(C.%s), nil
-	}`, cbGoName, cbGoName, cgoSpec, cbCName)
-	helpers = append(helpers, &Helper{
-		Name:   fmt.Sprintf("%s.PassRef", goFuncName),
-		Source: buf.String(),
-	})
-
-	if spec.GetPointers() > 0 {
-		buf = new(bytes.Buffer)
-		fmt.Fprintf(buf, "func (x %s) PassValue() (ref %s, allocs *cgoAllocMap)", goFuncName, cgoSpec)
-		fmt.Fprintf(buf, `{
-		if x == nil {
-			return nil, nil
-		}
-		if %sFunc == nil {
- 			%sFunc = x
- 		}
-		return (%s)(C.%s), nil
-	}`, cbGoName, cbGoName, cgoSpec, cbCName)
-		helpers = append(helpers, &Helper{
-			Name:   fmt.Sprintf("%s.PassValue", goFuncName),
-			Source: buf.String(),
-		})
-	}
-
-	buf = new(bytes.Buffer)
-	fmt.Fprintf(buf, "func New%sRef(ref unsafe.Pointer) *%s", goFuncName, goFuncName)
-	fmt.Fprintf(buf, `{
-		return (*%s)(ref)
-	}`, goFuncName)
-	helpers = append(helpers, &Helper{
-		Name:   fmt.Sprintf("New%sRef", goFuncName),
-		Source: buf.String(),
-	})
-
 	buf = new(bytes.Buffer)
 	fmt.Fprintf(buf, "//export %s\n", cbGoName)
 	cbGoDecl := &tl.CDecl{
 		Name: cbGoName,
-		Spec: spec,
+		Spec: funcSpec,
 	}
 
 	proxyLines := gen.createCallbackProxies(cFuncName, funcSpec)
@@ -148,6 +173,11 @@ func (gen *Generator) getCallbackHelpers(goFuncName, cFuncName string, spec tl.C
 
 	gen.writeCallbackProxyFunc(buf, cbGoDecl)
 	fmt.Fprintln(buf, "{")
+	if byHandle {
+		gen.submitHelper(cgoHandleValue)
+		fmt.Fprintf(buf, "%sFunc, _ := cgoHandleValue(uintptr(%s)).(%s)\n",
+			cbGoName, gen.callbackProxyParamName(funcSpec.Params[userData], userData), goFuncName)
+	}
 	fmt.Fprintf(buf, "if %sFunc != nil {\n", cbGoName)
 	buf.WriteString(proxySrc.String())
 	if funcSpec.Return != nil {
@@ -159,15 +189,19 @@ func (gen *Generator) getCallbackHelpers(goFuncName, cFuncName string, spec tl.C
 		retProxy, _ := gen.proxyArgFromGo(memTipRx.Self(), ret, retGoSpec, retCGoSpec)
 		fmt.Fprintf(buf, "ret, _ := %s\n", retProxy)
 		fmt.Fprintf(buf, "return ret\n")
+		fmt.Fprintln(buf, "}")
+		// the func has not been set or its handle has been released
+		fmt.Fprintf(buf, "var zero %s\n", gen.tr.CGoSpec(funcSpec.Return, false))
+		fmt.Fprintln(buf, "return zero")
 	} else {
 		fmt.Fprintf(buf, "%sFunc(%s)\n", cbGoName, paramNamesGoList)
-		fmt.Fprintln(buf, "return")
+		fmt.Fprintln(buf, "}")
 	}
 	fmt.Fprintln(buf, "}")
-	fmt.Fprintln(buf, `panic("callback func has not been set (race?)")`)
-	fmt.Fprintln(buf, "}")
 
-	fmt.Fprintf(buf, "\n\nvar %sFunc %s", cbGoName, goFuncName)
+	if !byHandle {
+		fmt.Fprintf(buf, "\n\nvar %sFunc %s", cbGoName, goFuncName)
+	}
 	helpers = append(helpers, &Helper{
 		Name:   cbGoName,
 		Source: buf.String(),
@@ -191,16 +225,11 @@ func (gen *Generator) writeCallbackProxyFunc(wr io.Writer, decl *tl.CDecl) {
 
 func (gen *Generator) writeCallbackProxyFuncParams(wr io.Writer, spec tl.CType) {
 	funcSpec := spec.(*tl.CFunctionSpec)
-	const public = false
 
 	writeStartParams(wr)
 	for i, param := range funcSpec.Params {
-		declName := checkName(gen.tr.TransformName(tl.TargetType, param.Name, public))
-		if len(param.Name) == 0 {
-			declName = []byte(fmt.Sprintf("arg%d", i))
-		}
 		cgoSpec := gen.tr.CGoSpec(param.Spec, true)
-		fmt.Fprintf(wr, "c%s %s", declName, cgoSpec.AtLevel(0))
+		fmt.Fprintf(wr, "%s %s", gen.callbackProxyParamName(param, i), cgoSpec.AtLevel(0))
 
 		if i < len(funcSpec.Params)-1 {
 			fmt.Fprintf(wr, ", ")
@@ -225,6 +254,10 @@ func (gen *Generator) createCallbackProxies(funcName string, funcSpec tl.CType)
 	for i, param := range spec.Params {
 		var goSpec tl.GoTypeSpec
 		ptrTip := ptrTipRx.TipAt(i)
+		if ptrTip == tl.TipPtrUserData {
+			// resolves the Go func itself
+			continue
+		}
 		typeTip := typeTipRx.TipAt(i)
 		goSpec = gen.tr.TranslateSpec(param.Spec, ptrTip, typeTip)
 		cgoSpec := gen.tr.CGoSpec(param.Spec, true)
@@ -286,7 +319,7 @@ func (gen *Generator) proxyCallbackArgToGo(memTip tl.Tip, varName, ptrName strin
 	case isPlain && goSpec.Slices != 0: // ex: []byte, [][4]byte
 		gen.submitHelper(sliceHeader)
 		buf := new(bytes.Buffer)
-		postfix := gen.randPostfix()
+		postfix := namePostfix(varName, ptrName)
 		fmt.Fprintf(buf, "var %s %s\n", varName, goSpec)
 		fmt.Fprintf(buf, "hx%2x := (*sliceHeader)(unsafe.Pointer(&%s))\n", postfix, varName)
 		fmt.Fprintf(buf, "hx%2x.Data = unsafe.Pointer(%s)\n", postfix, ptrName)
@@ -319,3 +352,179 @@ func (gen *Generator) proxyCallbackArgToGo(memTip tl.Tip, varName, ptrName strin
 		return
 	}
 }
+
+// callbackUserData returns the index of the parameter that carries the user data
+// of the callback, or -1 if the callback has no such parameter.
+func (gen *Generator) callbackUserData(cFuncName string, spec *tl.CFunctionSpec) int {
+	ptrTipRx, ok := gen.tr.PtrTipRx(tl.TipScopeFunction, cFuncName)
+	if !ok {
+		return -1
+	}
+	for i := range spec.Params {
+		if ptrTipRx.TipAt(i) == tl.TipPtrUserData {
+			return i
+		}
+	}
+	return -1
+}
+
+func (gen *Generator) callbackProxyParamName(param *tl.CDecl, i int) string {
+	const public = false
+	if len(param.Name) == 0 {
+		return fmt.Sprintf("carg%d", i)
+	}
+	return "c" + string(checkName(gen.tr.TransformName(tl.TargetType, param.Name, public)))
+}
+
+// getCallbackHandleHelpers returns the handle type that binds a Go func to the user data
+// of the callback, so each registered func is dispatched to its own closure.
+func (gen *Generator) getCallbackHandleHelpers(goFuncName, cbCName string,
+	cgoSpec tl.CGoSpec, spec tl.CType) (helpers []*Helper) {
+
+	handleName := goFuncName + "Handle"
+	helpers = append(helpers, &Helper{
+		Name: handleName,
+		Description: fmt.Sprintf("%s holds a %s func for the C side, the func is passed to C as the user data\n"+
+			"of the callback and must be released when C no longer references it.", handleName, goFuncName),
+		Source:   fmt.Sprintf("type %s cgo.Handle", handleName),
+		Requires: Helpers{cgoHandlePtr},
+	})
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "func New%s(fn %s) %s {\n", handleName, goFuncName, handleName)
+	fmt.Fprintf(buf, "return %s(cgo.NewHandle(fn))\n}", handleName)
+	helpers = append(helpers, &Helper{
+		Name:        "New" + handleName,
+		Description: fmt.Sprintf("New%s returns a handle that dispatches the callbacks to fn.", handleName),
+		Source:      buf.String(),
+	})
+
+	buf = new(bytes.Buffer)
+	fmt.Fprintf(buf, "func (h %s) Release() {\n", handleName)
+	fmt.Fprintln(buf, "cgo.Handle(h).Delete()\n}")
+	helpers = append(helpers, &Helper{
+		Name:        handleName + ".Release",
+		Description: "Release invalidates the handle, the func it holds can be collected afterwards.",
+		Source:      buf.String(),
+	})
+
+	buf = new(bytes.Buffer)
+	fmt.Fprintf(buf, "func (h %s) Pointer() unsafe.Pointer {\n", handleName)
+	fmt.Fprintln(buf, "return C.cgo_handle_ptr(C.uintptr_t(h))\n}")
+	helpers = append(helpers, &Helper{
+		Name:        handleName + ".Pointer",
+		Description: "Pointer returns the user data value that identifies the handle on the C side.",
+		Source:      buf.String(),
+	})
+
+	buf = new(bytes.Buffer)
+	fmt.Fprintf(buf, "func (h %s) PassRef() (ref *%s, allocs *cgoAllocMap) {\n", handleName, cgoSpec)
+	fmt.Fprintf(buf, "return (*%s)(C.%s), nil\n}", cgoSpec, cbCName)
+	helpers = append(helpers, &Helper{
+		Name:        handleName + ".PassRef",
+		Description: "PassRef returns the C proxy of the callback that is paired with the handle.",
+		Source:      buf.String(),
+	})
+	if spec.GetPointers() > 0 {
+		buf = new(bytes.Buffer)
+		fmt.Fprintf(buf, "func (h %s) PassValue() (ref %s, allocs *cgoAllocMap) {\n", handleName, cgoSpec)
+		fmt.Fprintf(buf, "return (%s)(C.%s), nil\n}", cgoSpec, cbCName)
+		helpers = append(helpers, &Helper{
+			Name:        handleName + ".PassValue",
+			Description: "PassValue returns the C proxy of the callback that is paired with the handle.",
+			Source:      buf.String(),
+		})
+	}
+	return helpers
+}
+
+// userDataPairs maps the user data parameters of a function to the callback parameters
+// they are passed along with, the nearest preceding callback is preferred.
+func (gen *Generator) userDataPairs(funcName string, spec *tl.CFunctionSpec) map[int]int {
+	ptrTipRx, ok := gen.tr.PtrTipRx(tl.TipScopeFunction, funcName)
+	if !ok {
+		return nil
+	}
+	var pairs map[int]int
+	for i := range spec.Params {
+		if ptrTipRx.TipAt(i) != tl.TipPtrUserData {
+			continue
+		}
+		j := -1
+		for k := i - 1; k >= 0 && j < 0; k-- {
+			if gen.isUserDataCallback(spec.Params[k]) {
+				j = k
+			}
+		}
+		for k := i + 1; k < len(spec.Params) && j < 0; k++ {
+			if gen.isUserDataCallback(spec.Params[k]) {
+				j = k
+			}
+		}
+		if j < 0 {
+			continue
+		}
+		if pairs == nil {
+			pairs = make(map[int]int)
+		}
+		pairs[i] = j
+	}
+	return pairs
+}
+
+func (gen *Generator) isUserDataCallback(param *tl.CDecl) bool {
+	spec, ok := param.Spec.(*tl.CFunctionSpec)
+	if !ok || len(spec.Typedef) == 0 {
+		return false
+	}
+	return gen.callbackUserData(spec.Typedef, spec) >= 0
+}
+
+// callbackHandleName returns the name of the handle type for a callback parameter.
+func (gen *Generator) callbackHandleName(param *tl.CDecl) string {
+	spec := param.Spec.(*tl.CFunctionSpec)
+	return string(checkName(gen.tr.TransformName(tl.TargetType, spec.Typedef, true))) + "Handle"
+}
+
+var cgoHandleValue = &Helper{
+	Name: "cgoHandleValue",
+	Description: "cgoHandleValue returns the value of the handle passed as user data, or nil if there's\n" +
+		"no such handle, as a callback must not panic when C calls it after the handle is released.",
+	Source: `func cgoHandleValue(h uintptr) (v interface{}) {
+	if h == 0 {
+		return nil
+	}
+	defer func() {
+		if recover() != nil {
+			v = nil
+		}
+	}()
+	return cgo.Handle(h).Value()
+}`,
+}
+
+var cgoHandlePtr = &Helper{
+	Name:        "cgo_handle_ptr",
+	Description: "cgo_handle_ptr converts a cgo.Handle into the user data pointer of a callback.",
+	Source: `#include <stdint.h>
+void* cgo_handle_ptr(uintptr_t h);`,
+	Side:     CHSide,
+	Requires: Helpers{cgoHandlePtrDef},
+}
+
+var cgoHandlePtrDef = &Helper{
+	Name: "cgo_handle_ptr",
+	Source: `void* cgo_handle_ptr(uintptr_t h) {
+	return (void*)h;
+}`,
+	Side: CCSide,
+}
+
+func isPaired(pairs map[int]int, i int) bool {
+	for _, j := range pairs {
+		if j == i {
+			return true
+		}
+	}
+	return false
+}
@@ -54,6 +54,13 @@ func (gen *Generator) writeStructMembers(wr io.Writer, structName string, spec t
 			ptrTip = tl.TipPtrSRef
 		}
 		declName := checkName(gen.tr.TransformName(tl.TargetType, member.Name, public))
+		writeMemberDoc(wr, member.Doc)
+		if member.BitField != nil {
+			goSpec := gen.tr.TranslateSpec(member.Spec, ptrTip, typeTip)
+			fmt.Fprintf(wr, "%s %s", bitFieldName(string(declName)), goSpec)
+			writeSpace(wr, 1)
+			continue
+		}
 		switch member.Spec.Kind() {
 		case tl.TypeKind:
 			goSpec := gen.tr.TranslateSpec(member.Spec, ptrTip, typeTip)
@@ -94,6 +101,10 @@ func (gen *Generator) writeInstanceObjectParam(wr io.Writer, funcName string, fu
 	ptrTipSpecRx, _ := gen.tr.PtrTipRx(tl.TipScopeFunction, funcName)
 	typeTipSpecRx, _ := gen.tr.TypeTipRx(tl.TipScopeFunction, funcName)
 
+	if m, ok := gen.methodOf(funcName); ok {
+		fmt.Fprintf(wr, " (%s *%s)", gen.receiverName(spec, m), m.Receiver)
+		return
+	}
 	for i, param := range spec.Params {
 		ptrTip := ptrTipSpecRx.TipAt(i)
 
@@ -153,11 +164,68 @@ func (gen *Generator) writeFunctionParams(wr io.Writer, funcName string, funcSpe
 	ptrTipSpecRx, _ := gen.tr.PtrTipRx(tl.TipScopeFunction, funcName)
 	typeTipSpecRx, _ := gen.tr.TypeTipRx(tl.TipScopeFunction, funcName)
 
+	outs := make(map[int]outParam)
+	for _, out := range gen.outParams(funcName, spec) {
+		outs[out.Index] = out
+	}
+	slicePairs, _ := gen.slicePairs(funcName, spec)
+	userDataPairs := gen.userDataPairs(funcName, spec)
+	userDataCallbacks := make(map[int]bool, len(userDataPairs))
+	for _, j := range userDataPairs {
+		userDataCallbacks[j] = true
+	}
+	_, isMethod := gen.methodOf(funcName)
+
+	var written int
 	writeStartParams(wr)
 	for i, param := range spec.Params {
 		ptrTip := ptrTipSpecRx.TipAt(i)
 
-		if ptrTip == tl.TipPtrInst {
+		if ptrTip == tl.TipPtrInst || userDataCallbacks[i] || (isMethod && i == 0) {
+			continue
+		}
+		if out, ok := outs[i]; ok {
+			if !out.InOut {
+				// returned as a result
+				continue
+			}
+			if written > 0 {
+				fmt.Fprintf(wr, ", ")
+			}
+			written++
+			const public = false
+			declName := checkName(gen.tr.TransformName(tl.TargetType, param.Name, public))
+			fmt.Fprintf(wr, "%s %s", declName, out.GoSpec)
+			continue
+		}
+		if pair, ok := pairByLen(slicePairs, i); ok {
+			if !pair.Out {
+				// taken from the length of the slice
+				continue
+			}
+			if written > 0 {
+				fmt.Fprintf(wr, ", ")
+			}
+			written++
+			fmt.Fprintf(wr, "%s int", gen.capacityName(param))
+			continue
+		}
+		if _, ok := pairByPtr(slicePairs, i); ok {
+			ptrTip = tl.TipPtrArr
+		}
+		if ptrTip == tl.TipPtrUserData {
+			j, ok := userDataPairs[i]
+			if !ok {
+				// the user data of a callback is hidden from its Go func
+				continue
+			}
+			if written > 0 {
+				fmt.Fprintf(wr, ", ")
+			}
+			written++
+			const public = false
+			declName := checkName(gen.tr.TransformName(tl.TargetType, param.Name, public))
+			fmt.Fprintf(wr, "%s %s", declName, gen.callbackHandleName(spec.Params[j]))
 			continue
 		}
 
@@ -175,11 +243,11 @@ func (gen *Generator) writeFunctionParams(wr io.Writer, funcName string, funcSpe
 			}
 		}
 
-		gen.writeFunctionParam(wr, param, ptrTip, typeTip)
-
-		if i < len(spec.Params)-1 && ptrTipSpecRx.TipAt(i+1) != tl.TipPtrInst {
+		if written > 0 {
 			fmt.Fprintf(wr, ", ")
 		}
+		written++
+		gen.writeFunctionParam(wr, param, ptrTip, typeTip)
 	}
 	writeEndParams(wr)
 }
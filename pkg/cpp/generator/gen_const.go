@@ -41,6 +41,7 @@ func (gen *Generator) writeDefinesGroup(wr io.Writer, defines []*tl.CDecl) (n in
 		}
 		fmt.Fprintf(wr, "// %s as defined in %s\n", name,
 			filepath.ToSlash(gen.tr.SrcLocation(tl.TargetConst, decl.Name, decl.Pos)))
+		gen.writeDoc(wr, decl.Doc, nil)
 
 		if decl.Value != nil {
 			fmt.Fprintf(wr, "%s = %v", name, decl.Value)
@@ -64,6 +65,7 @@ func (gen *Generator) writeConstDeclaration(wr io.Writer, decl *tl.CDecl) {
 	}
 	fmt.Fprintf(wr, "// %s as declared in %s\n", declName,
 		filepath.ToSlash(gen.tr.SrcLocation(tl.TargetConst, decl.Name, decl.Pos)))
+	gen.writeDoc(wr, decl.Doc, nil)
 	goSpec := gen.tr.TranslateSpec(decl.Spec)
 
 	if decl.Value != nil {
@@ -91,6 +93,7 @@ func (gen *Generator) expandEnumAnonymous(wr io.Writer, decl *tl.CDecl, namesSee
 		enumType := gen.tr.TranslateSpec(&spec.Type)
 		fmt.Fprintf(wr, "// %s as declared in %s\n", typeName,
 			filepath.ToSlash(gen.tr.SrcLocation(tl.TargetConst, decl.Name, decl.Pos)))
+		gen.writeDoc(wr, decl.Doc, nil)
 		fmt.Fprintf(wr, "type %s %s\n", typeName, enumType)
 		writeSpace(wr, 1)
 		fmt.Fprintf(wr, "// %s enumeration from %s\n", typeName,
@@ -112,6 +115,9 @@ func (gen *Generator) expandEnumAnonymous(wr io.Writer, decl *tl.CDecl, namesSee
 		if !hasType {
 			fmt.Fprintf(wr, "// %s as declared in %s\n", mName,
 				filepath.ToSlash(gen.tr.SrcLocation(tl.TargetConst, m.Name, m.Pos)))
+			gen.writeDoc(wr, m.Doc, nil)
+		} else {
+			writeMemberDoc(wr, m.Doc)
 		}
 		switch {
 		case m.Value != nil:
@@ -154,6 +160,7 @@ func (gen *Generator) expandEnum(wr io.Writer, decl *tl.CDecl, namesSeen map[str
 	enumType := gen.tr.TranslateSpec(&spec.Type)
 	fmt.Fprintf(wr, "// %s as declared in %s\n", tagName,
 		filepath.ToSlash(gen.tr.SrcLocation(tl.TargetConst, decl.Name, decl.Pos)))
+	gen.writeDoc(wr, decl.Doc, nil)
 	fmt.Fprintf(wr, "type %s %s\n", tagName, enumType)
 	writeSpace(wr, 1)
 	if isTypedef {
@@ -181,6 +188,7 @@ func (gen *Generator) expandEnum(wr io.Writer, decl *tl.CDecl, namesSeen map[str
 		} else {
 			namesSeen[string(mName)] = true
 		}
+		writeMemberDoc(wr, m.Doc)
 		switch {
 		case m.Value != nil:
 			fmt.Fprintf(wr, "%s %s = %v\n", mName, declName, iotaOnZero(i, m.Value))
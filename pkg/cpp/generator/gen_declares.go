@@ -25,6 +25,7 @@ import (
 	"io"
 	"path/filepath"
 
+	"github.com/bhojpur/build/pkg/cpp/diag"
 	tl "github.com/bhojpur/build/pkg/cpp/translator"
 )
 
@@ -97,20 +98,47 @@ func (gen *Generator) writeFunctionDeclaration(wr io.Writer, decl *tl.CDecl,
 	if spec.Return != nil {
 		returnRef = gen.tr.TranslateSpec(spec.Return, ptrTip, typeTip).String()
 	}
+	_, errno := gen.errnoTip(decl.Name)
+	withError := errno
+	if _, ok := gen.tr.ErrorRule(decl.Name); ok {
+		if rule, applies := gen.errorRule(decl); errno {
+			gen.warn(decl.Pos, diag.CodeErrorRule, "%s: error rule ignored, errno is reported instead", decl.Name)
+		} else if applies && rule.KeepsValue() {
+			withError = true
+		} else if applies {
+			returnRef = "error"
+		} else {
+			gen.warn(decl.Pos, diag.CodeErrorRule, "%s: error rule ignored, the function doesn't return a status code", decl.Name)
+		}
+	}
+	if h, ok := gen.handleConstructor(decl); ok {
+		returnRef = "*" + h.Name
+	} else if owned, ok := gen.ownedReturn(decl); ok {
+		returnRef = owned.GoType
+	} else if ptrTip, _ := gen.tr.PtrTipRx(tl.TipScopeFunction, decl.Name); ptrTip.Self() == tl.TipPtrOwned {
+		gen.warn(decl.Pos, diag.CodeOwnedTip, "%s: owned tip ignored, only strings and struct pointers can be freed"+
+			" (char * is a string with the string type tip)", decl.Name)
+	}
+	_, invalidSlices := gen.slicePairs(decl.Name, spec)
+	for _, tip := range invalidSlices {
+		gen.warn(decl.Pos, diag.CodeSliceTip, "%s: slice tip {ptr: %s, len: %s} ignored, it must link a pointer and an integer param",
+			decl.Name, tip.Ptr, tip.Len)
+	}
 	cName, _ := getName(decl)
 	goName := checkName(gen.tr.TransformName(tl.TargetFunction, cName, public))
-	if returnRef == string(goName) {
+	if m, ok := gen.methodOf(decl.Name); ok {
+		goName = []byte(m.Name)
+	} else if returnRef == string(goName) {
 		goName = gen.tr.TransformName(tl.TargetFunction, "new_"+cName, public)
 	}
 	fmt.Fprintf(wr, "// %s function as declared in %s\n", goName,
 		filepath.ToSlash(gen.tr.SrcLocation(tl.TargetFunction, decl.Name, decl.Pos)))
+	gen.writeDoc(wr, decl.Doc, spec.Params)
 	fmt.Fprintf(wr, "func")
 	gen.writeInstanceObjectParam(wr, cName, decl.Spec)
 	fmt.Fprintf(wr, " %s", goName)
 	gen.writeFunctionParams(wr, cName, decl.Spec)
-	if len(returnRef) > 0 {
-		fmt.Fprintf(wr, " %s", returnRef)
-	}
+	gen.writeFunctionResults(wr, gen.outParams(cName, spec), returnRef, withError)
 	gen.writeFunctionBody(wr, decl)
 	writeSpace(wr, 1)
 }
@@ -155,6 +183,11 @@ func (gen *Generator) writeStructDeclaration(wr io.Writer, decl *tl.CDecl,
 	if tag := decl.Spec.GetBase(); len(tag) > 0 {
 		goSpec := gen.tr.TranslateSpec(decl.Spec, ptrTip, typeTip)
 		if string(goName) != goSpec.String() {
+			if !decl.Doc.IsEmpty() {
+				fmt.Fprintf(wr, "// %s as declared in %s\n", goName,
+					filepath.ToSlash(gen.tr.SrcLocation(tl.TargetType, cName, decl.Pos)))
+				gen.writeDoc(wr, decl.Doc, nil)
+			}
 			fmt.Fprintf(wr, "var %s %s", goName, goSpec)
 		}
 		return
@@ -163,6 +196,11 @@ func (gen *Generator) writeStructDeclaration(wr io.Writer, decl *tl.CDecl,
 		return
 	}
 
+	if !decl.Doc.IsEmpty() {
+		fmt.Fprintf(wr, "// %s as declared in %s\n", goName,
+			filepath.ToSlash(gen.tr.SrcLocation(tl.TargetType, cName, decl.Pos)))
+		gen.writeDoc(wr, decl.Doc, nil)
+	}
 	fmt.Fprintf(wr, "var %s struct {", goName)
 	writeSpace(wr, 1)
 	gen.submitHelper(cgoAllocMap)
@@ -0,0 +1,149 @@
+package generator
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	tl "github.com/bhojpur/build/pkg/cpp/translator"
+)
+
+// writeDocLines writes the text as comment lines, empty lines become paragraph breaks.
+func writeDocLines(wr io.Writer, text string) {
+	for _, line := range strings.Split(text, "\n") {
+		if len(line) == 0 {
+			fmt.Fprintln(wr, "//")
+			continue
+		}
+		fmt.Fprintf(wr, "// %s\n", line)
+	}
+}
+
+// writeDoc writes the doc comment of a declaration translated into Go doc form.
+// It follows the line referencing the declaration, so every section is a new paragraph.
+func (gen *Generator) writeDoc(wr io.Writer, doc *tl.CDoc, params []*tl.CDecl) {
+	if doc == nil {
+		// parameters may still be documented on their own
+		doc = &tl.CDoc{}
+	}
+	if len(doc.Text) > 0 {
+		fmt.Fprintln(wr, "//")
+		writeDocLines(wr, doc.Text)
+	}
+	gen.writeParamsDoc(wr, doc, params)
+	if len(doc.Return) > 0 {
+		fmt.Fprintln(wr, "//")
+		ret := doc.Return
+		if lower := strings.ToLower(ret); strings.HasPrefix(lower, "returns ") {
+			ret = ret[len("returns "):]
+		}
+		writeDocLines(wr, "Returns "+lowerFirstWord(ret))
+	}
+	for _, note := range doc.Notes {
+		fmt.Fprintln(wr, "//")
+		writeDocLines(wr, strings.TrimSpace(note.Title+": "+note.Text))
+	}
+	writeDeprecatedDoc(wr, doc)
+}
+
+func (gen *Generator) writeParamsDoc(wr io.Writer, doc *tl.CDoc, params []*tl.CDecl) {
+	const public = false
+	var items []string
+	documented := make(map[string]bool, len(params))
+	for _, param := range params {
+		text, ok := doc.ParamDoc(param.Name)
+		if !ok && !param.Doc.IsEmpty() {
+			text, ok = param.Doc.Text, true
+		}
+		if !ok {
+			continue
+		}
+		documented[param.Name] = true
+		goName := checkName(gen.tr.TransformName(tl.TargetType, param.Name, public))
+		items = append(items, fmt.Sprintf("  - %s: %s", goName, text))
+	}
+	for _, p := range doc.Params {
+		if !documented[p.Name] {
+			// not in the signature, but still worth mentioning
+			items = append(items, fmt.Sprintf("  - %s: %s", p.Name, p.Text))
+		}
+	}
+	if len(items) == 0 {
+		return
+	}
+	fmt.Fprintln(wr, "//")
+	fmt.Fprintln(wr, "// Parameters:")
+	for _, item := range items {
+		writeDocLines(wr, strings.Replace(item, "\n", "\n    ", -1))
+	}
+}
+
+// writeMemberDoc writes the doc comment of a struct member or enum constant,
+// there is no reference line so the doc goes first.
+func writeMemberDoc(wr io.Writer, doc *tl.CDoc) {
+	if doc.IsEmpty() {
+		return
+	}
+	if len(doc.Text) > 0 {
+		writeDocLines(wr, doc.Text)
+	}
+	for _, note := range doc.Notes {
+		writeDocLines(wr, strings.TrimSpace(note.Title+": "+note.Text))
+	}
+	if len(doc.Text) > 0 || len(doc.Notes) > 0 {
+		writeDeprecatedDoc(wr, doc)
+		return
+	}
+	if doc.IsDeprecated {
+		writeDocLines(wr, "Deprecated: "+deprecatedText(doc))
+	}
+}
+
+func writeDeprecatedDoc(wr io.Writer, doc *tl.CDoc) {
+	if !doc.IsDeprecated {
+		return
+	}
+	fmt.Fprintln(wr, "//")
+	writeDocLines(wr, "Deprecated: "+deprecatedText(doc))
+}
+
+func deprecatedText(doc *tl.CDoc) string {
+	if len(doc.Deprecated) > 0 {
+		return doc.Deprecated
+	}
+	return "do not use in new code."
+}
+
+// lowerFirstWord lowers the first letter unless the word looks like an acronym.
+func lowerFirstWord(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	if !unicode.IsUpper(r) {
+		return s
+	}
+	if next, _ := utf8.DecodeRuneInString(s[n:]); unicode.IsUpper(next) {
+		return s
+	}
+	return string(unicode.ToLower(r)) + s[n:]
+}
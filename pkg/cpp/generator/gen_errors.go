@@ -0,0 +1,119 @@
+package generator
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	tl "github.com/bhojpur/build/pkg/cpp/translator"
+)
+
+// errorRule returns the error rule for a function, the rules apply
+// only to the functions that return integer status codes or enums.
+func (gen *Generator) errorRule(decl *tl.CDecl) (tl.ErrorRuleRx, bool) {
+	spec := decl.Spec.(*tl.CFunctionSpec)
+	if spec.Return == nil {
+		return tl.ErrorRuleRx{}, false
+	}
+	rule, ok := gen.tr.ErrorRule(decl.Name)
+	if !ok {
+		return tl.ErrorRuleRx{}, false
+	}
+	ret := spec.Return
+	if ret.GetPointers() > 0 || len(ret.OuterArrays())+len(ret.InnerArrays()) > 0 {
+		return tl.ErrorRuleRx{}, false
+	}
+	switch ret.Kind() {
+	case tl.TypeKind, tl.EnumKind:
+		return rule, true
+	default:
+		return tl.ErrorRuleRx{}, false
+	}
+}
+
+// errorRuleValue returns the Go expression for the value of a success condition.
+func errorRuleValue(value string) string {
+	if len(value) > 0 && (value[0] == '-' || (value[0] >= '0' && value[0] <= '9')) {
+		return value
+	}
+	return "C." + value
+}
+
+func (gen *Generator) getErrorHelper(rule tl.ErrorRuleRx) *Helper {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "type %s int\n\n", rule.Type)
+	fmt.Fprintf(buf, "func (e %s) Error() string {\n", rule.Type)
+	if len(rule.Message) > 0 {
+		codeSpec := "C.int"
+		for _, decl := range gen.tr.Declares() {
+			spec, ok := decl.Spec.(*tl.CFunctionSpec)
+			if !ok || decl.Name != rule.Message || len(spec.Params) == 0 {
+				continue
+			}
+			codeSpec = gen.tr.CGoSpec(spec.Params[0].Spec, true).String()
+			break
+		}
+		fmt.Fprintf(buf, "return C.GoString(C.%s((%s)(e)))\n}", rule.Message, codeSpec)
+	} else {
+		fmt.Fprintf(buf, "return fmt.Sprintf(\"%s: error code %%d\", int(e))\n}", gen.pkg)
+	}
+	return &Helper{
+		Name: rule.Type,
+		Description: fmt.Sprintf("%s is the error of a function that returned a failure status code,\n"+
+			"the value is the code itself.", rule.Type),
+		Source: buf.String(),
+	}
+}
+
+// writeErrorReturn writes the check of the status code in __ret against the error rule,
+// the results hold the value as well if the rule keeps it.
+func (gen *Generator) writeErrorReturn(wr io.Writer, rule tl.ErrorRuleRx, results []string) []string {
+	gen.submitHelper(gen.getErrorHelper(rule))
+	okResults := append(results[:len(results):len(results)], "nil")
+	fmt.Fprintf(wr, "if __ret %s %s {\nreturn %s\n}\n", rule.Op,
+		errorRuleValue(rule.Value), strings.Join(okResults, ", "))
+	return append(results, fmt.Sprintf("%s(__ret)", rule.Type))
+}
+
+// errnoTip returns the ptr tips of a function if it reads errno using the two-value call.
+func (gen *Generator) errnoTip(funcName string) (tl.TipSpecRx, bool) {
+	ptrTipRx, ok := gen.tr.PtrTipRx(tl.TipScopeFunction, funcName)
+	if !ok || ptrTipRx.Self() != tl.TipPtrErrno {
+		return tl.TipSpecRx{}, false
+	}
+	return ptrTipRx, true
+}
+
+// writeErrnoReturn appends the errno error in __err to the results, if the failure
+// condition is set, errno is reported only when __ret matches the condition.
+func (gen *Generator) writeErrnoReturn(wr io.Writer, rx tl.TipSpecRx, hasRet bool, results []string) []string {
+	op, value, ok := rx.Failure()
+	if !ok || !hasRet {
+		return append(results, "__err")
+	}
+	errResults := append(results[:len(results):len(results)], "__err")
+	fmt.Fprintf(wr, "if __ret %s %s {\nreturn %s\n}\n", op,
+		errorRuleValue(value), strings.Join(errResults, ", "))
+	return append(results, "nil")
+}
@@ -25,6 +25,8 @@ import (
 	"io"
 	"strings"
 	"time"
+
+	"github.com/bhojpur/build/pkg/cpp/parser"
 )
 
 func genLabel(noTimestamps bool) string {
@@ -40,6 +42,28 @@ func genLabel(noTimestamps bool) string {
 	return fmt.Sprintf(tpl, time.Now().Format(time.RFC1123))
 }
 
+// writeTargetLabel reports the target the C types have been sized for,
+// or the list of targets when the output is shared between them.
+func (gen *Generator) writeTargetLabel(wr io.Writer) {
+	if len(gen.arches) > 0 {
+		writeTextBlock(wr, fmt.Sprintf("Targets: %s, declarations that differ between them are in types_<goarch>.go files.",
+			strings.Join(gen.arches, ", ")))
+		writeSpace(wr, 1)
+		return
+	}
+	gen.writeArchLabel(wr)
+}
+
+func (gen *Generator) writeArchLabel(wr io.Writer) {
+	model := gen.tr.TypeModel()
+	if model == nil {
+		return
+	}
+	writeTextBlock(wr, fmt.Sprintf("Target: %s, %s data model (long is %d-bit, pointers are %d-bit).",
+		gen.tr.Arch(), parser.DataModelOf(model), gen.tr.LongSize()*8, gen.tr.PointerSize()*8))
+	writeSpace(wr, 1)
+}
+
 func (gen *Generator) WriteDoc(wr io.Writer) bool {
 	var hasDoc bool
 	if len(gen.cfg.PackageLicense) > 0 {
@@ -49,6 +73,7 @@ func (gen *Generator) WriteDoc(wr io.Writer) bool {
 	}
 	writeTextBlock(wr, genLabel(gen.noTimestamps))
 	writeSpace(wr, 1)
+	gen.writeTargetLabel(wr)
 	if len(gen.cfg.PackageDescription) > 0 {
 		writeLongTextBlock(wr, gen.cfg.PackageDescription)
 		hasDoc = true
@@ -91,6 +116,7 @@ func (gen *Generator) writeGoHelpersHeader(wr io.Writer) {
 	writeSpace(wr, 1)
 	writeTextBlock(wr, genLabel(gen.noTimestamps))
 	writeSpace(wr, 1)
+	gen.writeTargetLabel(wr)
 	writePackageName(wr, gen.pkg)
 	writeSpace(wr, 1)
 	gen.WriteIncludes(wr)
@@ -121,6 +147,11 @@ func (gen *Generator) writeCCHelpersHeader(wr io.Writer) {
 	}
 	writeTextBlock(wr, genLabel(gen.noTimestamps))
 	writeSpace(wr, 1)
+	if gen.cfg.Options.LayoutTests {
+		fmt.Fprintln(wr, "#include <stddef.h>")
+		fmt.Fprintln(wr, "#include <stdint.h>")
+		fmt.Fprintln(wr, "#include <string.h>")
+	}
 	writeCGOIncludes(wr)
 	writeSpace(wr, 1)
 }
@@ -148,6 +179,22 @@ func (gen *Generator) WritePackageHeader(wr io.Writer) {
 	writeSpace(wr, 1)
 	writeTextBlock(wr, genLabel(gen.noTimestamps))
 	writeSpace(wr, 1)
+	gen.writeTargetLabel(wr)
+	writePackageName(wr, gen.pkg)
+	writeSpace(wr, 1)
+}
+
+// WriteArchPackageHeader starts a file that holds the declarations specific
+// to the target of the generator, the constraint terms are joined with AND.
+func (gen *Generator) WriteArchPackageHeader(wr io.Writer, constraint []string) {
+	fmt.Fprintf(wr, "//go:build %s\n", strings.Join(constraint, " && "))
+	fmt.Fprintf(wr, "// +build %s\n", strings.Join(constraint, ","))
+	writeSpace(wr, 1)
+	writeTextBlock(wr, gen.cfg.PackageLicense)
+	writeSpace(wr, 1)
+	writeTextBlock(wr, genLabel(gen.noTimestamps))
+	writeSpace(wr, 1)
+	gen.writeArchLabel(wr)
 	writePackageName(wr, gen.pkg)
 	writeSpace(wr, 1)
 }
@@ -0,0 +1,269 @@
+package generator
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bhojpur/build/pkg/cpp/diag"
+	tl "github.com/bhojpur/build/pkg/cpp/translator"
+)
+
+// handleType is an opaque C type bound as a Go handle.
+type handleType struct {
+	// Name is the Go handle type, CGoSpec is the pointer it holds.
+	Name       string
+	CGoSpec    string
+	Destructor string
+	Rx         tl.HandleRx
+}
+
+// handleOf returns the handle type for a pointer to an opaque type that matches a handle rule,
+// the types that have no destructor are not bound as handles.
+func (gen *Generator) handleOf(spec tl.CType) (*handleType, bool) {
+	if spec == nil || spec.GetPointers() != 1 {
+		return nil, false
+	}
+	goSpec := gen.tr.TranslateSpec(spec, tl.TipPtrRef)
+	if goSpec.Kind != tl.OpaqueStructKind || goSpec.Pointers != 1 || len(goSpec.Raw) == 0 ||
+		len(goSpec.OuterArr)+len(goSpec.InnerArr) > 0 {
+		return nil, false
+	}
+	if h, ok := gen.handles[goSpec.Raw]; ok {
+		return h, h != nil
+	}
+	rx, ok := gen.tr.HandleRx(spec.GetBase(), spec.GetTag())
+	if !ok {
+		gen.handles[goSpec.Raw] = nil
+		return nil, false
+	}
+	var destructors []string
+	for _, decl := range gen.tr.Declares() {
+		funcSpec, ok := decl.Spec.(*tl.CFunctionSpec)
+		if !ok || len(funcSpec.Params) != 1 || !rx.Destructor.MatchString(decl.Name) {
+			continue
+		}
+		paramSpec := gen.tr.TranslateSpec(funcSpec.Params[0].Spec, tl.TipPtrRef)
+		if paramSpec.Raw == goSpec.Raw && paramSpec.Pointers == 1 {
+			destructors = append(destructors, decl.Name)
+		}
+	}
+	switch {
+	case len(destructors) == 0:
+		gen.warn(gen.declPos(spec.GetBase()), diag.CodeHandle, "%s: no destructor matches %s, the type is not bound as a handle", spec.GetBase(), rx.Destructor)
+		gen.handles[goSpec.Raw] = nil
+		return nil, false
+	case len(destructors) > 1:
+		gen.warn(gen.declPos(spec.GetBase()), diag.CodeHandle, "%s: destructors %s match %s, using %s", spec.GetBase(),
+			strings.Join(destructors, ", "), rx.Destructor, destructors[0])
+	}
+	h := &handleType{
+		Name:       goSpec.Raw + "Handle",
+		CGoSpec:    gen.tr.CGoSpec(spec, false).String(),
+		Destructor: destructors[0],
+		Rx:         rx,
+	}
+	gen.handles[goSpec.Raw] = h
+	return h, true
+}
+
+// handleConstructor returns the handle created by a function, that is a function
+// matching the constructor rule and returning a pointer to the handle type.
+func (gen *Generator) handleConstructor(decl *tl.CDecl) (*handleType, bool) {
+	spec, ok := decl.Spec.(*tl.CFunctionSpec)
+	if !ok || spec.Return == nil {
+		return nil, false
+	}
+	h, ok := gen.handleOf(spec.Return)
+	if !ok || !h.Rx.Constructor.MatchString(decl.Name) {
+		return nil, false
+	}
+	return h, true
+}
+
+// handleMethod returns the handle a function is a method of, that is the handle
+// taken as the first param, the destructor is called by Close instead.
+func (gen *Generator) handleMethod(decl *tl.CDecl) (*handleType, bool) {
+	spec, ok := decl.Spec.(*tl.CFunctionSpec)
+	if !ok || len(spec.Params) == 0 {
+		return nil, false
+	}
+	h, ok := gen.handleOf(spec.Params[0].Spec)
+	if !ok || h.Destructor == decl.Name {
+		return nil, false
+	}
+	return h, true
+}
+
+// receiverName returns the name of the receiver in the methods, the name of the first param
+// is not used as it may shadow the C pseudo-package.
+func (gen *Generator) receiverName(spec *tl.CFunctionSpec, m *method) string {
+	name := "x"
+	if m.Handle != nil {
+		name = "h"
+	}
+	for {
+		var seen bool
+		for _, param := range spec.Params[1:] {
+			const public = false
+			if string(gen.tr.TransformName(tl.TargetType, param.Name, public)) == name {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			return name
+		}
+		name = "_" + name
+	}
+}
+
+// isHandleDestructor reports whether the function is the destructor of a handle.
+func (gen *Generator) isHandleDestructor(decl *tl.CDecl) bool {
+	spec, ok := decl.Spec.(*tl.CFunctionSpec)
+	if !ok || len(spec.Params) != 1 {
+		return false
+	}
+	h, ok := gen.handleOf(spec.Params[0].Spec)
+	return ok && h.Destructor == decl.Name
+}
+
+// useHandle submits the helpers that declare the handle type.
+func (gen *Generator) useHandle(h *handleType) {
+	for _, helper := range gen.getHandleHelpers(h) {
+		gen.submitHelper(helper)
+	}
+}
+
+// handleProxy wraps the reference returned by a constructor into __v.
+func (gen *Generator) handleProxy(h *handleType) string {
+	gen.useHandle(h)
+	return fmt.Sprintf("__v := new%s(__ret)", h.Name)
+}
+
+func (gen *Generator) getHandleHelpers(h *handleType) (helpers []*Helper) {
+	leakTag := gen.cfg.Options.HandleLeakTag
+	if len(leakTag) > 0 {
+		gen.handlesUsed = true
+	}
+	helpers = append(helpers, &Helper{
+		Name: h.Name,
+		Description: fmt.Sprintf("%s is a handle to %s created by C,\n"+
+			"it must be released by Close when no longer used.", h.Name, strings.TrimPrefix(h.CGoSpec, "*C.")),
+		Source: fmt.Sprintf(`type %s struct {
+			ref  %s
+			once sync.Once
+		}`, h.Name, h.CGoSpec),
+	})
+
+	var track, untrack string
+	if len(leakTag) > 0 {
+		track = fmt.Sprintf("trackHandle(h, %q)\n", h.Name)
+		untrack = "untrackHandle(h)\n"
+	}
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "func new%s(ref %s) *%s", h.Name, h.CGoSpec, h.Name)
+	fmt.Fprintf(buf, `{
+		if ref == nil {
+			return nil
+		}
+		h := &%s{ref: ref}
+		%sreturn h
+	}`, h.Name, track)
+	helpers = append(helpers, &Helper{
+		Name:        "new" + h.Name,
+		Description: fmt.Sprintf("new%s wraps the reference returned by a constructor, NULL gives nil.", h.Name),
+		Source:      buf.String(),
+	})
+
+	buf = new(bytes.Buffer)
+	fmt.Fprintf(buf, "func (h *%s) Ref() %s", h.Name, h.CGoSpec)
+	fmt.Fprint(buf, `{
+		if h == nil {
+			return nil
+		}
+		return h.ref
+	}`)
+	helpers = append(helpers, &Helper{
+		Name:        h.Name + ".Ref",
+		Description: "Ref returns the reference to C object, it's nil after Close.",
+		Source:      buf.String(),
+	})
+
+	buf = new(bytes.Buffer)
+	fmt.Fprintf(buf, "func (h *%s) Close()", h.Name)
+	fmt.Fprintf(buf, `{
+		if h == nil {
+			return
+		}
+		h.once.Do(func() {
+			%sC.%s(h.ref)
+			h.ref = nil
+		})
+	}`, untrack, h.Destructor)
+	helpers = append(helpers, &Helper{
+		Name: h.Name + ".Close",
+		Description: fmt.Sprintf("Close releases the handle using %s, the destructor is called once\n"+
+			"no matter how many times Close is called.", h.Destructor),
+		Source: buf.String(),
+	})
+	return helpers
+}
+
+// WriteHandleLeakCheck writes the hooks called by the handles when they're created and closed,
+// the enabled variant reports the handles garbage-collected without Close and is only built
+// with the tag set in HandleLeakTag, the other variant is a no-op.
+func (gen *Generator) WriteHandleLeakCheck(wr io.Writer, enabled bool) int {
+	tag := gen.cfg.Options.HandleLeakTag
+	if len(tag) == 0 || !gen.handlesUsed {
+		return 0
+	}
+	constraint := tag
+	if !enabled {
+		constraint = "!" + tag
+	}
+	fmt.Fprintf(wr, "//go:build %s\n", constraint)
+	fmt.Fprintf(wr, "// +build %s\n", constraint)
+	writeSpace(wr, 1)
+	gen.WritePackageHeader(wr)
+	if !enabled {
+		fmt.Fprintln(wr, "func trackHandle(h interface{}, name string) {}")
+		writeSpace(wr, 1)
+		fmt.Fprintln(wr, "func untrackHandle(h interface{}) {}")
+		return 2
+	}
+	io.WriteString(wr, `// trackHandle reports the handle if it's garbage-collected before Close is called.
+func trackHandle(h interface{}, name string) {
+	stack := debug.Stack()
+	runtime.SetFinalizer(h, func(interface{}) {
+		fmt.Fprintf(os.Stderr, "%s: handle garbage-collected without Close, created at:\n%s\n", name, stack)
+	})
+}`)
+	writeSpace(wr, 2)
+	fmt.Fprintln(wr, `// untrackHandle stops reporting the handle, it's called by Close.
+func untrackHandle(h interface{}) {
+	runtime.SetFinalizer(h, nil)
+}`)
+	return 2
+}
@@ -0,0 +1,255 @@
+package generator
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"io"
+	"strings"
+
+	tl "github.com/bhojpur/build/pkg/cpp/translator"
+)
+
+// layoutCheck pairs a C expression that measures the layout with the Go expression that must agree,
+// the C expression is evaluated after the Setup statements if there are any.
+type layoutCheck struct {
+	Label string
+	Setup string
+	C     string
+	Go    string
+}
+
+// cMemberName reverts the renaming of members that are Go keywords.
+func cMemberName(name string) string {
+	if strings.HasPrefix(name, "_") && token.Lookup(name[1:]).IsKeyword() {
+		return name[1:]
+	}
+	return name
+}
+
+// cStructTypeName returns the name of the struct as it's spelled in C.
+func cStructTypeName(decl *tl.CDecl) string {
+	if decl.IsTypedef && len(decl.Name) > 0 {
+		return decl.Name
+	}
+	return "struct " + decl.Spec.GetTag()
+}
+
+// getLayoutChecks lists the checks of a struct: the size, alignment and offsets of raw structs
+// that are C memory as is, the size and alignment of the Go types used for the members, and the
+// storage units the bitfields are accessed through. The wrapped structs are converted member by
+// member, so they only get the checks of the member types and bitfields.
+func (gen *Generator) getLayoutChecks(cType string, spec *tl.CStructSpec, raw bool) []layoutCheck {
+	var checks []layoutCheck
+	if raw {
+		checks = append(checks, layoutCheck{
+			Label: fmt.Sprintf("sizeof(%s)", cType),
+			C:     fmt.Sprintf("sizeof(%s)", cType),
+			Go:    "unsafe.Sizeof(x)",
+		}, layoutCheck{
+			Label: fmt.Sprintf("_Alignof(%s)", cType),
+			C:     fmt.Sprintf("_Alignof(%s)", cType),
+			Go:    "unsafe.Alignof(x)",
+		})
+	}
+	for _, m := range spec.Members {
+		if len(m.Name) == 0 {
+			continue
+		}
+		cName := cMemberName(m.Name)
+		if m.BitField != nil {
+			checks = append(checks, bitFieldLayoutChecks(cType, cName, m.BitField)...)
+			continue
+		}
+		if raw {
+			checks = append(checks, layoutCheck{
+				Label: fmt.Sprintf("offsetof(%s, %s)", cType, cName),
+				C:     fmt.Sprintf("offsetof(%s, %s)", cType, cName),
+				Go:    fmt.Sprintf("unsafe.Offsetof(x.%s)", m.Name),
+			})
+		}
+		switch m.Spec.Kind() {
+		case tl.TypeKind, tl.EnumKind:
+		default:
+			continue
+		}
+		if m.Spec.Kind() == tl.EnumKind && !gen.tr.IsAcceptableName(tl.TargetType, m.Spec.GetBase()) {
+			continue
+		}
+		goSpec := gen.tr.TranslateSpec(m.Spec, tl.TipPtrSRef)
+		if goSpec.Slices > 0 || goSpec.Base == "string" || goSpec.Base == "func" {
+			continue
+		}
+		member := fmt.Sprintf("((%s *)0)->%s", cType, cName)
+		checks = append(checks, layoutCheck{
+			Label: fmt.Sprintf("sizeof(%s.%s)", cType, cName),
+			C:     fmt.Sprintf("sizeof(%s)", member),
+			Go:    fmt.Sprintf("unsafe.Sizeof(*new(%s))", goSpec),
+		}, layoutCheck{
+			Label: fmt.Sprintf("_Alignof(%s.%s)", cType, cName),
+			C:     fmt.Sprintf("_Alignof(__typeof__(%s))", member),
+			Go:    fmt.Sprintf("unsafe.Alignof(*new(%s))", goSpec),
+		})
+	}
+	return checks
+}
+
+// bitFieldLayoutChecks sets all the bits of a bitfield in C and checks that they are the bits
+// of the storage unit the Go accessors use, and that no byte outside of the unit has changed.
+func bitFieldLayoutChecks(cType, cName string, bf *tl.CBitField) []layoutCheck {
+	unitType, _ := bitFieldUnitType(bf)
+	outside := fmt.Sprintf("i >= %d", bf.Offset+bf.Size)
+	if bf.Offset > 0 {
+		outside = fmt.Sprintf("(i < %d || %s)", bf.Offset, outside)
+	}
+	setup := fmt.Sprintf(`%s x;
+		%s_t unit;
+		size_t i, n = 0;
+		memset(&x, 0, sizeof(x));
+		x.%s = -1;
+		memcpy(&unit, (char *)&x + %d, sizeof(unit));
+		for (i = 0; i < sizeof(x); i++) {
+			if (%s && ((unsigned char *)&x)[i] != 0) {
+				n++;
+			}
+		}`, cType, unitType, cName, bf.Offset, outside)
+	return []layoutCheck{{
+		Label: fmt.Sprintf("%s.%s is bits %d-%d of the %d-byte unit at %d", cType, cName,
+			bf.Shift, bf.Shift+bf.Width-1, bf.Size, bf.Offset),
+		Setup: setup,
+		C:     fmt.Sprintf("unit == ((%s_t)%#xull << %d)", unitType, bf.Mask(), bf.Shift),
+		Go:    "1",
+	}, {
+		Label: fmt.Sprintf("%s.%s changes no byte outside of its unit", cType, cName),
+		Setup: setup,
+		C:     "n",
+		Go:    "0",
+	}}
+}
+
+// submitLayoutTest emits the C and Go helpers that report the layout of a struct
+// as the C compiler sees it, and adds a test comparing it to the Go side.
+func (gen *Generator) submitLayoutTest(goStructName []byte, decl *tl.CDecl, raw bool) {
+	spec, ok := decl.Spec.(*tl.CStructSpec)
+	if !ok || !spec.IsComplete() || spec.GetPointers() > 0 {
+		return
+	}
+	cType := cStructTypeName(decl)
+	checks := gen.getLayoutChecks(cType, spec, raw)
+	if len(checks) == 0 {
+		return
+	}
+	cFuncName := "cgo_layout_" + strings.Replace(cType, " ", "_", -1)
+	goFuncName := fmt.Sprintf("layoutOf%s", goStructName)
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "void %s(size_t *layout);", cFuncName)
+	gen.submitHelper(&Helper{
+		Name:   cFuncName,
+		Side:   CHSide,
+		Source: buf.String(),
+	})
+
+	buf.Reset()
+	fmt.Fprintf(buf, "void %s(size_t *layout) {\n", cFuncName)
+	for i, check := range checks {
+		if len(check.Setup) == 0 {
+			fmt.Fprintf(buf, "\tlayout[%d] = %s;\n", i, check.C)
+			continue
+		}
+		// the checks that follow the same setup share its block
+		if i == 0 || checks[i-1].Setup != check.Setup {
+			fmt.Fprintf(buf, "\t{\n\t\t%s\n", check.Setup)
+		}
+		fmt.Fprintf(buf, "\t\tlayout[%d] = %s;\n", i, check.C)
+		if i == len(checks)-1 || checks[i+1].Setup != check.Setup {
+			buf.WriteString("\t}\n")
+		}
+	}
+	buf.WriteString("}")
+	gen.submitHelper(&Helper{
+		Name:   cFuncName,
+		Side:   CCSide,
+		Source: buf.String(),
+	})
+
+	buf.Reset()
+	fmt.Fprintf(buf, "func %s() []uintptr {\n", goFuncName)
+	fmt.Fprintf(buf, "var layout [%d]C.size_t\n", len(checks))
+	fmt.Fprintf(buf, "C.%s(&layout[0])\n", cFuncName)
+	buf.WriteString(`values := make([]uintptr, len(layout))
+	for i := range layout {
+		values[i] = uintptr(layout[i])
+	}
+	return values
+	}`)
+	gen.submitHelper(&Helper{
+		Name: goFuncName,
+		Description: fmt.Sprintf("%s reports the layout of %s as the C compiler sees it,\n"+
+			"it's used by the generated layout tests.", goFuncName, cType),
+		Source: buf.String(),
+	})
+
+	buf.Reset()
+	fmt.Fprintf(buf, "func TestLayout%s(t *testing.T) {\n", goStructName)
+	if raw {
+		fmt.Fprintf(buf, "var x %s\n", goStructName)
+	}
+	fmt.Fprintf(buf, "checkLayout(t, %s(), []layoutCheck{\n", goFuncName)
+	for _, check := range checks {
+		fmt.Fprintf(buf, "{%q, %s},\n", check.Label, check.Go)
+	}
+	buf.WriteString("})\n}")
+	gen.layoutTests = append(gen.layoutTests, buf.String())
+}
+
+const layoutTestHelpers = `type layoutCheck struct {
+	what  string
+	value uintptr
+}
+
+// checkLayout compares the layout of Go types with the one reported by the C compiler.
+func checkLayout(t *testing.T, layout []uintptr, checks []layoutCheck) {
+	t.Helper()
+	for i, check := range checks {
+		if check.value != layout[i] {
+			t.Errorf("%s: Go has %d, C has %d", check.what, check.value, layout[i])
+		}
+	}
+}`
+
+// WriteLayoutTests writes the tests that verify the layout of generated structs against C,
+// it returns the number of tests written.
+func (gen *Generator) WriteLayoutTests(wr io.Writer) int {
+	if len(gen.layoutTests) == 0 {
+		return 0
+	}
+	gen.WritePackageHeader(wr)
+	writeSourceBlock(wr, layoutTestHelpers)
+	writeSpace(wr, 1)
+	for _, test := range gen.layoutTests {
+		writeSourceBlock(wr, test)
+		writeSpace(wr, 1)
+	}
+	return len(gen.layoutTests)
+}
@@ -0,0 +1,146 @@
+package generator
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	tl "github.com/bhojpur/build/pkg/cpp/translator"
+)
+
+// WriteMacros writes the Go functions translated from function-like macros.
+func (gen *Generator) WriteMacros(wr io.Writer) int {
+	var count int
+	seenNames := make(map[string]bool)
+	for _, m := range gen.tr.Macros() {
+		goName := string(gen.tr.TransformName(tl.TargetMacro, m.Name))
+		if len(goName) == 0 || seenNames[goName] {
+			continue
+		}
+		seenNames[goName] = true
+		gen.writeMacroFunc(wr, goName, m)
+		writeSpace(wr, 1)
+		count++
+	}
+	return count
+}
+
+func (gen *Generator) writeMacroFunc(wr io.Writer, goName string, m *tl.CMacro) {
+	fmt.Fprintf(wr, "// %s function as defined in %s\n", goName,
+		filepath.ToSlash(gen.tr.SrcLocation(tl.TargetMacro, m.Name, m.Pos)))
+	gen.writeDoc(wr, m.Doc, nil)
+	switch {
+	case m.IsGeneric():
+		gen.submitHelper(macroConstraints[m.Constraint])
+		result := "T"
+		if m.Result != nil {
+			result = m.Result.Go
+		}
+		fmt.Fprintf(wr, "func %s[T %s](%s) %s {\n", goName, m.Constraint, macroParams(m, "T"), result)
+		fmt.Fprintf(wr, "return %s\n", m.Expression)
+	case m.Shim:
+		gen.submitHelper(gen.getMacroShimHelper(m))
+		args := make([]string, 0, len(m.Params))
+		for i, name := range m.Params {
+			args = append(args, fmt.Sprintf("%s(%s)", m.ParamTypes[i].CGo, name))
+		}
+		call := fmt.Sprintf("C.%s(%s)", m.ShimName(), strings.Join(args, ", "))
+		if m.Result.IsVoid() {
+			fmt.Fprintf(wr, "func %s(%s) {\n", goName, macroParams(m, ""))
+			fmt.Fprintln(wr, call)
+			break
+		}
+		fmt.Fprintf(wr, "func %s(%s) %s {\n", goName, macroParams(m, ""), m.Result.Go)
+		fmt.Fprintf(wr, "__ret := %s\n", call)
+		fmt.Fprintf(wr, "return (%s)(__ret)\n", m.Result.Go)
+	default:
+		fmt.Fprintf(wr, "func %s(%s) %s {\n", goName, macroParams(m, ""), m.Result.Go)
+		fmt.Fprintf(wr, "return %s\n", m.Expression)
+	}
+	writeEndFuncBody(wr)
+}
+
+// macroParams returns the parameter list, typ is used for all parameters if set.
+func macroParams(m *tl.CMacro, typ string) string {
+	params := make([]string, 0, len(m.Params))
+	for i, name := range m.Params {
+		if len(typ) > 0 {
+			params = append(params, name+" "+typ)
+			continue
+		}
+		params = append(params, name+" "+m.ParamTypes[i].Go)
+	}
+	return strings.Join(params, ", ")
+}
+
+// getMacroShimHelper returns a static inline C function that wraps the macro,
+// so macros that have no Go equivalent remain callable via cgo.
+func (gen *Generator) getMacroShimHelper(m *tl.CMacro) *Helper {
+	params := make([]string, 0, len(m.Params))
+	for i, name := range m.Params {
+		params = append(params, m.ParamTypes[i].C+" "+name)
+	}
+	if len(params) == 0 {
+		params = append(params, "void")
+	}
+	buf := new(strings.Builder)
+	fmt.Fprintf(buf, "static inline %s %s(%s) {\n", m.Result.C, m.ShimName(), strings.Join(params, ", "))
+	call := fmt.Sprintf("%s(%s)", m.Name, strings.Join(m.Params, ", "))
+	if m.Result.IsVoid() {
+		fmt.Fprintf(buf, "\t%s;\n", call)
+	} else {
+		fmt.Fprintf(buf, "\treturn %s;\n", call)
+	}
+	buf.WriteString("}")
+	return &Helper{
+		Name:        m.ShimName(),
+		Description: fmt.Sprintf("%s wraps the %s macro so it can be called from Go.", m.ShimName(), m.Name),
+		Source:      buf.String(),
+		Side:        CHSide,
+	}
+}
+
+var macroConstraints = map[string]*Helper{
+	tl.MacroConstraintInteger: {
+		Name:        tl.MacroConstraintInteger,
+		Description: "cgoInteger is the type set of generic functions translated from macros with integer operations.",
+		Source: `type cgoInteger interface {
+			~int | ~int32 | ~int64 | ~uint | ~uint32 | ~uint64 | ~uintptr
+		}`,
+	},
+	tl.MacroConstraintFloat: {
+		Name:        tl.MacroConstraintFloat,
+		Description: "cgoFloat is the type set of generic functions translated from macros with floating-point constants.",
+		Source: `type cgoFloat interface {
+			~float32 | ~float64
+		}`,
+	},
+	tl.MacroConstraintNumber: {
+		Name:        tl.MacroConstraintNumber,
+		Description: "cgoNumber is the type set of generic functions translated from arithmetic macros.",
+		Source: `type cgoNumber interface {
+			~int | ~int32 | ~int64 | ~uint | ~uint32 | ~uint64 | ~uintptr | ~float32 | ~float64
+		}`,
+	},
+}
@@ -0,0 +1,284 @@
+package generator
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/bhojpur/build/pkg/cpp/diag"
+	tl "github.com/bhojpur/build/pkg/cpp/translator"
+)
+
+// method is a function bound as a method of the Go type its first param points to.
+type method struct {
+	// Func is the C name of the function.
+	Func string
+	// Receiver is the Go type the method is declared on, Name is the method name.
+	Receiver string
+	Name     string
+	Handle   *handleType
+}
+
+// methodSet holds the functions bound as methods, the ones that have been
+// kept as functions are listed in skipped along with the reason.
+type methodSet struct {
+	methods map[string]*method
+	skipped map[string]string
+}
+
+// methodOf returns the method a function is bound as.
+func (gen *Generator) methodOf(funcName string) (*method, bool) {
+	m, ok := gen.methodSet().methods[funcName]
+	return m, ok
+}
+
+// methodSet collects the methods of handles and the methods matched by the method rules,
+// in the order of declaration, so the first of the functions that map to the same method wins.
+func (gen *Generator) methodSet() *methodSet {
+	if gen.methods != nil {
+		return gen.methods
+	}
+	set := &methodSet{
+		methods: make(map[string]*method),
+		skipped: make(map[string]string),
+	}
+	gen.methods = set
+
+	var funcs declList
+	for _, decl := range gen.tr.Declares() {
+		if decl.Spec.Kind() == tl.FunctionKind && gen.tr.IsAcceptableName(tl.TargetFunction, decl.Name) {
+			funcs = append(funcs, decl)
+		}
+	}
+	sort.Stable(funcs)
+	taken := make(map[string]map[string]string)
+	for _, decl := range funcs {
+		m, ok := gen.methodCandidate(decl)
+		if !ok {
+			continue
+		}
+		names, ok := taken[m.Receiver]
+		if !ok {
+			names = gen.reservedMethods(m)
+			taken[m.Receiver] = names
+		}
+		if owner, ok := names[m.Name]; ok {
+			reason := fmt.Sprintf("%s collides with %s of %s", m.Name, owner, m.Receiver)
+			gen.warn(decl.Pos, diag.CodeMethodCollision, "%s: kept as a function, %s", decl.Name, reason)
+			set.skipped[decl.Name] = reason
+			continue
+		}
+		names[m.Name] = decl.Name
+		set.methods[decl.Name] = m
+	}
+	return set
+}
+
+// methodCandidate returns the method a function would be bound as, the functions that
+// take a handle as the first param are always its methods, the ones matching a method rule
+// are the methods of the struct their first param points to.
+func (gen *Generator) methodCandidate(decl *tl.CDecl) (*method, bool) {
+	spec := decl.Spec.(*tl.CFunctionSpec)
+	if len(spec.Params) == 0 || gen.isHandleDestructor(decl) {
+		return nil, false
+	}
+	const public = true
+	goName := string(gen.tr.TransformName(tl.TargetFunction, decl.Name, public))
+	rx, hasRule := gen.tr.MethodRx(decl.Name)
+	if h, ok := gen.handleMethod(decl); ok {
+		m := &method{
+			Func:     decl.Name,
+			Receiver: h.Name,
+			Name:     goName,
+			Handle:   h,
+		}
+		if hasRule {
+			if verb, ok := gen.methodName(decl.Name, rx, spec.Params[0].Spec); ok {
+				m.Name = verb
+			}
+		}
+		return m, true
+	}
+	if !hasRule || !gen.isMethodParam(decl, spec) {
+		return nil, false
+	}
+	verb, ok := gen.methodName(decl.Name, rx, spec.Params[0].Spec)
+	if !ok {
+		return nil, false
+	}
+	goSpec := gen.tr.TranslateSpec(spec.Params[0].Spec, tl.TipPtrRef)
+	return &method{
+		Func:     decl.Name,
+		Receiver: goSpec.Raw,
+		Name:     verb,
+	}, true
+}
+
+// isMethodParam reports whether the first param of a function is a pointer to a known struct
+// that isn't bound in a special way by the tips.
+func (gen *Generator) isMethodParam(decl *tl.CDecl, spec *tl.CFunctionSpec) bool {
+	param := spec.Params[0]
+	goSpec := gen.tr.TranslateSpec(param.Spec, tl.TipPtrRef)
+	if goSpec.Pointers != 1 || len(goSpec.Raw) == 0 || len(goSpec.OuterArr)+len(goSpec.InnerArr) > 0 {
+		return false
+	}
+	switch goSpec.Kind {
+	case tl.StructKind, tl.OpaqueStructKind:
+	default:
+		return false
+	}
+	if !gen.tr.IsAcceptableName(tl.TargetType, param.Spec.GetBase()) {
+		return false
+	}
+	ptrTipRx, _ := gen.tr.PtrTipRx(tl.TipScopeFunction, decl.Name)
+	switch ptrTipRx.TipAt(0) {
+	case tl.NoTip, tl.TipPtrRef, tl.TipPtrSRef, tl.TipPtrInst:
+	default:
+		return false
+	}
+	for _, out := range gen.outParams(decl.Name, spec) {
+		if out.Index == 0 {
+			return false
+		}
+	}
+	pairs, _ := gen.slicePairs(decl.Name, spec)
+	if _, ok := pairByPtr(pairs, 0); ok {
+		return false
+	}
+	return true
+}
+
+// methodName returns the Go name of the verb in prefix_<type>_<verb>, where type is
+// the name or the tag of the type pointed to, with or without the _t suffix.
+func (gen *Generator) methodName(funcName string, rx tl.MethodRx, typeSpec tl.CType) (string, bool) {
+	if !strings.HasPrefix(funcName, rx.Prefix) {
+		return "", false
+	}
+	rest := funcName[len(rx.Prefix):]
+	var typeName string
+	for _, name := range []string{typeSpec.GetBase(), typeSpec.GetTag()} {
+		name = strings.TrimPrefix(name, rx.Prefix)
+		for _, name := range []string{name, strings.TrimSuffix(name, "_t")} {
+			if len(name) > len(typeName) && len(rest) > len(name)+1 && strings.HasPrefix(rest, name+"_") {
+				typeName = name
+			}
+		}
+	}
+	if len(typeName) == 0 {
+		return "", false
+	}
+	const public = true
+	verb := rest[len(typeName)+1:]
+	goName := string(gen.tr.TransformName(tl.TargetFunction, funcName, public))
+	goPrefix := string(gen.tr.TransformName(tl.TargetFunction, funcName[:len(funcName)-len(verb)-1], public))
+	if strings.HasPrefix(goName, goPrefix) && len(goName) > len(goPrefix) {
+		verb = goName[len(goPrefix):]
+	} else {
+		verb = camelCase(verb)
+	}
+	if len(verb) == 0 || !isExportedName(verb) {
+		return "", false
+	}
+	return verb, true
+}
+
+// camelCase converts a snake_case name into an exported CamelCase name.
+func camelCase(name string) string {
+	parts := strings.Split(name, "_")
+	for i, part := range parts {
+		if len(part) > 0 {
+			parts[i] = strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+func isExportedName(name string) bool {
+	return name[0] >= 'A' && name[0] <= 'Z'
+}
+
+// reservedMethods returns the names a method of the receiver must not take, that is
+// the names of the helper methods and the fields and accessors of structs.
+func (gen *Generator) reservedMethods(m *method) map[string]string {
+	names := make(map[string]string)
+	if m.Handle != nil {
+		names["Ref"] = "a helper method"
+		names["Close"] = "a helper method"
+		return names
+	}
+	for name := range reservedStructMethods {
+		names[name] = "a helper method"
+	}
+	const public = true
+	for _, member := range gen.structMembers(m.Receiver) {
+		if len(member.Name) == 0 {
+			continue
+		}
+		goName := string(gen.tr.TransformName(tl.TargetType, member.Name, public))
+		names[goName] = "a field"
+		if member.BitField != nil {
+			names["Set"+goName] = "a bitfield accessor"
+		} else if gen.cfg.Options.StructAccessors {
+			names["Get"+goName] = "a field accessor"
+		}
+	}
+	return names
+}
+
+// structMembers returns the members of the struct translated as goName.
+func (gen *Generator) structMembers(goName string) []*tl.CDecl {
+	for _, decl := range gen.tr.Typedefs() {
+		if spec, ok := decl.Spec.(*tl.CStructSpec); ok {
+			if gen.tr.TranslateSpec(decl.Spec).Raw == goName {
+				return spec.Members
+			}
+		}
+	}
+	for _, def := range sortedTagDefs(gen.tr.TagMap()) {
+		if spec, ok := def.tagDecl.Spec.(*tl.CStructSpec); ok {
+			if gen.tr.TranslateSpec(def.tagDecl.Spec).Raw == goName {
+				return spec.Members
+			}
+		}
+	}
+	return nil
+}
+
+// WriteMethodReport lists the functions bound as methods and the ones kept as functions
+// because of a collision, it returns the number of lines written.
+func (gen *Generator) WriteMethodReport(wr io.Writer) int {
+	set := gen.methodSet()
+	lines := make([]string, 0, len(set.methods)+len(set.skipped))
+	for name, m := range set.methods {
+		lines = append(lines, fmt.Sprintf("%s: (*%s).%s", name, m.Receiver, m.Name))
+	}
+	for name, reason := range set.skipped {
+		lines = append(lines, fmt.Sprintf("%s: kept as a function, %s", name, reason))
+	}
+	sort.Strings(lines)
+	for _, line := range lines {
+		fmt.Fprintln(wr, line)
+	}
+	return len(lines)
+}
@@ -0,0 +1,173 @@
+package generator
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	tl "github.com/bhojpur/build/pkg/cpp/translator"
+)
+
+// outParam is a pointer parameter of a function that is returned to Go,
+// the storage it points to is allocated by the wrapper.
+type outParam struct {
+	Index   int
+	Name    string
+	InOut   bool
+	GoSpec  tl.GoTypeSpec
+	CGoSpec tl.CGoSpec
+	// Slice is set for the buffers that are bound with their length params.
+	Slice *slicePair
+}
+
+// outParams returns the pointer parameters of a function marked with the out and inout tips
+// and the out buffers linked to their lengths, the result names are chosen so that they
+// don't clash with the parameters.
+func (gen *Generator) outParams(funcName string, spec *tl.CFunctionSpec) []outParam {
+	ptrTipRx, ok := gen.tr.PtrTipRx(tl.TipScopeFunction, funcName)
+	if !ok {
+		return nil
+	}
+	typeTipRx, _ := gen.tr.TypeTipRx(tl.TipScopeFunction, funcName)
+	pairs, _ := gen.slicePairs(funcName, spec)
+	const public = false
+	names := make(map[string]bool, len(spec.Params))
+	for i, param := range spec.Params {
+		if pair, ok := pairByLen(pairs, i); ok && pair.Out {
+			names[gen.capacityName(param)] = true
+		} else if pair, ok := pairByPtr(pairs, i); ok && pair.Out {
+			continue
+		} else if ptrTipRx.TipAt(i) != tl.TipPtrOut || param.Spec.GetPointers() == 0 {
+			names[string(checkName(gen.tr.TransformName(tl.TargetType, param.Name, public)))] = true
+		}
+	}
+	var outs []outParam
+	for i, param := range spec.Params {
+		pair, isSlice := pairByPtr(pairs, i)
+		isSlice = isSlice && pair.Out
+		tip := ptrTipRx.TipAt(i)
+		if tip != tl.TipPtrOut && tip != tl.TipPtrInOut && !isSlice {
+			continue
+		}
+		if param.Spec.GetPointers() == 0 {
+			continue
+		}
+		name := string(gen.tr.TransformName(tl.TargetType, param.Name, public))
+		if len(name) == 0 {
+			name = fmt.Sprintf("out%d", i)
+		}
+		for names[name] {
+			name += "Out"
+		}
+		names[name] = true
+		if isSlice {
+			pair := pair
+			outs = append(outs, outParam{
+				Index:   i,
+				Name:    name,
+				GoSpec:  gen.tr.TranslateSpec(param.Spec, tl.TipPtrArr, typeTipRx.TipAt(i)),
+				CGoSpec: gen.tr.CGoSpec(param.Spec, true),
+				Slice:   &pair,
+			})
+			continue
+		}
+		elemSpec := param.Spec.Copy()
+		elemSpec.SetPointers(param.Spec.GetPointers() - 1)
+		outs = append(outs, outParam{
+			Index:   i,
+			Name:    name,
+			InOut:   tip == tl.TipPtrInOut,
+			GoSpec:  gen.tr.TranslateSpec(elemSpec, tl.TipPtrRef, typeTipRx.TipAt(i)),
+			CGoSpec: gen.tr.CGoSpec(elemSpec, false),
+		})
+	}
+	return outs
+}
+
+// resultName returns a result name based on name that doesn't clash with the out params.
+func resultName(outs []outParam, name string) string {
+	for seen := true; seen; {
+		seen = false
+		for _, out := range outs {
+			if out.Name == name {
+				name += "Out"
+				seen = true
+			}
+		}
+	}
+	return name
+}
+
+// writeFunctionResults writes the results of a function, the out params come first,
+// then the return value and the error of errno or an error rule. Named results are used if there are out params.
+func (gen *Generator) writeFunctionResults(wr io.Writer, outs []outParam, returnRef string, withError bool) {
+	var names, types []string
+	for _, out := range outs {
+		names = append(names, out.Name)
+		types = append(types, out.GoSpec.String())
+	}
+	if len(returnRef) > 0 {
+		if returnRef == "error" {
+			names = append(names, resultName(outs, "err"))
+		} else {
+			names = append(names, resultName(outs, "ret"))
+		}
+		types = append(types, returnRef)
+	}
+	if withError {
+		names = append(names, resultName(outs, "err"))
+		types = append(types, "error")
+	}
+	switch {
+	case len(types) == 0:
+		return
+	case len(types) == 1 && len(outs) == 0:
+		fmt.Fprintf(wr, " %s", types[0])
+		return
+	case len(outs) == 0:
+		fmt.Fprintf(wr, " (%s)", strings.Join(types, ", "))
+		return
+	}
+	var results []string
+	for i := range names {
+		if i < len(names)-1 && types[i] == types[i+1] {
+			results = append(results, names[i])
+			continue
+		}
+		results = append(results, names[i]+" "+types[i])
+	}
+	fmt.Fprintf(wr, " (%s)", strings.Join(results, ", "))
+}
+
+// outParamProxy returns the declaration of the C storage for an out param.
+func (gen *Generator) outParamProxy(out outParam, name, goName string) (decl string, keepalive string) {
+	if !out.InOut {
+		return fmt.Sprintf("var %s %s", name, out.CGoSpec), ""
+	}
+	fromProxy, nillable := gen.proxyArgFromGo(tl.NoTip, goName, out.GoSpec, out.CGoSpec)
+	if nillable {
+		return fmt.Sprintf("var %s %s\nif %s != nil {\n%s, _ = %s\n}", name, out.CGoSpec, goName, name, fromProxy), ""
+	}
+	return fmt.Sprintf("%s, %sAllocMap := %s", name, name, fromProxy),
+		fmt.Sprintf("runtime.KeepAlive(%sAllocMap)\n", name)
+}
@@ -0,0 +1,178 @@
+package generator
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"fmt"
+
+	tl "github.com/bhojpur/build/pkg/cpp/translator"
+)
+
+// isReturnPtrTip reports whether the self tip of a function is a ptr tip for its return value,
+// the errno and ownership tips describe the call instead.
+func isReturnPtrTip(tip tl.Tip) bool {
+	switch tip {
+	case tl.TipPtrErrno, tl.TipPtrOwned, tl.TipPtrBorrowed:
+		return false
+	default:
+		return tip.IsValid()
+	}
+}
+
+// ownedReturn is the return value of a function that the caller must free.
+type ownedReturn struct {
+	GoType string
+	// Handle is the wrapper type for the owned structs, the strings are copied instead.
+	Handle string
+	GoSpec tl.GoTypeSpec
+	Free   tl.DeallocatorRx
+}
+
+// ownedReturn returns the owned return value of a function, that is the C strings
+// and struct pointers returned by the functions marked with the owned tip.
+func (gen *Generator) ownedReturn(decl *tl.CDecl) (ownedReturn, bool) {
+	spec := decl.Spec.(*tl.CFunctionSpec)
+	ptrTipRx, ok := gen.tr.PtrTipRx(tl.TipScopeFunction, decl.Name)
+	if !ok || ptrTipRx.Self() != tl.TipPtrOwned || spec.Return == nil || spec.Return.GetPointers() == 0 {
+		return ownedReturn{}, false
+	}
+	typeTipRx, _ := gen.tr.TypeTipRx(tl.TipScopeFunction, decl.Name)
+	goSpec := gen.tr.TranslateSpec(spec.Return, tl.TipPtrRef, typeTipRx.Self())
+	if typeSpec, ok := spec.Return.(*tl.CTypeSpec); ok && typeSpec.Base == "char" && typeSpec.Pointers == 1 {
+		if typeTipRx.Self() == tl.TipTypeString {
+			// owned C strings are copied when asked for by the string tip
+			goSpec = tl.GoTypeSpec{Base: "string"}
+		}
+	}
+	free := gen.tr.Deallocator(decl.Name, spec.Return.GetBase(), spec.Return.GetTag())
+	switch {
+	case goSpec.IsGoString():
+		return ownedReturn{
+			GoType: goSpec.String(),
+			GoSpec: goSpec,
+			Free:   free,
+		}, true
+	case goSpec.Pointers == 1 && len(goSpec.OuterArr)+len(goSpec.InnerArr) == 0 && len(goSpec.Raw) > 0 &&
+		(goSpec.Kind == tl.StructKind || goSpec.Kind == tl.OpaqueStructKind || goSpec.Kind == tl.UnionKind):
+		handle := "Owned" + goSpec.Raw
+		return ownedReturn{
+			GoType: "*" + handle,
+			Handle: handle,
+			GoSpec: goSpec,
+			Free:   free,
+		}, true
+	default:
+		return ownedReturn{}, false
+	}
+}
+
+// freeCall returns the call of the deallocator for the C memory at ref, an unsafe.Pointer.
+func (gen *Generator) freeCall(free string, ref string) string {
+	argSpec := "unsafe.Pointer"
+	if decl, ok := gen.tr.DeclareMap()[free]; ok {
+		if spec, ok := decl.Spec.(*tl.CFunctionSpec); ok && len(spec.Params) == 1 {
+			argSpec = gen.tr.CGoSpec(spec.Params[0].Spec, true).String()
+		}
+	}
+	if argSpec == "unsafe.Pointer" {
+		return fmt.Sprintf("C.%s(%s)", free, ref)
+	}
+	return fmt.Sprintf("C.%s((%s)(%s))", free, argSpec, ref)
+}
+
+// ownedReturnProxy converts the owned value in __ret into __v, the strings are copied
+// and freed right away, the structs are wrapped into the handles freed by Close.
+func (gen *Generator) ownedReturnProxy(owned ownedReturn) string {
+	buf := new(bytes.Buffer)
+	if len(owned.Handle) == 0 {
+		fmt.Fprintf(buf, "var __v %s\n", owned.GoType)
+		fmt.Fprintln(buf, "if __ret != nil {")
+		fmt.Fprintln(buf, "__v = C.GoString((*C.char)(unsafe.Pointer(__ret)))")
+		fmt.Fprintln(buf, gen.freeCall(owned.Free.Free, "unsafe.Pointer(__ret)"))
+		fmt.Fprintln(buf, "}")
+		return buf.String()
+	}
+	for _, helper := range gen.getOwnedHandleHelpers(owned) {
+		gen.submitHelper(helper)
+	}
+	fmt.Fprintf(buf, "__v := new%s(unsafe.Pointer(__ret), func(ref unsafe.Pointer) {\n%s\n}, %v)",
+		owned.Handle, gen.freeCall(owned.Free.Free, "ref"), owned.Free.Finalizer)
+	return buf.String()
+}
+
+func (gen *Generator) getOwnedHandleHelpers(owned ownedReturn) (helpers []*Helper) {
+	name := owned.Handle
+	base := owned.GoSpec.Raw
+	helpers = append(helpers, &Helper{
+		Name: name,
+		Description: fmt.Sprintf("%s holds a %s that has been allocated by C,\n"+
+			"it must be freed by Close when no longer used.", name, base),
+		Source: fmt.Sprintf(`type %s struct {
+			*%s
+			ref  unsafe.Pointer
+			free func(ref unsafe.Pointer)
+			once sync.Once
+		}`, name, base),
+	})
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "func new%s(ref unsafe.Pointer, free func(ref unsafe.Pointer), finalize bool) *%s", name, name)
+	fmt.Fprintf(buf, `{
+		if ref == nil {
+			return nil
+		}
+		x := &%s{
+			%s: New%sRef(ref),
+			ref: ref,
+			free: free,
+		}
+		if finalize {
+			runtime.SetFinalizer(x, (*%s).Close)
+		}
+		return x
+	}`, name, base, base, name)
+	helpers = append(helpers, &Helper{
+		Name:        "new" + name,
+		Description: fmt.Sprintf("new%s wraps the C memory at ref, the memory is freed using free.", name),
+		Source:      buf.String(),
+	})
+
+	buf = new(bytes.Buffer)
+	fmt.Fprintf(buf, "func (x *%s) Close()", name)
+	fmt.Fprintf(buf, `{
+		if x == nil {
+			return
+		}
+		x.once.Do(func() {
+			runtime.SetFinalizer(x, nil)
+			x.free(x.ref)
+			x.ref = nil
+			x.%s = nil
+		})
+	}`, base)
+	helpers = append(helpers, &Helper{
+		Name:        name + ".Close",
+		Description: "Close frees the C memory, the memory is freed once no matter how many times\nClose is called.",
+		Source:      buf.String(),
+	})
+	return helpers
+}
@@ -0,0 +1,153 @@
+package generator
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"strconv"
+
+	tl "github.com/bhojpur/build/pkg/cpp/translator"
+)
+
+// slicePair is a pointer param of a function that is bound as a Go slice
+// along with the param that holds its length.
+type slicePair struct {
+	Ptr int
+	Len int
+	Out bool
+}
+
+// slicePairs returns the pointer and length params of a function that are linked by the slice tips,
+// the tips that don't refer to a pointer and an integer length are returned as invalid.
+func (gen *Generator) slicePairs(funcName string, spec *tl.CFunctionSpec) (pairs []slicePair, invalid []tl.SliceTip) {
+	ptrTipRx, ok := gen.tr.PtrTipRx(tl.TipScopeFunction, funcName)
+	if !ok {
+		return nil, nil
+	}
+	typeTipRx, _ := gen.tr.TypeTipRx(tl.TipScopeFunction, funcName)
+	used := make(map[int]bool)
+	for _, tip := range ptrTipRx.Slices() {
+		ptr := paramIndex(spec.Params, tip.Ptr)
+		length := paramIndex(spec.Params, tip.Len)
+		if ptr < 0 || length < 0 || ptr == length || used[ptr] || used[length] {
+			invalid = append(invalid, tip)
+			continue
+		}
+		ptrSpec := spec.Params[ptr].Spec
+		lenSpec := spec.Params[length].Spec
+		if ptrSpec.GetPointers() == 0 || lenSpec.Kind() != tl.TypeKind || lenSpec.GetPointers() > 1 {
+			invalid = append(invalid, tip)
+			continue
+		}
+		if tip.Out {
+			// the buffer is allocated by the wrapper, so it must hold plain values
+			goSpec := gen.tr.TranslateSpec(ptrSpec, tl.TipPtrArr, typeTipRx.TipAt(ptr))
+			if goSpec.Slices != 1 || !(goSpec.IsPlain() || goSpec.IsPlainKind()) {
+				invalid = append(invalid, tip)
+				continue
+			}
+		}
+		used[ptr], used[length] = true, true
+		pairs = append(pairs, slicePair{
+			Ptr: ptr,
+			Len: length,
+			Out: tip.Out,
+		})
+	}
+	return pairs, invalid
+}
+
+// paramIndex resolves a param referred to by its index or name, -1 is returned if there is none.
+func paramIndex(params []*tl.CDecl, ref string) int {
+	if i, err := strconv.Atoi(ref); err == nil {
+		if i >= 0 && i < len(params) {
+			return i
+		}
+		return -1
+	}
+	for i, param := range params {
+		if len(ref) > 0 && param.Name == ref {
+			return i
+		}
+	}
+	return -1
+}
+
+func pairByPtr(pairs []slicePair, i int) (slicePair, bool) {
+	for _, pair := range pairs {
+		if pair.Ptr == i {
+			return pair, true
+		}
+	}
+	return slicePair{}, false
+}
+
+func pairByLen(pairs []slicePair, i int) (slicePair, bool) {
+	for _, pair := range pairs {
+		if pair.Len == i {
+			return pair, true
+		}
+	}
+	return slicePair{}, false
+}
+
+// capacityName returns the name of the Go param that replaces the length of an out buffer.
+func (gen *Generator) capacityName(param *tl.CDecl) string {
+	const public = false
+	name := string(gen.tr.TransformName(tl.TargetType, param.Name, public))
+	switch name {
+	case "", "len", "cap", "make":
+		return "capacity"
+	}
+	return name
+}
+
+// sliceLenProxy returns the declaration of the length param that is linked to a slice.
+func (gen *Generator) sliceLenProxy(param *tl.CDecl, name, value string) (decl, ref string) {
+	lenSpec := param.Spec
+	if lenSpec.GetPointers() > 0 {
+		lenSpec = lenSpec.Copy()
+		lenSpec.SetPointers(0)
+		ref = "&"
+	}
+	cgoSpec := gen.tr.CGoSpec(lenSpec, false)
+	return fmt.Sprintf("%s := (%s)(%s)", name, cgoSpec, value), ref + name
+}
+
+// outSliceProxy returns the declaration of an out buffer that is allocated by the wrapper.
+func (gen *Generator) outSliceProxy(out outParam, name, capacity string) string {
+	goName := "__" + out.Name
+	return fmt.Sprintf("%s := make(%s, %s)\nvar %s %s\nif len(%s) > 0 {\n%s = (%s)(unsafe.Pointer(&%s[0]))\n}",
+		goName, out.GoSpec, capacity, name, out.CGoSpec, goName, name, out.CGoSpec, goName)
+}
+
+var sliceLen = &Helper{
+	Name:        "sliceLen",
+	Description: "sliceLen bounds the length n of the data written by C to the capacity of the buffer.",
+	Source: `func sliceLen(n, capacity int) int {
+		if n < 0 {
+			return 0
+		} else if n > capacity {
+			return capacity
+		}
+		return n
+	}`,
+}
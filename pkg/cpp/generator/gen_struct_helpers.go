@@ -111,6 +111,7 @@ func (gen *Generator) getStructHelpers(goStructName []byte, cStructName string,
 			"Do not forget to call this method whether you get a struct for C object and want to read its values.",
 		Source: buf.String(),
 	})
+	helpers = append(helpers, gen.getBitFieldHelpers(goStructName, cStructName, spec, false)...)
 	return
 }
 
@@ -190,6 +191,7 @@ func (gen *Generator) getRawStructHelpers(goStructName []byte, cStructName strin
 		Requires:    []*Helper{allocHelper},
 	})
 
+	helpers = append(helpers, gen.getBitFieldHelpers(goStructName, cStructName, spec, true)...)
 	if !gen.cfg.Options.StructAccessors {
 		return
 	}
@@ -197,6 +199,9 @@ func (gen *Generator) getRawStructHelpers(goStructName []byte, cStructName strin
 	for i, m := range structSpec.Members {
 		if len(m.Name) == 0 {
 			continue
+		} else if m.BitField != nil {
+			// accessed through the bitfield methods
+			continue
 		}
 		buf.Reset()
 		typeName := m.Spec.GetBase()
@@ -291,6 +296,11 @@ func (gen *Generator) getPassRefSource(goStructName []byte, cStructName string,
 		goSpec := gen.tr.TranslateSpec(m.Spec, ptrTip, typeTip)
 		cgoSpec := gen.tr.CGoSpec(m.Spec, false)
 		const public = true
+		if m.BitField != nil {
+			goName := "x." + bitFieldName(string(gen.tr.TransformName(tl.TargetType, m.Name, public)))
+			fmt.Fprintf(buf, "{\n%s}\n", bitFieldSetter(fmt.Sprintf("unsafe.Pointer(ref%2x)", crc), m.BitField, goSpec, goName))
+			continue
+		}
 		goName := "x." + string(gen.tr.TransformName(tl.TargetType, m.Name, public))
 		fromProxy, nillable := gen.proxyValueFromGo(memTip, goName, goSpec, cgoSpec)
 		if nillable {
@@ -362,6 +372,11 @@ func (gen *Generator) getDerefSource(goStructName []byte, cStructName string, sp
 		typeTip := typeTipRx.TipAt(i)
 		goSpec := gen.tr.TranslateSpec(m.Spec, ptrTip, typeTip)
 		const public = true
+		if m.BitField != nil {
+			goName := "x." + bitFieldName(string(gen.tr.TransformName(tl.TargetType, m.Name, public)))
+			fmt.Fprintf(buf, "%s = %s\n", goName, bitFieldGetter(fmt.Sprintf("unsafe.Pointer(x.ref%2x)", crc), m.BitField, goSpec))
+			continue
+		}
 		goName := "x." + string(gen.tr.TransformName(tl.TargetType, m.Name, public))
 		cgoName := fmt.Sprintf("x.ref%2x.%s", crc, m.Name)
 		cgoSpec := gen.tr.CGoSpec(m.Spec, false)
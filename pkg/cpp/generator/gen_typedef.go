@@ -38,6 +38,7 @@ func (gen *Generator) writeTypeTypedef(wr io.Writer, decl *tl.CDecl, seenNames m
 	}
 	fmt.Fprintf(wr, "// %s type as declared in %s\n", goTypeName,
 		filepath.ToSlash(gen.tr.SrcLocation(tl.TargetType, decl.Name, decl.Pos)))
+	gen.writeDoc(wr, decl.Doc, nil)
 	fmt.Fprintf(wr, "type %s %s", goTypeName, goSpec.UnderlyingString())
 	writeSpace(wr, 1)
 }
@@ -52,6 +53,7 @@ func (gen *Generator) writeEnumTypedef(wr io.Writer, decl *tl.CDecl) {
 	if typeName := string(goName); typeName != typeRef {
 		fmt.Fprintf(wr, "// %s as declared in %s\n", goName,
 			filepath.ToSlash(gen.tr.SrcLocation(tl.TargetConst, cName, decl.Pos)))
+		gen.writeDoc(wr, decl.Doc, nil)
 		fmt.Fprintf(wr, "type %s %s", goName, typeRef)
 		writeSpace(wr, 1)
 	}
@@ -91,6 +93,7 @@ func (gen *Generator) writeFunctionTypedef(wr io.Writer, decl *tl.CDecl, seenNam
 	goSpec.Raw = "" // not used in func typedef
 	fmt.Fprintf(wr, "// %s type as declared in %s\n", goFuncName,
 		filepath.ToSlash(gen.tr.SrcLocation(tl.TargetFunction, decl.Name, decl.Pos)))
+	gen.writeDoc(wr, decl.Doc, funcSpec.Params)
 	fmt.Fprintf(wr, "type %s %s", goFuncName, goSpec)
 	gen.writeFunctionParams(wr, decl.Name, decl.Spec)
 	if len(returnRef) > 0 {
@@ -127,16 +130,21 @@ func (gen *Generator) writeStructTypedef(wr io.Writer, decl *tl.CDecl, raw bool,
 		// opaque struct
 		fmt.Fprintf(wr, "// %s as declared in %s\n", goName,
 			filepath.ToSlash(gen.tr.SrcLocation(tl.TargetType, cName, decl.Pos)))
+		gen.writeDoc(wr, decl.Doc, nil)
 		fmt.Fprintf(wr, "type %s C.%s", goName, decl.Spec.CGoName())
 		writeSpace(wr, 1)
 		for _, helper := range gen.getRawStructHelpers(goName, cName, decl.Spec) {
 			gen.submitHelper(helper)
 		}
+		if gen.cfg.Options.LayoutTests {
+			gen.submitLayoutTest(goName, decl, true)
+		}
 		return
 	}
 
 	fmt.Fprintf(wr, "// %s as declared in %s\n", goName,
 		filepath.ToSlash(gen.tr.SrcLocation(tl.TargetType, cName, decl.Pos)))
+	gen.writeDoc(wr, decl.Doc, nil)
 	fmt.Fprintf(wr, "type %s struct {", goName)
 	writeSpace(wr, 1)
 	gen.submitHelper(cgoAllocMap)
@@ -146,6 +154,9 @@ func (gen *Generator) writeStructTypedef(wr io.Writer, decl *tl.CDecl, raw bool,
 	for _, helper := range gen.getStructHelpers(goName, cName, decl.Spec) {
 		gen.submitHelper(helper)
 	}
+	if gen.cfg.Options.LayoutTests {
+		gen.submitLayoutTest(goName, decl, false)
+	}
 }
 
 func (gen *Generator) writeUnionTypedef(wr io.Writer, decl *tl.CDecl) {
@@ -159,6 +170,7 @@ func (gen *Generator) writeUnionTypedef(wr io.Writer, decl *tl.CDecl) {
 	if typeName := string(goName); typeName != typeRef {
 		fmt.Fprintf(wr, "// %s as declared in %s\n", goName,
 			filepath.ToSlash(gen.tr.SrcLocation(tl.TargetType, cName, decl.Pos)))
+		gen.writeDoc(wr, decl.Doc, nil)
 		fmt.Fprintf(wr, "const sizeof%s = unsafe.Sizeof(C.%s{})\n", goName, decl.Spec.CGoName())
 		fmt.Fprintf(wr, "type %s [sizeof%s]byte\n", goName, goName)
 		writeSpace(wr, 1)
@@ -22,11 +22,15 @@ package generator
 
 import (
 	"errors"
+	"fmt"
+	"go/token"
+	"hash/fnv"
 	"io"
-	"math/rand"
 	"sort"
 
+	"github.com/bhojpur/build/pkg/cpp/diag"
 	tl "github.com/bhojpur/build/pkg/cpp/translator"
+	"modernc.org/xc"
 )
 
 type Generator struct {
@@ -37,15 +41,58 @@ type Generator struct {
 	closed        bool
 	closeC, doneC chan struct{}
 	helpersChan   chan *Helper
-	rand          *rand.Rand
 	noTimestamps  bool
 	maxMem        MemSpec
+	arches        []string
+	layoutTests   []string
+	handles       map[string]*handleType
+	handlesUsed   bool
+	methods       *methodSet
+	diagnostics   diag.Handler
 }
 
 func (g *Generator) DisableTimestamps() {
 	g.noTimestamps = true
 }
 
+// SetArches marks the output as shared between the targets of a multi-arch generation.
+func (g *Generator) SetArches(arches []string) {
+	g.arches = arches
+}
+
+// SetDiagnostics sets the handler of the problems found while generating,
+// they are dropped when there's none.
+func (g *Generator) SetDiagnostics(h diag.Handler) {
+	g.diagnostics = h
+}
+
+func (g *Generator) warn(p token.Pos, code, format string, args ...interface{}) {
+	if g.diagnostics == nil {
+		return
+	}
+	g.diagnostics(diag.Diagnostic{
+		Severity: diag.Warning,
+		Pos:      diag.FromPos(xc.FileSet.Position(p)),
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// declPos returns the position of the declaration of a type or a function.
+func (g *Generator) declPos(name string) token.Pos {
+	if decl, ok := g.tr.TagMap()[name]; ok {
+		return decl.Pos
+	}
+	for _, decls := range [][]*tl.CDecl{g.tr.Typedefs(), g.tr.Declares()} {
+		for _, decl := range decls {
+			if decl.Name == name {
+				return decl.Pos
+			}
+		}
+	}
+	return token.NoPos
+}
+
 type TraitFlagGroup struct {
 	Name   string   `yaml:"name"`
 	Traits []string `yaml:"traits"`
@@ -67,6 +114,10 @@ type GenOptions struct {
 	SafeStrings     bool `yaml:"SafeStrings"`
 	StructAccessors bool `yaml:"StructAccessors"`
 	KeepAlive       bool `yaml:"KeepAlive"`
+	// LayoutTests makes the generator emit layout_test.go that checks the Go layout of structs against C.
+	LayoutTests bool `yaml:"LayoutTests"`
+	// HandleLeakTag is the build tag that makes the handles report being garbage-collected without Close.
+	HandleLeakTag string `yaml:"HandleLeakTag"`
 }
 
 func New(pkg string, cfg *Config, tr *tl.Translator) (*Generator, error) {
@@ -83,8 +134,8 @@ func New(pkg string, cfg *Config, tr *tl.Translator) (*Generator, error) {
 		helpersChan: make(chan *Helper, 1),
 		closeC:      make(chan struct{}),
 		doneC:       make(chan struct{}),
-		rand:        rand.New(rand.NewSource(+79269965690)),
 		maxMem:      MemSpecDefault,
+		handles:     make(map[string]*handleType),
 	}
 	return gen, nil
 }
@@ -348,10 +399,14 @@ func (gen *Generator) WriteDeclares(wr io.Writer) int {
 			} else {
 				seenFunctions[decl.Name] = true
 			}
+			if gen.isHandleDestructor(decl) {
+				// called by Close of the handle
+				continue
+			}
 			// defaults to ref for the returns
 			ptrTip := tl.TipPtrRef
 			if ptrTipRx, ok := gen.tr.PtrTipRx(tl.TipScopeFunction, decl.Name); ok {
-				if tip := ptrTipRx.Self(); tip.IsValid() {
+				if tip := ptrTipRx.Self(); isReturnPtrTip(tip) {
 					ptrTip = tip
 				}
 			}
@@ -454,9 +509,15 @@ func (gen *Generator) MonitorAndWriteHelpers(goWr, chWr io.Writer, ccWr io.Write
 	}
 }
 
-// randPostfix generates a simply random 4-byte postfix. Doesn't require a crypto package.
-func (gen *Generator) randPostfix() int32 {
-	return 0x0f000000 + gen.rand.Int31n(0x00ffffff)
+// namePostfix generates a 4-byte postfix for a local name derived from the parts,
+// so the same code gets the same names on every run.
+func namePostfix(parts ...string) int32 {
+	h := fnv.New32a()
+	for _, part := range parts {
+		io.WriteString(h, part)
+		h.Write([]byte{0})
+	}
+	return 0x0f000000 + int32(h.Sum32()%0x00ffffff)
 }
 
 type tagDef struct {
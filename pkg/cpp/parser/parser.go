@@ -23,27 +23,34 @@ package parser
 import (
 	"errors"
 	"fmt"
-	"log"
+	"go/token"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 
+	"github.com/bhojpur/build/pkg/cpp/diag"
 	"modernc.org/cc"
+	"modernc.org/xc"
 )
 
 type Config struct {
 	Arch         string   `yaml:"Arch"`
+	Arches       []string `yaml:"Arches"`
 	IncludePaths []string `yaml:"IncludePaths"`
 	SourcesPaths []string `yaml:"SourcesPaths"`
 	IgnoredPaths []string `yaml:"IgnoredPaths"`
 
 	Defines map[string]interface{} `yaml:"Defines"`
 
-	CCDefs   bool `yaml:"-"`
-	CCIncl   bool `yaml:"-"`
-	archBits TargetArch
+	CCDefs bool `yaml:"-"`
+	CCIncl bool `yaml:"-"`
+	// Diagnostics receives the problems that don't stop the parsing,
+	// they are dropped if it's nil.
+	Diagnostics diag.Handler `yaml:"-"`
+	archBits    TargetArch
 }
 
 func ParseWith(cfg *Config) (*cc.TranslationUnit, error) {
@@ -54,11 +61,58 @@ func ParseWith(cfg *Config) (*cc.TranslationUnit, error) {
 	if err != nil {
 		return nil, err
 	}
+	predefined := predefines(cfg)
+	model := newModel(cfg.archBits)
+	return cc.Parse(predefined, cfg.SourcesPaths, model,
+		cc.SysIncludePaths(cfg.IncludePaths),
+		cc.EnableAnonymousStructFields(),
+		cc.EnableAsm(),
+		cc.EnableAlternateKeywords(),
+		cc.EnableIncludeNext(),
+		cc.EnableNoreturn(),
+		cc.EnableEmptyDeclarations(),
+		cc.EnableWideEnumValues(),
+		cc.EnableWideBitFieldTypes(),
+		cc.EnableParenthesizedCompoundStatemen(),
+
+		cc.AllowCompatibleTypedefRedefinitions(),
+	)
+}
+
+// newModel returns a copy of the model of the target, cc refuses
+// a model that has been used by a parse before.
+func newModel(arch TargetArch) *cc.Model {
+	m := *models[arch]
+	return &m
+}
+
+// Predefines returns the source the headers are preprocessed with,
+// that is the built-in macros of the target and the user-provided Defines.
+func Predefines(cfg *Config) (string, error) {
+	c := *cfg
+	c.IncludePaths = append([]string(nil), cfg.IncludePaths...)
+	arch, err := c.TargetArch()
+	if err != nil {
+		return "", err
+	}
+	c.archBits = arch
+	return predefines(&c), nil
+}
+
+// predefines builds the predefined source, the system include paths
+// of the host compiler are prepended to IncludePaths if CCIncl is set.
+func predefines(cfg *Config) string {
+	// the defines are sorted to keep the source the same between runs
+	names := make([]string, 0, len(cfg.Defines))
+	for name := range cfg.Defines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
 	predefined := builtinBase
 	// user-provided defines take precedence
-	for name, value := range cfg.Defines {
-		switch v := value.(type) {
+	for _, name := range names {
+		switch v := cfg.Defines[name].(type) {
 		case string:
 			predefined += fmt.Sprintf("\n#define %s \"%s\"", name, v)
 		case int, int16, int32, int64, uint, uint16, uint32, uint64:
@@ -87,7 +141,13 @@ func ParseWith(cfg *Config) (*cc.TranslationUnit, error) {
 		// }
 		predefined, _, sysIncludePaths, err := hostCppConfig(cppPath)
 		if err != nil {
-			log.Println("[WARN] `cpp -dM` failed:", err)
+			if cfg.Diagnostics != nil {
+				cfg.Diagnostics(diag.Diagnostic{
+					Severity: diag.Warning,
+					Code:     diag.CodeHostCPP,
+					Message:  fmt.Sprintf("`cpp -dM` failed: %v", err),
+				})
+			}
 		} else {
 			if cfg.CCIncl && len(sysIncludePaths) > 0 {
 				// add on top of sysIncludePaths if allowed by config
@@ -107,8 +167,8 @@ func ParseWith(cfg *Config) (*cc.TranslationUnit, error) {
 	}
 	// undefines?
 	predefined += fmt.Sprintf("\n%s", builtinBaseUndef)
-	for name, value := range cfg.Defines {
-		switch value.(type) {
+	for _, name := range names {
+		switch value := cfg.Defines[name]; value.(type) {
 		case string, int, int16, int32, int64, uint, uint16, uint32, uint64, float32, float64:
 			continue
 		default: // a corner case: undef using an the nil value
@@ -117,34 +177,50 @@ func ParseWith(cfg *Config) (*cc.TranslationUnit, error) {
 			}
 		}
 	}
-	model := models[cfg.archBits]
-	return cc.Parse(predefined, cfg.SourcesPaths, model,
-		cc.SysIncludePaths(cfg.IncludePaths),
-		cc.EnableAnonymousStructFields(),
-		cc.EnableAsm(),
-		cc.EnableAlternateKeywords(),
-		cc.EnableIncludeNext(),
-		cc.EnableNoreturn(),
-		cc.EnableEmptyDeclarations(),
-		cc.EnableWideEnumValues(),
-		cc.EnableWideBitFieldTypes(),
-		cc.EnableParenthesizedCompoundStatemen(),
+	return predefined
+}
 
-		cc.AllowCompatibleTypedefRedefinitions(),
-	)
+// FileMark returns a mark of the files read by the parses so far, the file set
+// of cc is shared by every parse in the process.
+func FileMark() int {
+	return xc.FileSet.Base()
+}
+
+// SourceFiles returns the paths of the files that have been read by the parses since
+// the mark, that includes every header that has been included by the sources.
+func SourceFiles(mark int) []string {
+	var paths []string
+	seen := make(map[string]bool)
+	xc.FileSet.Iterate(func(f *token.File) bool {
+		if f.Base() < mark {
+			return true
+		}
+		name := f.Name()
+		if strings.HasPrefix(name, "<") {
+			return true
+		}
+		if absPath, err := filepath.Abs(name); err == nil {
+			name = absPath
+		}
+		if info, err := os.Stat(name); err == nil && !info.IsDir() && !seen[name] {
+			seen[name] = true
+			paths = append(paths, name)
+		}
+		return true
+	})
+	sort.Strings(paths)
+	return paths
 }
 
 func checkConfig(cfg *Config) (*Config, error) {
 	if cfg == nil {
 		cfg = &Config{}
 	}
-	if arch, ok := arches[cfg.Arch]; !ok {
-		// default to 64-bit arch
-		cfg.archBits = Arch64
-	} else if arch != Arch32 && arch != Arch64 && arch != Arch48 {
-		// default to 64-bit arch
-		cfg.archBits = Arch64
+	arch, err := cfg.TargetArch()
+	if err != nil {
+		return nil, err
 	}
+	cfg.archBits = arch
 	// workaround for cznic's cc (it panics if supplied path is a dir)
 	var saneFiles []string
 	for _, path := range cfg.SourcesPaths {
@@ -169,6 +245,34 @@ func checkConfig(cfg *Config) (*Config, error) {
 	return cfg, nil
 }
 
+// TargetArch returns the target architecture that is set by Arch,
+// it fails if Arch names an unknown architecture.
+func (c *Config) TargetArch() (TargetArch, error) {
+	return ResolveArch(c.Arch)
+}
+
+// TypeModel returns the model of the target architecture,
+// it defines the sizes and alignments of C types.
+func (c *Config) TypeModel() (*cc.Model, error) {
+	arch, err := c.TargetArch()
+	if err != nil {
+		return nil, err
+	}
+	return models[arch], nil
+}
+
+// WcharType returns the kind of wchar_t on the target architecture.
+func (c *Config) WcharType() (cc.Kind, error) {
+	arch, err := c.TargetArch()
+	if err != nil {
+		return cc.Undefined, err
+	}
+	if kind, ok := wcharTypes[arch]; ok {
+		return kind, nil
+	}
+	return cc.Int, nil
+}
+
 func findFile(path string, includePaths []string) (string, error) {
 	if _, err := os.Stat(path); err == nil {
 		return path, nil
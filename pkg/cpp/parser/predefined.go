@@ -21,6 +21,8 @@ package parser
 // THE SOFTWARE.
 
 import (
+	"fmt"
+	"sort"
 	"strings"
 
 	"modernc.org/cc"
@@ -29,13 +31,39 @@ import (
 type TargetArch string
 
 const (
-	Arch32    TargetArch = "i386"
-	Arch48    TargetArch = "x86_48"
-	Arch64    TargetArch = "x86_64"
-	ArchArm32 TargetArch = "arm"
-	ArchArm64 TargetArch = "aarch64"
+	Arch32      TargetArch = "i386"
+	Arch48      TargetArch = "x86_48"
+	Arch64      TargetArch = "x86_64"
+	ArchArm32   TargetArch = "arm"
+	ArchArm64   TargetArch = "aarch64"
+	ArchWin64   TargetArch = "x86_64-windows"
+	ArchRiscv64 TargetArch = "riscv64"
+	ArchWasm32  TargetArch = "wasm32"
 )
 
+// DataModel names the widths of int, long and pointers of a target.
+type DataModel string
+
+const (
+	DataModelILP32 DataModel = "ILP32"
+	DataModelLP64  DataModel = "LP64"
+	DataModelLLP64 DataModel = "LLP64"
+)
+
+// DataModelOf returns the data model that corresponds to the sizes of the model.
+func DataModelOf(model *cc.Model) DataModel {
+	long := model.Items[cc.Long].Size
+	ptr := model.Items[cc.Ptr].Size
+	switch {
+	case ptr == 8 && long == 4:
+		return DataModelLLP64
+	case long == 8:
+		return DataModelLP64
+	default:
+		return DataModelILP32
+	}
+}
+
 var builtinBase = `
 #define __builtin_va_list void *
 #define __asm(x)
@@ -82,50 +110,284 @@ void __GO__(char*, ...);
 `
 
 var archPredefines = map[TargetArch]string{
-	Arch32: `#define __i386__ 1`,
-	Arch48: `#define __x86_64__ 1`,
-	Arch64: `#define __x86_64__ 1`,
+	Arch32: strings.Join([]string{
+		`#define __i386__ 1`,
+		`#define __SIZE_TYPE__ unsigned int`,
+		`#define __PTRDIFF_TYPE__ int`,
+		`#define __WCHAR_TYPE__ long int`,
+	}, "\n"),
+	Arch48: strings.Join([]string{
+		`#define __x86_64__ 1`,
+		`#define __SIZE_TYPE__ unsigned int`,
+		`#define __PTRDIFF_TYPE__ int`,
+		`#define __WCHAR_TYPE__ int`,
+	}, "\n"),
+	Arch64: strings.Join([]string{
+		`#define __x86_64__ 1`,
+		`#define __SIZE_TYPE__ long unsigned int`,
+		`#define __PTRDIFF_TYPE__ long int`,
+		`#define __WCHAR_TYPE__ int`,
+	}, "\n"),
 	ArchArm32: strings.Join([]string{
-		`#define __ARM_EABI__ 1`,
 		`#define __arm__ 1`,
+		`#define __ARM_EABI__ 1`,
+		`#define __ARMEL__ 1`,
+		`#define __ARM_ARCH 7`,
+		`#define __ARM_ARCH_7A__ 1`,
+		`#define __ARM_PCS_VFP 1`,
+		`#define __CHAR_UNSIGNED__ 1`,
+		`#define __SIZEOF_SHORT__ 2`,
+		`#define __SIZEOF_INT__ 4`,
+		`#define __SIZEOF_LONG__ 4`,
+		`#define __SIZEOF_LONG_LONG__ 8`,
+		`#define __SIZEOF_POINTER__ 4`,
+		`#define __SIZEOF_FLOAT__ 4`,
+		`#define __SIZEOF_DOUBLE__ 8`,
+		`#define __SIZEOF_LONG_DOUBLE__ 8`,
+		`#define __SIZEOF_SIZE_T__ 4`,
+		`#define __SIZEOF_PTRDIFF_T__ 4`,
+		`#define __SIZEOF_WCHAR_T__ 4`,
+		`#define __SIZEOF_WINT_T__ 4`,
+		`#define __SIZE_TYPE__ unsigned int`,
+		`#define __PTRDIFF_TYPE__ int`,
+		`#define __WCHAR_TYPE__ unsigned int`,
+		`#define __INT_MAX__ 2147483647`,
+		`#define __LONG_MAX__ 2147483647L`,
+		`#define __LONG_LONG_MAX__ 9223372036854775807LL`,
+		`#define __BIGGEST_ALIGNMENT__ 8`,
+		byteOrderLittleEndian,
 	}, "\n"),
 	ArchArm64: strings.Join([]string{
-		`#define __ARM_EABI__ 1`,
 		`#define __aarch64__ 1`,
+		`#define __AARCH64EL__ 1`,
+		`#define __ARM_64BIT_STATE 1`,
+		`#define __ARM_ARCH 8`,
+		`#define __ARM_ARCH_ISA_A64 1`,
+		`#define __CHAR_UNSIGNED__ 1`,
+		`#define __LP64__ 1`,
+		`#define _LP64 1`,
+		`#define __SIZEOF_SHORT__ 2`,
+		`#define __SIZEOF_INT__ 4`,
+		`#define __SIZEOF_LONG__ 8`,
+		`#define __SIZEOF_LONG_LONG__ 8`,
+		`#define __SIZEOF_POINTER__ 8`,
+		`#define __SIZEOF_FLOAT__ 4`,
+		`#define __SIZEOF_DOUBLE__ 8`,
+		`#define __SIZEOF_LONG_DOUBLE__ 16`,
+		`#define __SIZEOF_SIZE_T__ 8`,
+		`#define __SIZEOF_PTRDIFF_T__ 8`,
+		`#define __SIZEOF_WCHAR_T__ 4`,
+		`#define __SIZEOF_WINT_T__ 4`,
+		`#define __SIZE_TYPE__ long unsigned int`,
+		`#define __PTRDIFF_TYPE__ long int`,
+		`#define __WCHAR_TYPE__ unsigned int`,
+		`#define __INT_MAX__ 2147483647`,
+		`#define __LONG_MAX__ 9223372036854775807L`,
+		`#define __LONG_LONG_MAX__ 9223372036854775807LL`,
+		`#define __BIGGEST_ALIGNMENT__ 16`,
+		byteOrderLittleEndian,
+	}, "\n"),
+	ArchRiscv64: strings.Join([]string{
+		`#define __riscv 1`,
+		`#define __riscv_xlen 64`,
+		`#define __riscv_flen 64`,
+		`#define __riscv_float_abi_double 1`,
+		`#define __riscv_mul 1`,
+		`#define __riscv_div 1`,
+		`#define __riscv_atomic 1`,
+		`#define __riscv_compressed 1`,
+		`#define __CHAR_UNSIGNED__ 1`,
+		`#define __LP64__ 1`,
+		`#define _LP64 1`,
+		`#define __SIZEOF_SHORT__ 2`,
+		`#define __SIZEOF_INT__ 4`,
+		`#define __SIZEOF_LONG__ 8`,
+		`#define __SIZEOF_LONG_LONG__ 8`,
+		`#define __SIZEOF_POINTER__ 8`,
+		`#define __SIZEOF_FLOAT__ 4`,
+		`#define __SIZEOF_DOUBLE__ 8`,
+		`#define __SIZEOF_LONG_DOUBLE__ 16`,
+		`#define __SIZEOF_SIZE_T__ 8`,
+		`#define __SIZEOF_PTRDIFF_T__ 8`,
+		`#define __SIZEOF_WCHAR_T__ 4`,
+		`#define __SIZEOF_WINT_T__ 4`,
+		`#define __SIZE_TYPE__ long unsigned int`,
+		`#define __PTRDIFF_TYPE__ long int`,
+		`#define __WCHAR_TYPE__ int`,
+		`#define __INT_MAX__ 2147483647`,
+		`#define __LONG_MAX__ 9223372036854775807L`,
+		`#define __LONG_LONG_MAX__ 9223372036854775807LL`,
+		`#define __BIGGEST_ALIGNMENT__ 16`,
+		byteOrderLittleEndian,
+	}, "\n"),
+	ArchWasm32: strings.Join([]string{
+		`#define __wasm 1`,
+		`#define __wasm__ 1`,
+		`#define __wasm32 1`,
+		`#define __wasm32__ 1`,
+		`#define __ILP32__ 1`,
+		`#define _ILP32 1`,
+		`#define __SIZEOF_SHORT__ 2`,
+		`#define __SIZEOF_INT__ 4`,
+		`#define __SIZEOF_LONG__ 4`,
+		`#define __SIZEOF_LONG_LONG__ 8`,
+		`#define __SIZEOF_POINTER__ 4`,
+		`#define __SIZEOF_FLOAT__ 4`,
+		`#define __SIZEOF_DOUBLE__ 8`,
+		`#define __SIZEOF_LONG_DOUBLE__ 16`,
+		`#define __SIZEOF_SIZE_T__ 4`,
+		`#define __SIZEOF_PTRDIFF_T__ 4`,
+		`#define __SIZEOF_WCHAR_T__ 4`,
+		`#define __SIZEOF_WINT_T__ 4`,
+		`#define __SIZE_TYPE__ long unsigned int`,
+		`#define __PTRDIFF_TYPE__ long int`,
+		`#define __WCHAR_TYPE__ int`,
+		`#define __INT_MAX__ 2147483647`,
+		`#define __LONG_MAX__ 2147483647L`,
+		`#define __LONG_LONG_MAX__ 9223372036854775807LL`,
+		`#define __BIGGEST_ALIGNMENT__ 16`,
+		byteOrderLittleEndian,
+	}, "\n"),
+	ArchWin64: strings.Join([]string{
+		`#define __x86_64__ 1`,
+		`#define _WIN32 1`,
+		`#define _WIN64 1`,
+		`#define __SIZE_TYPE__ long long unsigned int`,
+		`#define __PTRDIFF_TYPE__ long long int`,
+		`#define __WCHAR_TYPE__ short unsigned int`,
 	}, "\n"),
 }
 
+var byteOrderLittleEndian = strings.Join([]string{
+	`#define __ORDER_LITTLE_ENDIAN__ 1234`,
+	`#define __ORDER_BIG_ENDIAN__ 4321`,
+	`#define __ORDER_PDP_ENDIAN__ 3412`,
+	`#define __BYTE_ORDER__ __ORDER_LITTLE_ENDIAN__`,
+}, "\n")
+
 var models = map[TargetArch]*cc.Model{
-	Arch32:    model32,
-	Arch48:    model48,
-	Arch64:    model64,
-	ArchArm32: model32,
-	ArchArm64: model64,
+	Arch32:      model32,
+	Arch48:      model48,
+	Arch64:      model64,
+	ArchArm32:   modelArm32,
+	ArchArm64:   model64Quad,
+	ArchRiscv64: model64Quad,
+	ArchWasm32:  modelWasm32,
+	ArchWin64:   modelLLP64,
+}
+
+// wcharTypes are the types of wchar_t that differ from int,
+// they match the __WCHAR_TYPE__ of the targets.
+var wcharTypes = map[TargetArch]cc.Kind{
+	Arch32:    cc.Long,
+	ArchArm32: cc.UInt,
+	ArchArm64: cc.UInt,
+	ArchWin64: cc.UShort,
 }
 
 var arches = map[string]TargetArch{
 	"386":         Arch32,
+	"i386":        Arch32,
+	"i486":        Arch32,
+	"i586":        Arch32,
+	"i686":        Arch32,
+	"x86":         Arch32,
 	"arm":         ArchArm32,
-	"aarch64":     ArchArm64,
+	"armv6":       ArchArm32,
+	"armv7":       ArchArm32,
+	"armv7l":      ArchArm32,
 	"armv7a":      ArchArm32,
+	"armhf":       ArchArm32,
+	"armel":       ArchArm32,
+	"aarch64":     ArchArm64,
 	"armv8a":      ArchArm64,
 	"armeabi-v7a": ArchArm32,
 	"armeabi-v8a": ArchArm64,
-	"armbe":       ArchArm32,
-	"mips":        Arch32,
-	"mipsle":      Arch32,
-	"sparc":       Arch32,
+	"arm64-v8a":   ArchArm64,
 	"amd64":       Arch64,
-	"amd64p32":    ArchArm32,
+	"x86_64":      Arch64,
+	"x86-64":      Arch64,
+	"x64":         Arch64,
+	"x86_48":      Arch48,
+	"amd64p32":    Arch48,
 	"arm64":       ArchArm64,
-	"arm64be":     ArchArm64,
-	"ppc64":       Arch64,
-	"ppc64le":     Arch64,
-	"mips64":      Arch64,
-	"mips64le":    Arch64,
-	"mips64p32":   Arch48,
-	"mips64p32le": Arch48,
-	"sparc64":     Arch64,
+	"riscv64":     ArchRiscv64,
+	"wasm":        ArchWasm32,
+	"wasm32":      ArchWasm32,
+	"win64":       ArchWin64,
+
+	"x86_64-windows": ArchWin64,
+}
+
+// windowsSystems are the OS components of target triples that
+// select the LLP64 model on x86_64.
+var windowsSystems = map[string]bool{
+	"windows": true,
+	"win32":   true,
+	"mingw32": true,
+	"w64":     true,
+	"msvc":    true,
+}
+
+// ResolveArch maps a GOARCH name, a target name or a target triple like
+// aarch64-linux-gnu onto the target architecture. An empty name selects x86_64.
+func ResolveArch(name string) (TargetArch, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if len(name) == 0 {
+		return Arch64, nil
+	}
+	if arch, ok := arches[name]; ok {
+		return arch, nil
+	}
+	parts := strings.Split(name, "-")
+	arch, ok := arches[parts[0]]
+	if !ok || len(parts) == 1 {
+		return "", fmt.Errorf("parser: unknown arch %q, expected a GOARCH or a target triple (one of: %s)",
+			name, strings.Join(knownArches(), ", "))
+	}
+	if arch == Arch64 {
+		for _, part := range parts[1:] {
+			if windowsSystems[part] {
+				return ArchWin64, nil
+			}
+		}
+	}
+	return arch, nil
+}
+
+// goArches are the GOARCH values the targets are built on by Go.
+var goArches = map[TargetArch]string{
+	Arch32:      "386",
+	Arch48:      "amd64p32",
+	Arch64:      "amd64",
+	ArchArm32:   "arm",
+	ArchArm64:   "arm64",
+	ArchRiscv64: "riscv64",
+	ArchWasm32:  "wasm",
+	ArchWin64:   "amd64",
+}
+
+// GoTarget returns the GOOS and GOARCH that the code generated for an arch
+// is built on, GOOS is empty unless the arch implies an operating system.
+// The GOARCHs without a target of their own, such as mips or ppc64, are unknown arches.
+func GoTarget(name string) (goos, goarch string, err error) {
+	arch, err := ResolveArch(name)
+	if err != nil {
+		return "", "", err
+	}
+	if arch == ArchWin64 {
+		return "windows", goArches[arch], nil
+	}
+	return "", goArches[arch], nil
+}
+
+func knownArches() []string {
+	names := make([]string, 0, len(arches))
+	for name := range arches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 var model32 = &cc.Model{
@@ -171,7 +433,7 @@ var model48 = &cc.Model{
 		cc.LongLong:          {8, 8, 8, "int64"},
 		cc.ULongLong:         {8, 8, 8, "uint64"},
 		cc.Float:             {4, 4, 4, "float32"},
-		cc.Double:            {8, 8, 4, "float64"},
+		cc.Double:            {8, 8, 8, "float64"},
 		cc.LongDouble:        {8, 8, 4, "float64"},
 		cc.Bool:              {1, 1, 1, "bool"},
 		cc.FloatComplex:      {8, 8, 8, "complex64"},
@@ -197,7 +459,7 @@ var model64 = &cc.Model{
 		cc.LongLong:          {8, 8, 8, "int64"},
 		cc.ULongLong:         {8, 8, 8, "uint64"},
 		cc.Float:             {4, 4, 4, "float32"},
-		cc.Double:            {8, 8, 4, "float64"},
+		cc.Double:            {8, 8, 8, "float64"},
 		cc.LongDouble:        {8, 8, 4, "float64"},
 		cc.Bool:              {1, 1, 1, "bool"},
 		cc.FloatComplex:      {8, 8, 8, "complex64"},
@@ -205,3 +467,113 @@ var model64 = &cc.Model{
 		cc.LongDoubleComplex: {16, 16, 16, "complex128"},
 	},
 }
+
+// modelLLP64 is the 64-bit Windows model, long stays 32-bit there.
+var modelLLP64 = &cc.Model{
+	Items: map[cc.Kind]cc.ModelItem{
+		cc.Ptr:               {8, 8, 8, "__TODO_PTR"},
+		cc.UintPtr:           {8, 8, 8, "uintptr"},
+		cc.Void:              {0, 1, 1, "__TODO_VOID"},
+		cc.Char:              {1, 1, 1, "int8"},
+		cc.SChar:             {1, 1, 1, "int8"},
+		cc.UChar:             {1, 1, 1, "byte"},
+		cc.Short:             {2, 2, 2, "int16"},
+		cc.UShort:            {2, 2, 2, "uint16"},
+		cc.Int:               {4, 4, 4, "int32"},
+		cc.UInt:              {4, 4, 4, "uint32"},
+		cc.Long:              {4, 4, 4, "int32"},
+		cc.ULong:             {4, 4, 4, "uint32"},
+		cc.LongLong:          {8, 8, 8, "int64"},
+		cc.ULongLong:         {8, 8, 8, "uint64"},
+		cc.Float:             {4, 4, 4, "float32"},
+		cc.Double:            {8, 8, 8, "float64"},
+		cc.LongDouble:        {8, 8, 8, "float64"},
+		cc.Bool:              {1, 1, 1, "bool"},
+		cc.FloatComplex:      {8, 8, 8, "complex64"},
+		cc.DoubleComplex:     {16, 16, 16, "complex128"},
+		cc.LongDoubleComplex: {16, 16, 16, "complex128"},
+	},
+}
+
+// modelArm32 is the ARM EABI model, 64-bit types are 8-byte aligned in structs.
+var modelArm32 = &cc.Model{
+	Items: map[cc.Kind]cc.ModelItem{
+		cc.Ptr:               {4, 4, 4, "__TODO_PTR"},
+		cc.UintPtr:           {4, 4, 4, "uintptr"},
+		cc.Void:              {0, 1, 1, "__TODO_VOID"},
+		cc.Char:              {1, 1, 1, "int8"},
+		cc.SChar:             {1, 1, 1, "int8"},
+		cc.UChar:             {1, 1, 1, "byte"},
+		cc.Short:             {2, 2, 2, "int16"},
+		cc.UShort:            {2, 2, 2, "uint16"},
+		cc.Int:               {4, 4, 4, "int32"},
+		cc.UInt:              {4, 4, 4, "uint32"},
+		cc.Long:              {4, 4, 4, "int32"},
+		cc.ULong:             {4, 4, 4, "uint32"},
+		cc.LongLong:          {8, 8, 8, "int64"},
+		cc.ULongLong:         {8, 8, 8, "uint64"},
+		cc.Float:             {4, 4, 4, "float32"},
+		cc.Double:            {8, 8, 8, "float64"},
+		cc.LongDouble:        {8, 8, 8, "float64"},
+		cc.Bool:              {1, 1, 1, "bool"},
+		cc.FloatComplex:      {8, 8, 8, "complex64"},
+		cc.DoubleComplex:     {16, 16, 16, "complex128"},
+		cc.LongDoubleComplex: {16, 16, 16, "complex128"},
+	},
+}
+
+// model64Quad is the LP64 model of aarch64 and riscv64,
+// where long double is a 128-bit quad.
+var model64Quad = &cc.Model{
+	Items: map[cc.Kind]cc.ModelItem{
+		cc.Ptr:               {8, 8, 8, "__TODO_PTR"},
+		cc.UintPtr:           {8, 8, 8, "uintptr"},
+		cc.Void:              {0, 1, 1, "__TODO_VOID"},
+		cc.Char:              {1, 1, 1, "int8"},
+		cc.SChar:             {1, 1, 1, "int8"},
+		cc.UChar:             {1, 1, 1, "byte"},
+		cc.Short:             {2, 2, 2, "int16"},
+		cc.UShort:            {2, 2, 2, "uint16"},
+		cc.Int:               {4, 4, 4, "int32"},
+		cc.UInt:              {4, 4, 4, "uint32"},
+		cc.Long:              {8, 8, 8, "int64"},
+		cc.ULong:             {8, 8, 8, "uint64"},
+		cc.LongLong:          {8, 8, 8, "int64"},
+		cc.ULongLong:         {8, 8, 8, "uint64"},
+		cc.Float:             {4, 4, 4, "float32"},
+		cc.Double:            {8, 8, 8, "float64"},
+		cc.LongDouble:        {16, 16, 16, "float64"},
+		cc.Bool:              {1, 1, 1, "bool"},
+		cc.FloatComplex:      {8, 8, 8, "complex64"},
+		cc.DoubleComplex:     {16, 16, 16, "complex128"},
+		cc.LongDoubleComplex: {32, 16, 16, "complex128"},
+	},
+}
+
+// modelWasm32 is the ILP32 model of WebAssembly,
+// 64-bit types are 8-byte aligned and long double is a 128-bit quad.
+var modelWasm32 = &cc.Model{
+	Items: map[cc.Kind]cc.ModelItem{
+		cc.Ptr:               {4, 4, 4, "__TODO_PTR"},
+		cc.UintPtr:           {4, 4, 4, "uintptr"},
+		cc.Void:              {0, 1, 1, "__TODO_VOID"},
+		cc.Char:              {1, 1, 1, "int8"},
+		cc.SChar:             {1, 1, 1, "int8"},
+		cc.UChar:             {1, 1, 1, "byte"},
+		cc.Short:             {2, 2, 2, "int16"},
+		cc.UShort:            {2, 2, 2, "uint16"},
+		cc.Int:               {4, 4, 4, "int32"},
+		cc.UInt:              {4, 4, 4, "uint32"},
+		cc.Long:              {4, 4, 4, "int32"},
+		cc.ULong:             {4, 4, 4, "uint32"},
+		cc.LongLong:          {8, 8, 8, "int64"},
+		cc.ULongLong:         {8, 8, 8, "uint64"},
+		cc.Float:             {4, 4, 4, "float32"},
+		cc.Double:            {8, 8, 8, "float64"},
+		cc.LongDouble:        {16, 16, 16, "float64"},
+		cc.Bool:              {1, 1, 1, "bool"},
+		cc.FloatComplex:      {8, 8, 8, "complex64"},
+		cc.DoubleComplex:     {16, 16, 16, "complex128"},
+		cc.LongDoubleComplex: {32, 16, 16, "complex128"},
+	},
+}
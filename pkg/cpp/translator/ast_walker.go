@@ -46,6 +46,7 @@ func (t *Translator) walkExternalDeclaration(d *cc.ExternalDeclaration) {
 		var decl *CDecl
 		if declr := d.FunctionDefinition.Declarator; declr != nil {
 			decl = t.declarator(declr)
+			decl.Doc = t.leadingDoc(d.Pos())
 			t.registerTagsOf(decl)
 		} else {
 			return
@@ -58,7 +59,13 @@ func (t *Translator) walkExternalDeclaration(d *cc.ExternalDeclaration) {
 		t.declares = append(t.declares, decl)
 	case 1: // Declaration
 		declares := t.walkDeclaration(d.Declaration)
+		doc := t.leadingDoc(d.Pos())
 		for _, decl := range declares {
+			if doc != nil {
+				decl.Doc = doc
+			} else if decl.Spec.Kind() != FunctionKind {
+				decl.Doc = t.trailingDoc(decl.Pos)
+			}
 			if decl.IsTypedef {
 				t.typedefs = append(t.typedefs, decl)
 				t.typedefsSet[decl.Name] = struct{}{}
@@ -137,6 +144,7 @@ func (t *Translator) enumSpec(base *CTypeSpec, typ cc.Type) *CEnumSpec {
 		m := &CDecl{
 			Name: name,
 			Pos:  en.DefTok.Pos(),
+			Doc:  t.declDoc(en.DefTok.Pos()),
 		}
 		switch {
 		case en.Value == nil:
@@ -247,15 +255,25 @@ func (t *Translator) structSpec(base *CTypeSpec, typ cc.Type, deep int) *CStruct
 		return spec
 	}
 	members, _ := typ.Members()
+	bitFields := t.bitFieldLayout(tag, members, spec.IsUnion)
 	for i, m := range members {
+		var bitField *CBitField
+		if isBitField(m) {
+			if bitField = bitFields[i]; bitField == nil {
+				// unnamed bitfields are padding
+				continue
+			}
+		}
 		var pos token.Pos
 		if m.Declarator != nil {
 			pos = m.Declarator.Pos()
 		}
 		spec.Members = append(spec.Members, &CDecl{
-			Name: memberName(i, m),
-			Spec: t.typeSpec(m.Type, deep+1, false),
-			Pos:  pos,
+			Name:     memberName(i, m),
+			Spec:     t.typeSpec(m.Type, deep+1, false),
+			Pos:      pos,
+			Doc:      t.declDoc(pos),
+			BitField: bitField,
 		})
 	}
 	return spec
@@ -282,6 +300,7 @@ func (t *Translator) functionSpec(base *CTypeSpec, typ cc.Type, deep int) *CFunc
 			Name: paramName(i, p),
 			Spec: t.typeSpec(p.Type, deep+1, false),
 			Pos:  p.Declarator.Pos(),
+			Doc:  t.trailingDoc(p.Declarator.Pos()),
 		})
 	}
 	return spec
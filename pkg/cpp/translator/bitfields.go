@@ -0,0 +1,152 @@
+package translator
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"go/token"
+
+	"github.com/bhojpur/build/pkg/cpp/diag"
+	"modernc.org/cc"
+)
+
+// CBitField describes where a bitfield member is stored: Width bits at the bit Shift
+// of the Size bytes long storage unit that starts at the byte Offset of the struct.
+type CBitField struct {
+	Offset int `json:"offset"`
+	Size   int `json:"size"`
+	Shift  int `json:"shift"`
+	Width  int `json:"width"`
+}
+
+// Mask returns the mask of the bitfield value before it's shifted into place.
+func (b *CBitField) Mask() uint64 {
+	if b.Width >= 64 {
+		return ^uint64(0)
+	}
+	return 1<<uint(b.Width) - 1
+}
+
+// isBitField reports whether a struct member is declared with a width.
+// The zero-width bitfields have no declarator and no bits, but still affect the layout.
+func isBitField(m cc.Member) bool {
+	return m.Bits > 0 || m.Declarator == nil
+}
+
+// bitFieldLayout places the bitfields of a struct the way the C compiler of the target does,
+// cc's own grouping of bitfields doesn't follow the psABI rules so it can't be used for that.
+// The result has an entry for every member, it's nil for the members that are not bitfields.
+func (t *Translator) bitFieldLayout(tag string, members []cc.Member, isUnion bool) []*CBitField {
+	var hasBits bool
+	for _, m := range members {
+		if isBitField(m) {
+			hasBits = true
+			break
+		}
+	}
+	if !hasBits {
+		return nil
+	}
+	// MinGW follows MSVC and packs bitfields into units of their declared type
+	msvc := t.arch == "x86_64-windows"
+	layout := make([]*CBitField, len(members))
+
+	var (
+		pos       int // in bits, the end of the laid out members
+		unitStart int // in bits, the start of the open MSVC unit
+		unitUsed  int // in bits, taken in the open MSVC unit
+		unitSize  int // in bytes, the size of the open MSVC unit, 0 if none is open
+	)
+	for i, m := range members {
+		size := m.Type.SizeOf()
+		align := m.Type.StructAlignOf()
+		if align <= 0 {
+			align = 1
+		}
+		if isUnion {
+			pos = 0
+		}
+		if !isBitField(m) {
+			unitSize = 0
+			pos = alignBits(pos, align*8) + size*8
+			continue
+		}
+		if m.Bits == 0 {
+			// a zero-width bitfield aligns the next one to its type
+			unitSize = 0
+			pos = alignBits(pos, align*8)
+			continue
+		}
+		var bitPos int
+		switch {
+		case msvc && unitSize == size && unitUsed+m.Bits <= size*8:
+			bitPos = unitStart + unitUsed
+			unitUsed += m.Bits
+		case msvc:
+			unitStart = alignBits(pos, align*8)
+			unitSize, unitUsed = size, m.Bits
+			bitPos = unitStart
+			pos = unitStart + size*8
+		default:
+			bitPos = pos
+			if bitPos/(align*8) != (bitPos+m.Bits-1)/(align*8) {
+				// a bitfield never straddles a unit of its declared type
+				bitPos = alignBits(bitPos, align*8)
+			}
+			pos = bitPos + m.Bits
+		}
+		if m.Name == 0 {
+			continue
+		}
+		if unit := storageUnit(bitPos, m.Bits); unit != nil {
+			layout[i] = unit
+		} else {
+			var pos token.Pos
+			if m.Declarator != nil {
+				pos = m.Declarator.Pos()
+			}
+			t.warn(pos, diag.CodeBitField, "bitfield %s.%s does not fit into a storage unit, skipping", tag, memberName(i, m))
+		}
+	}
+	return layout
+}
+
+// storageUnit finds the smallest naturally aligned unit that holds the bits.
+func storageUnit(pos, width int) *CBitField {
+	for size := 1; size <= 8; size *= 2 {
+		start := pos / (size * 8) * size
+		if pos+width <= (start+size)*8 {
+			return &CBitField{
+				Offset: start,
+				Size:   size,
+				Shift:  pos - start*8,
+				Width:  width,
+			}
+		}
+	}
+	return nil
+}
+
+func alignBits(pos, align int) int {
+	if r := pos % align; r != 0 {
+		return pos + align - r
+	}
+	return pos
+}
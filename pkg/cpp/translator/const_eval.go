@@ -0,0 +1,1046 @@
+package translator
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"modernc.org/cc"
+	"modernc.org/xc"
+)
+
+// evalType is a C arithmetic type as seen by the constant evaluator.
+type evalType struct {
+	Float    bool
+	Unsigned bool
+	Size     int
+}
+
+var (
+	evalInt       = evalType{Size: 4}
+	evalUint      = evalType{Size: 4, Unsigned: true}
+	evalLongLong  = evalType{Size: 8}
+	evalUlongLong = evalType{Size: 8, Unsigned: true}
+	evalFloat     = evalType{Size: 4, Float: true}
+	evalDouble    = evalType{Size: 8, Float: true}
+)
+
+// evalStdTypes lists the sizes of the well-known typedefs that are
+// often used in casts within macros, these are used when the headers
+// that declare them haven't been parsed.
+var evalStdTypes = map[string]evalType{
+	"int8_t":   {Size: 1},
+	"uint8_t":  {Size: 1, Unsigned: true},
+	"int16_t":  {Size: 2},
+	"uint16_t": {Size: 2, Unsigned: true},
+	"int32_t":  {Size: 4},
+	"uint32_t": {Size: 4, Unsigned: true},
+	"int64_t":  {Size: 8},
+	"uint64_t": {Size: 8, Unsigned: true},
+}
+
+// evalCgoTypes lists the short names cgo has for the builtin types,
+// such as C.uint, these are accepted in the type tips of macros as well.
+var evalCgoTypes = map[string]CTypeSpec{
+	"schar":     {Base: "char", Signed: true},
+	"uchar":     {Base: "char", Unsigned: true},
+	"ushort":    {Base: "short", Unsigned: true},
+	"uint":      {Base: "int", Unsigned: true},
+	"ulong":     {Base: "long", Unsigned: true},
+	"longlong":  {Base: "long", Long: true},
+	"ulonglong": {Base: "long", Long: true, Unsigned: true},
+}
+
+// evalPtrTypes lists the well-known typedefs that have the size of a pointer,
+// the value tells whether the type is unsigned.
+var evalPtrTypes = map[string]bool{
+	"intptr_t":  false,
+	"uintptr_t": true,
+	"ptrdiff_t": false,
+	"size_t":    true,
+	"ssize_t":   false,
+}
+
+// evalValue is a value of a C constant expression along with its type.
+// Integers are kept as two's complement bits truncated to the type size.
+type evalValue struct {
+	Type evalType
+	Int  uint64
+	Flt  float64
+}
+
+func (v evalValue) isZero() bool {
+	if v.Type.Float {
+		return v.Flt == 0
+	}
+	return v.Int == 0
+}
+
+func (v evalValue) signed() int64 {
+	return int64(v.Int)
+}
+
+func (v evalValue) float() float64 {
+	switch {
+	case v.Type.Float:
+		return v.Flt
+	case v.Type.Unsigned:
+		return float64(v.Int)
+	default:
+		return float64(int64(v.Int))
+	}
+}
+
+// convert casts the value to the given type using C conversion rules.
+func (v evalValue) convert(typ evalType) evalValue {
+	if typ.Float {
+		f := v.float()
+		if typ.Size == 4 {
+			f = float64(float32(f))
+		}
+		return evalValue{Type: typ, Flt: f}
+	}
+	var bits uint64
+	switch {
+	case !v.Type.Float:
+		bits = v.Int
+	case v.Flt < 0:
+		bits = uint64(int64(v.Flt))
+	default:
+		bits = uint64(v.Flt)
+	}
+	return evalValue{Type: typ, Int: truncBits(bits, typ)}
+}
+
+func truncBits(bits uint64, typ evalType) uint64 {
+	if typ.Size >= 8 {
+		return bits
+	}
+	width := uint(typ.Size * 8)
+	bits &= 1<<width - 1
+	if !typ.Unsigned && bits&(1<<(width-1)) != 0 {
+		// sign extension
+		bits |= ^uint64(0) << width
+	}
+	return bits
+}
+
+// promote applies the integer promotions.
+func promote(typ evalType) evalType {
+	if !typ.Float && typ.Size < 4 {
+		return evalInt
+	}
+	return typ
+}
+
+// commonType returns the type of the usual arithmetic conversions.
+func commonType(a, b evalType) evalType {
+	a, b = promote(a), promote(b)
+	switch {
+	case a.Float || b.Float:
+		if a.Float && b.Float && a.Size == 4 && b.Size == 4 {
+			return evalFloat
+		}
+		return evalDouble
+	case a.Unsigned == b.Unsigned:
+		if a.Size >= b.Size {
+			return a
+		}
+		return b
+	case a.Unsigned && a.Size >= b.Size:
+		return a
+	case b.Unsigned && b.Size >= a.Size:
+		return b
+	case a.Unsigned:
+		return b
+	default:
+		return a
+	}
+}
+
+// GoString returns the Go constant literal for the value. The C default types
+// for literals (int and double) are written untyped, others are wrapped into
+// the corresponding Go type conversion.
+func (v evalValue) GoString() (string, error) {
+	if v.Type.Float {
+		if math.IsInf(v.Flt, 0) || math.IsNaN(v.Flt) {
+			return "", fmt.Errorf("value %v is not representable as a Go constant", v.Flt)
+		}
+		str := strconv.FormatFloat(v.Flt, 'g', -1, v.Type.Size*8)
+		if !strings.ContainsAny(str, ".e") {
+			str += ".0"
+		}
+		if v.Type.Size == 4 {
+			return v.Type.GoType() + "(" + str + ")", nil
+		}
+		return str, nil
+	}
+	var str string
+	if v.Type.Unsigned {
+		str = strconv.FormatUint(v.Int, 10)
+	} else {
+		str = strconv.FormatInt(v.signed(), 10)
+	}
+	if v.Type == evalInt {
+		return str, nil
+	}
+	return v.Type.GoType() + "(" + str + ")", nil
+}
+
+// GoType returns the name of the Go type with the same size and representation.
+func (typ evalType) GoType() string {
+	if typ.Float {
+		return fmt.Sprintf("float%d", typ.Size*8)
+	} else if typ.Unsigned {
+		return fmt.Sprintf("uint%d", typ.Size*8)
+	}
+	return fmt.Sprintf("int%d", typ.Size*8)
+}
+
+type evalToken struct {
+	Kind rune
+	Src  string
+}
+
+// constEvaluator evaluates the replacement lists of object-like macros as C constant expressions.
+type constEvaluator struct {
+	t        *Translator
+	long     evalType
+	ulong    evalType
+	ptr      evalType
+	char     evalType
+	macros   map[string]*cc.Macro
+	enums    map[string]Value
+	typedefs map[string]*CDecl
+	results  map[string]evalValue
+	errs     map[string]error
+	busy     map[string]bool
+}
+
+func newConstEvaluator(t *Translator, defines map[int]*cc.Macro) *constEvaluator {
+	long, ptr := t.LongSize(), t.PointerSize()
+	e := &constEvaluator{
+		t:        t,
+		long:     evalType{Size: long},
+		ulong:    evalType{Size: long, Unsigned: true},
+		ptr:      evalType{Size: ptr, Unsigned: true},
+		char:     evalType{Size: 1},
+		macros:   make(map[string]*cc.Macro, len(defines)),
+		enums:    t.valueMap,
+		typedefs: make(map[string]*CDecl, len(t.typedefs)),
+		results:  make(map[string]evalValue),
+		errs:     make(map[string]error),
+		busy:     make(map[string]bool),
+	}
+	for _, macro := range defines {
+		e.macros[string(macro.DefTok.S())] = macro
+	}
+	if _, ok := e.macros["__CHAR_UNSIGNED__"]; ok {
+		// plain char is unsigned on ARM and RISC-V
+		e.char.Unsigned = true
+	}
+	for _, decl := range t.typedefs {
+		e.typedefs[decl.Name] = decl
+	}
+	return e
+}
+
+// Eval evaluates the named macro, the result is cached because macros reference each other.
+func (e *constEvaluator) Eval(name string) (evalValue, error) {
+	if v, ok := e.results[name]; ok {
+		return v, nil
+	} else if err, ok := e.errs[name]; ok {
+		return evalValue{}, err
+	}
+	macro, ok := e.macros[name]
+	if !ok {
+		return evalValue{}, fmt.Errorf("undefined identifier %s", name)
+	} else if macro.IsFnLike {
+		return evalValue{}, fmt.Errorf("%s is a function-like macro", name)
+	} else if e.busy[name] {
+		return evalValue{}, fmt.Errorf("%s references itself", name)
+	}
+	e.busy[name] = true
+	v, err := e.evalTokens(macro.ReplacementToks())
+	delete(e.busy, name)
+	if err != nil {
+		e.errs[name] = err
+		return evalValue{}, err
+	}
+	e.results[name] = v
+	return v, nil
+}
+
+func (e *constEvaluator) evalTokens(tokens []xc.Token) (evalValue, error) {
+	if len(tokens) == 0 {
+		return evalValue{}, errors.New("empty replacement list")
+	}
+	list, err := evalTokenize(tokens)
+	if err != nil {
+		return evalValue{}, err
+	}
+	p := &evalParser{e: e, toks: list}
+	v, err := p.expr()
+	if err != nil {
+		return evalValue{}, err
+	} else if p.pos < len(p.toks) {
+		return evalValue{}, fmt.Errorf("unexpected %q", p.toks[p.pos].Src)
+	}
+	return v, nil
+}
+
+// evalTokenize converts the tokens of a replacement list, keywords and identifiers
+// become IDENTIFIER tokens and punctuators have zero kind.
+func evalTokenize(tokens []xc.Token) ([]evalToken, error) {
+	list := make([]evalToken, 0, len(tokens))
+	for _, token := range tokens {
+		src := cc.TokSrc(token)
+		switch token.Rune {
+		case cc.INTCONST, cc.FLOATCONST, cc.CHARCONST, cc.LONGCHARCONST:
+			list = append(list, evalToken{Kind: token.Rune, Src: src})
+		case cc.STRINGLITERAL, cc.LONGSTRINGLITERAL:
+			return nil, errors.New("string literals are not arithmetic constants")
+		default:
+			if isWord(src) {
+				list = append(list, evalToken{Kind: cc.IDENTIFIER, Src: src})
+				continue
+			}
+			list = append(list, evalToken{Src: src})
+		}
+	}
+	return list, nil
+}
+
+func isWord(src string) bool {
+	if len(src) == 0 {
+		return false
+	}
+	r := src[0]
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+// evalParser is a recursive descent parser over the macro tokens that
+// evaluates the expression while parsing it.
+type evalParser struct {
+	e    *constEvaluator
+	toks []evalToken
+	pos  int
+	// dead is non-zero while parsing a branch that is not evaluated,
+	// such as the right operand of 0 && x, so errors like a division
+	// by zero there don't count.
+	dead int
+}
+
+func (p *evalParser) peek() evalToken {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return evalToken{}
+}
+
+func (p *evalParser) peekAt(n int) evalToken {
+	if p.pos+n < len(p.toks) {
+		return p.toks[p.pos+n]
+	}
+	return evalToken{}
+}
+
+func (p *evalParser) accept(src string) bool {
+	if tok := p.peek(); tok.Kind == 0 && tok.Src == src {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *evalParser) expect(src string) error {
+	if !p.accept(src) {
+		if p.pos >= len(p.toks) {
+			return fmt.Errorf("expected %q, got end of expression", src)
+		}
+		return fmt.Errorf("expected %q, got %q", src, p.peek().Src)
+	}
+	return nil
+}
+
+func (p *evalParser) expr() (evalValue, error) {
+	cond, err := p.binary(1)
+	if err != nil {
+		return evalValue{}, err
+	}
+	if !p.accept("?") {
+		return cond, nil
+	}
+	pick := !cond.isZero()
+	if !pick {
+		p.dead++
+	}
+	a, err := p.expr()
+	if !pick {
+		p.dead--
+	}
+	if err != nil {
+		return evalValue{}, err
+	}
+	if err := p.expect(":"); err != nil {
+		return evalValue{}, err
+	}
+	if pick {
+		p.dead++
+	}
+	b, err := p.expr()
+	if pick {
+		p.dead--
+	}
+	if err != nil {
+		return evalValue{}, err
+	}
+	typ := commonType(a.Type, b.Type)
+	if pick {
+		return a.convert(typ), nil
+	}
+	return b.convert(typ), nil
+}
+
+// sizeType returns the type of size_t.
+func (e *constEvaluator) sizeType() evalType {
+	return evalType{Size: e.ptr.Size, Unsigned: true}
+}
+
+var evalPrecedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"|":  3,
+	"^":  4,
+	"&":  5,
+	"==": 6, "!=": 6,
+	"<": 7, ">": 7, "<=": 7, ">=": 7,
+	"<<": 8, ">>": 8,
+	"+": 9, "-": 9,
+	"*": 10, "/": 10, "%": 10,
+}
+
+func (p *evalParser) binary(minPrec int) (evalValue, error) {
+	x, err := p.unary()
+	if err != nil {
+		return evalValue{}, err
+	}
+	for {
+		tok := p.peek()
+		prec, ok := evalPrecedence[tok.Src]
+		if tok.Kind != 0 || !ok || prec < minPrec {
+			return x, nil
+		}
+		p.pos++
+		// short-circuit operators don't evaluate the right operand
+		skip := (tok.Src == "&&" && x.isZero()) || (tok.Src == "||" && !x.isZero())
+		if skip {
+			p.dead++
+		}
+		y, err := p.binary(prec + 1)
+		if skip {
+			p.dead--
+		}
+		if err != nil {
+			return evalValue{}, err
+		}
+		if x, err = p.apply(tok.Src, x, y); err != nil {
+			return evalValue{}, err
+		}
+	}
+}
+
+func boolValue(v bool) evalValue {
+	if v {
+		return evalValue{Type: evalInt, Int: 1}
+	}
+	return evalValue{Type: evalInt}
+}
+
+func (p *evalParser) apply(op string, x, y evalValue) (evalValue, error) {
+	switch op {
+	case "&&":
+		return boolValue(!x.isZero() && !y.isZero()), nil
+	case "||":
+		return boolValue(!x.isZero() || !y.isZero()), nil
+	case "<<", ">>":
+		if x.Type.Float || y.Type.Float {
+			return evalValue{}, fmt.Errorf("invalid operands to %s", op)
+		}
+		typ := promote(x.Type)
+		x = x.convert(typ)
+		count := y.signed()
+		if y.Type.Unsigned {
+			count = int64(y.Int & math.MaxInt64)
+		}
+		if count < 0 || count >= int64(typ.Size*8) {
+			if p.dead > 0 {
+				return evalValue{Type: typ}, nil
+			}
+			return evalValue{}, fmt.Errorf("shift count %d is out of range for a %d-bit operand", count, typ.Size*8)
+		}
+		if op == "<<" {
+			return evalValue{Type: typ, Int: truncBits(x.Int<<uint(count), typ)}, nil
+		}
+		if typ.Unsigned {
+			return evalValue{Type: typ, Int: x.Int >> uint(count)}, nil
+		}
+		return evalValue{Type: typ, Int: uint64(x.signed() >> uint(count))}, nil
+	}
+
+	typ := commonType(x.Type, y.Type)
+	x, y = x.convert(typ), y.convert(typ)
+	switch op {
+	case "==", "!=", "<", ">", "<=", ">=":
+		var cmp int
+		switch {
+		case typ.Float:
+			cmp = compareFloat(x.Flt, y.Flt)
+		case typ.Unsigned:
+			cmp = compareUint(x.Int, y.Int)
+		default:
+			cmp = compareInt(x.signed(), y.signed())
+		}
+		switch op {
+		case "==":
+			return boolValue(cmp == 0), nil
+		case "!=":
+			return boolValue(cmp != 0), nil
+		case "<":
+			return boolValue(cmp < 0), nil
+		case ">":
+			return boolValue(cmp > 0), nil
+		case "<=":
+			return boolValue(cmp <= 0), nil
+		default:
+			return boolValue(cmp >= 0), nil
+		}
+	}
+	if typ.Float {
+		var f float64
+		switch op {
+		case "+":
+			f = x.Flt + y.Flt
+		case "-":
+			f = x.Flt - y.Flt
+		case "*":
+			f = x.Flt * y.Flt
+		case "/":
+			if y.Flt == 0 && p.dead == 0 {
+				return evalValue{}, errors.New("division by zero")
+			}
+			f = x.Flt / y.Flt
+		default:
+			return evalValue{}, fmt.Errorf("invalid operands to %s", op)
+		}
+		return evalValue{Type: typ}.convertFloat(f), nil
+	}
+	var r uint64
+	switch op {
+	case "+":
+		r = x.Int + y.Int
+	case "-":
+		r = x.Int - y.Int
+	case "*":
+		r = x.Int * y.Int
+	case "/", "%":
+		if y.Int == 0 {
+			if p.dead > 0 {
+				return evalValue{Type: typ}, nil
+			}
+			return evalValue{}, errors.New("division by zero")
+		}
+		switch {
+		case typ.Unsigned && op == "/":
+			r = x.Int / y.Int
+		case typ.Unsigned:
+			r = x.Int % y.Int
+		case op == "/":
+			r = uint64(x.signed() / y.signed())
+		default:
+			r = uint64(x.signed() % y.signed())
+		}
+	case "&":
+		r = x.Int & y.Int
+	case "|":
+		r = x.Int | y.Int
+	case "^":
+		r = x.Int ^ y.Int
+	}
+	return evalValue{Type: typ, Int: truncBits(r, typ)}, nil
+}
+
+func (v evalValue) convertFloat(f float64) evalValue {
+	if v.Type.Size == 4 {
+		f = float64(float32(f))
+	}
+	v.Flt = f
+	return v
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func (p *evalParser) unary() (evalValue, error) {
+	tok := p.peek()
+	if tok.Kind == cc.IDENTIFIER && tok.Src == "sizeof" {
+		p.pos++
+		return p.sizeof()
+	}
+	if tok.Kind != 0 {
+		return p.primary()
+	}
+	switch tok.Src {
+	case "+", "-", "~", "!":
+		p.pos++
+		x, err := p.unary()
+		if err != nil {
+			return evalValue{}, err
+		}
+		if tok.Src == "!" {
+			return boolValue(x.isZero()), nil
+		}
+		x = x.convert(promote(x.Type))
+		switch tok.Src {
+		case "-":
+			if x.Type.Float {
+				return x.convertFloat(-x.Flt), nil
+			}
+			x.Int = truncBits(-x.Int, x.Type)
+		case "~":
+			if x.Type.Float {
+				return evalValue{}, errors.New("invalid operand to ~")
+			}
+			x.Int = truncBits(^x.Int, x.Type)
+		}
+		return x, nil
+	case "(":
+		if p.isTypeName(p.peekAt(1)) {
+			p.pos++
+			typ, err := p.typeName()
+			if err != nil {
+				return evalValue{}, err
+			}
+			if err := p.expect(")"); err != nil {
+				return evalValue{}, err
+			}
+			x, err := p.unary()
+			if err != nil {
+				return evalValue{}, err
+			}
+			return x.convert(typ), nil
+		}
+	}
+	return p.primary()
+}
+
+func (p *evalParser) sizeof() (evalValue, error) {
+	if p.peek().Src == "(" && p.isTypeName(p.peekAt(1)) {
+		p.pos++
+		typ, err := p.typeName()
+		if err != nil {
+			return evalValue{}, err
+		}
+		if err := p.expect(")"); err != nil {
+			return evalValue{}, err
+		}
+		return evalValue{Type: p.e.sizeType(), Int: uint64(typ.Size)}, nil
+	}
+	x, err := p.unary()
+	if err != nil {
+		return evalValue{}, err
+	}
+	return evalValue{Type: p.e.sizeType(), Int: uint64(x.Type.Size)}, nil
+}
+
+var evalTypeKeywords = map[string]bool{
+	"char": true, "short": true, "int": true, "long": true,
+	"signed": true, "unsigned": true, "float": true, "double": true,
+	"_Bool": true, "const": true, "volatile": true, "void": true,
+}
+
+func (p *evalParser) isTypeName(tok evalToken) bool {
+	if tok.Kind != cc.IDENTIFIER {
+		return false
+	} else if evalTypeKeywords[tok.Src] {
+		return true
+	} else if _, ok := p.e.macros[tok.Src]; ok {
+		return false
+	}
+	if _, ok := p.e.typedefs[tok.Src]; ok {
+		return true
+	} else if _, ok := evalPtrTypes[tok.Src]; ok {
+		return true
+	} else if _, ok := evalCgoTypes[tok.Src]; ok {
+		return true
+	}
+	_, ok := evalStdTypes[tok.Src]
+	return ok
+}
+
+// typeName reads a type name of a cast or sizeof and returns its arithmetic type.
+func (p *evalParser) typeName() (evalType, error) {
+	var base, named string
+	var unsigned, signed, short bool
+	var longs int
+	for tok := p.peek(); tok.Kind == cc.IDENTIFIER; tok = p.peek() {
+		switch tok.Src {
+		case "const", "volatile":
+		case "unsigned":
+			unsigned = true
+		case "signed":
+			signed = true
+		case "short":
+			short = true
+		case "long":
+			longs++
+		case "char", "int", "float", "double", "_Bool", "void":
+			base = tok.Src
+		default:
+			if len(base) > 0 || len(named) > 0 || unsigned || signed || short || longs > 0 {
+				return evalType{}, fmt.Errorf("unexpected %q in type name", tok.Src)
+			}
+			named = tok.Src
+		}
+		p.pos++
+	}
+	var pointers int
+	for p.accept("*") {
+		pointers++
+	}
+	switch {
+	case pointers > 0:
+		return p.e.ptr, nil
+	case len(named) > 0:
+		return p.e.namedType(named, 0)
+	}
+	return p.e.specType(CTypeSpec{
+		Base:     base,
+		Unsigned: unsigned,
+		Signed:   signed,
+		Long:     longs > 0,
+		Short:    short,
+	}, longs)
+}
+
+// namedType resolves a typedef name into an arithmetic type.
+func (e *constEvaluator) namedType(name string, depth int) (evalType, error) {
+	if decl, ok := e.typedefs[name]; ok && depth < 16 {
+		spec, ok := decl.Spec.(*CTypeSpec)
+		if !ok {
+			return evalType{}, fmt.Errorf("%s is not an arithmetic type", name)
+		} else if spec.Pointers > 0 {
+			return e.ptr, nil
+		} else if len(spec.OuterArr) > 0 || len(spec.InnerArr) > 0 {
+			return evalType{}, fmt.Errorf("%s is an array type", name)
+		}
+		if typ, err := e.specType(*spec, specLongs(*spec)); err == nil {
+			return typ, nil
+		}
+		return e.namedType(spec.Base, depth+1)
+	}
+	if typ, ok := evalStdTypes[name]; ok {
+		return typ, nil
+	} else if spec, ok := evalCgoTypes[name]; ok {
+		return e.specType(spec, specLongs(spec))
+	} else if unsigned, ok := evalPtrTypes[name]; ok {
+		return evalType{Size: e.ptr.Size, Unsigned: unsigned}, nil
+	}
+	return evalType{}, fmt.Errorf("unknown type %s", name)
+}
+
+// specLongs returns the number of long keywords in a type specifier.
+func specLongs(spec CTypeSpec) int {
+	longs := 0
+	if spec.Long {
+		longs = 1
+	}
+	if spec.Base == "long" {
+		longs++
+	}
+	return longs
+}
+
+// specType returns the arithmetic type of a builtin type specifier,
+// longs is the number of long keywords in it.
+func (e *constEvaluator) specType(spec CTypeSpec, longs int) (evalType, error) {
+	switch spec.Base {
+	case "char":
+		if !spec.Signed && !spec.Unsigned {
+			return e.char, nil
+		}
+		return evalType{Size: 1, Unsigned: spec.Unsigned}, nil
+	case "_Bool":
+		return evalType{Size: 1, Unsigned: true}, nil
+	case "short":
+		return evalType{Size: 2, Unsigned: spec.Unsigned}, nil
+	case "float":
+		return evalFloat, nil
+	case "double":
+		// long double is not supported in Go, treated as double
+		return evalDouble, nil
+	case "void":
+		return evalType{}, errors.New("void is not an arithmetic type")
+	case "int", "long", "":
+		if spec.Base == "" && longs == 0 && !spec.Unsigned && !spec.Signed && !spec.Short {
+			return evalType{}, errors.New("incomplete type name")
+		}
+		switch {
+		case spec.Short:
+			return evalType{Size: 2, Unsigned: spec.Unsigned}, nil
+		case longs > 1:
+			return evalType{Size: evalLongLong.Size, Unsigned: spec.Unsigned}, nil
+		case longs == 1:
+			return evalType{Size: e.long.Size, Unsigned: spec.Unsigned}, nil
+		}
+		return evalType{Size: 4, Unsigned: spec.Unsigned}, nil
+	}
+	return evalType{}, fmt.Errorf("unknown type %s", spec.Base)
+}
+
+func (p *evalParser) primary() (evalValue, error) {
+	tok := p.peek()
+	p.pos++
+	switch tok.Kind {
+	case cc.INTCONST:
+		return parseIntConst(tok.Src, p.e.long.Size)
+	case cc.FLOATCONST:
+		return parseFloatConst(tok.Src)
+	case cc.CHARCONST, cc.LONGCHARCONST:
+		return parseCharConst(tok.Src, p.e.char)
+	case cc.IDENTIFIER:
+		if v, ok := p.e.enums[tok.Src]; ok {
+			return valueOf(v)
+		}
+		if _, ok := p.e.macros[tok.Src]; !ok && p.dead > 0 {
+			// C treats unknown identifiers as zero only in #if, but
+			// an unevaluated branch doesn't need a value at all
+			return evalValue{Type: evalInt}, nil
+		}
+		v, err := p.e.Eval(tok.Src)
+		if err != nil {
+			if _, ok := p.e.macros[tok.Src]; ok {
+				return evalValue{}, fmt.Errorf("%s: %v", tok.Src, err)
+			}
+			return evalValue{}, err
+		}
+		return v, nil
+	}
+	switch tok.Src {
+	case "(":
+		v, err := p.expr()
+		if err != nil {
+			return evalValue{}, err
+		}
+		if err := p.expect(")"); err != nil {
+			return evalValue{}, err
+		}
+		return v, nil
+	case "":
+		return evalValue{}, errors.New("unexpected end of expression")
+	}
+	return evalValue{}, fmt.Errorf("unexpected %q", tok.Src)
+}
+
+// valueOf converts a value computed by cc into an evalValue.
+func valueOf(v Value) (evalValue, error) {
+	switch x := v.(type) {
+	case int32:
+		return evalValue{Type: evalInt, Int: uint64(int64(x))}, nil
+	case uint32:
+		return evalValue{Type: evalUint, Int: uint64(x)}, nil
+	case int64:
+		return evalValue{Type: evalLongLong, Int: uint64(x)}, nil
+	case uint64:
+		return evalValue{Type: evalUlongLong, Int: x}, nil
+	case int:
+		return evalValue{Type: evalInt, Int: truncBits(uint64(x), evalInt)}, nil
+	case float32:
+		return evalValue{Type: evalFloat, Flt: float64(x)}, nil
+	case float64:
+		return evalValue{Type: evalDouble, Flt: x}, nil
+	}
+	return evalValue{}, fmt.Errorf("unsupported value %v", v)
+}
+
+// parseIntConst parses an integer literal and picks its type
+// according to the suffix and the value, like a C compiler does.
+func parseIntConst(src string, longSize int) (evalValue, error) {
+	evalLong := evalType{Size: longSize}
+	evalUlong := evalType{Size: longSize, Unsigned: true}
+	lit := strings.ToLower(src)
+	var unsigned bool
+	var longs int
+	for len(lit) > 0 {
+		switch lit[len(lit)-1] {
+		case 'u':
+			unsigned = true
+		case 'l':
+			longs++
+		default:
+			goto done
+		}
+		lit = lit[:len(lit)-1]
+	}
+done:
+	var n uint64
+	var err error
+	switch {
+	case strings.HasPrefix(lit, "0x"):
+		n, err = strconv.ParseUint(lit[2:], 16, 64)
+	case strings.HasPrefix(lit, "0b"):
+		n, err = strconv.ParseUint(lit[2:], 2, 64)
+	case len(lit) > 1 && lit[0] == '0':
+		n, err = strconv.ParseUint(lit[1:], 8, 64)
+	default:
+		n, err = strconv.ParseUint(lit, 10, 64)
+	}
+	if err != nil {
+		return evalValue{}, fmt.Errorf("invalid integer constant %s", src)
+	}
+	decimal := !strings.HasPrefix(lit, "0") || lit == "0"
+	candidates := []evalType{evalInt, evalUint, evalLong, evalUlong, evalLongLong, evalUlongLong}
+	if longs == 1 {
+		candidates = candidates[2:]
+	} else if longs > 1 {
+		candidates = candidates[4:]
+	}
+	for _, typ := range candidates {
+		if unsigned && !typ.Unsigned {
+			continue
+		} else if decimal && !unsigned && typ.Unsigned {
+			// decimal literals without suffix are never unsigned
+			continue
+		}
+		max := uint64(1)<<uint(typ.Size*8-1) - 1
+		if typ.Unsigned {
+			max = max<<1 | 1
+		}
+		if n <= max {
+			return evalValue{Type: typ, Int: n}, nil
+		}
+	}
+	if decimal && !unsigned {
+		return evalValue{}, fmt.Errorf("integer constant %s is too large", src)
+	}
+	return evalValue{Type: evalUlongLong, Int: n}, nil
+}
+
+func parseFloatConst(src string) (evalValue, error) {
+	lit := strings.ToLower(src)
+	typ := evalDouble
+	isHex := strings.HasPrefix(lit, "0x")
+	switch {
+	case strings.HasSuffix(lit, "f") && !isHex:
+		typ = evalFloat
+		lit = lit[:len(lit)-1]
+	case strings.HasSuffix(lit, "l"):
+		lit = lit[:len(lit)-1]
+	case isHex && strings.HasSuffix(lit, "f") && strings.Contains(lit, "p"):
+		typ = evalFloat
+		lit = lit[:len(lit)-1]
+	}
+	f, err := strconv.ParseFloat(lit, 64)
+	if err != nil {
+		return evalValue{}, fmt.Errorf("invalid floating constant %s", src)
+	}
+	return evalValue{Type: typ}.convertFloat(f), nil
+}
+
+var charEscapes = map[byte]uint64{
+	'n': '\n', 't': '\t', 'r': '\r', '0': 0, 'a': '\a', 'b': '\b',
+	'f': '\f', 'v': '\v', '\\': '\\', '\'': '\'', '"': '"', '?': '?',
+}
+
+// parseCharConst parses a character constant, these have type int in C
+// (wchar_t for the L prefix, that is treated as int too), char is the type
+// of plain char on the target.
+func parseCharConst(src string, char evalType) (evalValue, error) {
+	lit := strings.TrimPrefix(src, "L")
+	if len(lit) < 3 || lit[0] != '\'' || lit[len(lit)-1] != '\'' {
+		return evalValue{}, fmt.Errorf("invalid character constant %s", src)
+	}
+	body := lit[1 : len(lit)-1]
+	var c uint64
+	switch {
+	case body[0] != '\\':
+		r := []rune(body)
+		if len(r) != 1 {
+			return evalValue{}, fmt.Errorf("multi-character constant %s is not supported", src)
+		}
+		c = uint64(r[0])
+	case len(body) > 2 && body[1] == 'x':
+		n, err := strconv.ParseUint(body[2:], 16, 32)
+		if err != nil {
+			return evalValue{}, fmt.Errorf("invalid character constant %s", src)
+		}
+		c = n
+	case len(body) > 1 && body[1] >= '0' && body[1] <= '7':
+		n, err := strconv.ParseUint(body[1:], 8, 32)
+		if err != nil {
+			return evalValue{}, fmt.Errorf("invalid character constant %s", src)
+		}
+		c = n
+	case len(body) == 2:
+		v, ok := charEscapes[body[1]]
+		if !ok {
+			return evalValue{}, fmt.Errorf("unknown escape sequence in %s", src)
+		}
+		c = v
+	default:
+		return evalValue{}, fmt.Errorf("invalid character constant %s", src)
+	}
+	if !strings.HasPrefix(src, "L") && c < 256 {
+		c = truncBits(c, char)
+	}
+	return evalValue{Type: evalInt, Int: truncBits(c, evalInt)}, nil
+}
@@ -0,0 +1,217 @@
+package translator
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/bhojpur/build/pkg/cpp/diag"
+	"github.com/bhojpur/build/pkg/cpp/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// learnSource parses the C source as a header and learns it with the config,
+// the translator is returned along with the warnings found.
+func learnSource(t *testing.T, src string, cfg *Config) (*Translator, diag.List) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.h")
+	require.NoError(t, ioutil.WriteFile(path, []byte(src), 0644))
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	parserCfg := &parser.Config{Arch: cfg.Arch, SourcesPaths: []string{path}}
+	unit, err := parser.ParseWith(parserCfg)
+	require.NoError(t, err)
+	cfg.TypeModel, err = parserCfg.TypeModel()
+	require.NoError(t, err)
+	tr, err := New(cfg)
+	require.NoError(t, err)
+	var diags diag.List
+	tr.SetDiagnostics(func(d diag.Diagnostic) {
+		diags = append(diags, d)
+	})
+	tr.Learn(unit)
+	return tr, diags
+}
+
+// evalConfig accepts the upper case constants and evaluates the defines.
+func evalConfig() *Config {
+	return &Config{
+		ConstRules: ConstRules{ConstDefines: ConstEval},
+		Rules: Rules{
+			TargetConst: []RuleSpec{{Action: ActionAccept, From: "^[A-Z]"}},
+		},
+	}
+}
+
+func TestConstEval(t *testing.T) {
+	var tests = []struct {
+		expr string
+		want string
+	}{
+		// literals and their suffixes
+		{"42", "42"},
+		{"42u", "uint32(42)"},
+		{"42l", "int64(42)"},
+		{"42ul", "uint64(42)"},
+		{"42ll", "int64(42)"},
+		{"0x7fffffff", "2147483647"},
+		{"0x80000000", "uint32(2147483648)"},
+		{"2147483648", "int64(2147483648)"},
+		{"010", "8"},
+		{"1.5", "1.5"},
+		{"1.5f", "float32(1.5)"},
+		{"'A'", "65"},
+		{"'\\n'", "10"},
+		{"'\\xff'", "-1"},
+		// integer promotions and the usual arithmetic conversions
+		{"(unsigned char)200 + (unsigned char)100", "300"},
+		{"-1 < 0u", "0"},
+		{"-1 + 0u", "uint32(4294967295)"},
+		{"1u - 2", "uint32(4294967295)"},
+		{"1 + 2.0", "3.0"},
+		// casts
+		{"(unsigned char)300", "uint8(44)"},
+		{"(signed char)200", "int8(-56)"},
+		{"(char)200", "int8(-56)"},
+		{"(short)-1", "int16(-1)"},
+		{"(unsigned)-1", "uint32(4294967295)"},
+		{"(uint8_t)0x1ff", "uint8(255)"},
+		{"(int)3.9", "3"},
+		{"(float)1", "float32(1.0)"},
+		// shifts
+		{"1 << 4", "16"},
+		{"1u << 31", "uint32(2147483648)"},
+		{"1 << 31", "-2147483648"},
+		{"-16 >> 2", "-4"},
+		{"0xf0000000u >> 28", "uint32(15)"},
+		{"1ull << 63", "uint64(9223372036854775808)"},
+		// sizeof
+		{"sizeof(int)", "uint64(4)"},
+		{"sizeof(long)", "uint64(8)"},
+		{"sizeof(char*)", "uint64(8)"},
+		{"sizeof(uint16_t)", "uint64(2)"},
+		// overflow wraps around in the type of the operation
+		{"0x7fffffff + 1", "-2147483648"},
+		{"0xffffffffu + 1", "uint32(0)"},
+		{"-(-2147483647 - 1)", "-2147483648"},
+		// the other operators
+		{"7 / 2", "3"},
+		{"-7 / 2", "-3"},
+		{"-7 % 2", "-1"},
+		{"~0u", "uint32(4294967295)"},
+		{"!5", "0"},
+		{"1 ? 2 : 3", "2"},
+		{"A + 1", "11"},
+	}
+	var src string
+	for i, test := range tests {
+		src += fmt.Sprintf("#define EVAL_%d %s\n", i, test.expr)
+	}
+	src = "#define A 10\n" + src
+	tr, diags := learnSource(t, src, evalConfig())
+	assert.Empty(t, diags)
+	exprs := make(map[string]string)
+	for _, decl := range tr.Defines() {
+		exprs[decl.Name] = decl.Expression
+	}
+	for i, test := range tests {
+		assert.Equal(t, test.want, exprs[fmt.Sprintf("EVAL_%d", i)], test.expr)
+	}
+}
+
+func TestConstEvalUnsignedChar(t *testing.T) {
+	cfg := evalConfig()
+	cfg.Arch = "aarch64"
+	src := "#define HIGH '\\xff'\n#define CAST (char)200\n#define SIGNED (signed char)200\n"
+	tr, diags := learnSource(t, src, cfg)
+	assert.Empty(t, diags)
+	exprs := make(map[string]string)
+	for _, decl := range tr.Defines() {
+		exprs[decl.Name] = decl.Expression
+	}
+	assert.Equal(t, "255", exprs["HIGH"])
+	assert.Equal(t, "uint8(200)", exprs["CAST"])
+	assert.Equal(t, "int8(-56)", exprs["SIGNED"])
+}
+
+func TestConstEvalErrors(t *testing.T) {
+	var tests = []struct {
+		expr string
+		err  string
+	}{
+		{"1 / 0", "1 / 0: division by zero"},
+		{"1 % 0", "1 % 0: division by zero"},
+		{"1.0 / 0", "1.0 / 0: division by zero"},
+		{"UNKNOWN + 1", "UNKNOWN + 1: undefined identifier UNKNOWN"},
+		{"18446744073709551616", "18446744073709551616: invalid integer constant 18446744073709551616"},
+		{"(1 + 2", "( 1 + 2: expected \")\", got end of expression"},
+	}
+	var src string
+	for i, test := range tests {
+		src += fmt.Sprintf("#define EVAL_%d %s\n", i, test.expr)
+	}
+	tr, diags := learnSource(t, src, evalConfig())
+	assert.Empty(t, tr.Defines())
+	require.Len(t, diags, len(tests))
+	for i, test := range tests {
+		assert.Equal(t, diag.CodeMacroEval, diags[i].Code)
+		assert.Equal(t, fmt.Sprintf("cannot evaluate the macro EVAL_%d as a constant, skipping: %s", i, test.err),
+			diags[i].Message)
+	}
+}
+
+func TestConstEvalStrings(t *testing.T) {
+	const src = `#define ONE "a"
+#define JOINED "a" "b\n" "c"
+#define QUOTES "q\"x" "\\"
+#define ESCAPES "a\0b\?\'"
+#define NUMERIC "\x41\x042" "\101\1010"
+#define UNIVERSAL "\u00e9\U0001F600"
+#define UTF8 u8"caf\u00e9"
+#define WIDE L"wide"
+#define WIDE16 u"wide"
+#define LONGHEX "\x1ff"
+`
+	tr, diags := learnSource(t, src, evalConfig())
+	values := make(map[string]Value)
+	for _, decl := range tr.Defines() {
+		values[decl.Name] = decl.Value
+	}
+	assert.Equal(t, Value(`"a"`), values["ONE"])
+	assert.Equal(t, Value(`"ab\nc"`), values["JOINED"])
+	assert.Equal(t, Value(`"q\"x\\"`), values["QUOTES"])
+	assert.Equal(t, Value(`"a\x00b?'"`), values["ESCAPES"])
+	assert.Equal(t, Value(`"ABAA0"`), values["NUMERIC"])
+	assert.Equal(t, Value(`"é😀"`), values["UNIVERSAL"])
+	assert.Equal(t, Value(`"café"`), values["UTF8"])
+	require.Len(t, diags, 3)
+	assert.Equal(t, `cannot evaluate the macro WIDE as a constant, skipping: L"wide": wide string literals are not supported`,
+		diags[0].Message)
+	assert.Equal(t, `cannot evaluate the macro WIDE16 as a constant, skipping: u"wide": wide string literals are not supported`,
+		diags[1].Message)
+	assert.Equal(t, `cannot evaluate the macro LONGHEX as a constant, skipping: "\x1ff": invalid hex escape \x1ff`,
+		diags[2].Message)
+}
@@ -0,0 +1,410 @@
+package translator
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"go/token"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"unicode"
+
+	"modernc.org/xc"
+)
+
+// CDoc is a doc comment attached to a C declaration, with Doxygen commands
+// sorted out into the corresponding sections.
+type CDoc struct {
+	Text       string      `json:"text,omitempty"`
+	Params     []CDocParam `json:"params,omitempty"`
+	Return     string      `json:"return,omitempty"`
+	Deprecated string      `json:"deprecated,omitempty"`
+	// IsDeprecated is set when @deprecated has been specified, even without text.
+	IsDeprecated bool       `json:"isDeprecated,omitempty"`
+	Notes        []CDocNote `json:"notes,omitempty"`
+}
+
+// CDocParam describes a parameter documented via @param.
+type CDocParam struct {
+	Name string `json:"name"`
+	Text string `json:"text"`
+}
+
+// CDocNote is any other Doxygen section, such as @note or @see.
+type CDocNote struct {
+	Title string `json:"title"`
+	Text  string `json:"text"`
+}
+
+// IsEmpty reports whether the doc has no content to be written.
+func (d *CDoc) IsEmpty() bool {
+	if d == nil {
+		return true
+	}
+	return len(d.Text) == 0 && len(d.Params) == 0 && len(d.Return) == 0 &&
+		!d.IsDeprecated && len(d.Notes) == 0
+}
+
+// ParamDoc returns the text documenting the named parameter.
+func (d *CDoc) ParamDoc(name string) (string, bool) {
+	if d == nil {
+		return "", false
+	}
+	for _, p := range d.Params {
+		if p.Name == name {
+			return p.Text, true
+		}
+	}
+	return "", false
+}
+
+// DocCache keeps the contents of source files that doc comments are read from.
+type DocCache struct {
+	mux   sync.Mutex
+	files map[string][]byte
+}
+
+func (d *DocCache) source(path string) []byte {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	if data, ok := d.files[path]; ok {
+		return data
+	}
+	if d.files == nil {
+		d.files = make(map[string][]byte)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		data = nil
+	}
+	d.files[path] = data
+	return data
+}
+
+// leadingDoc reads the comment block placed right above the line containing p.
+func (t *Translator) leadingDoc(p token.Pos) *CDoc {
+	if !p.IsValid() {
+		return nil
+	}
+	pos := xc.FileSet.Position(p)
+	data := t.docCache.source(pos.Filename)
+	if len(data) == 0 || pos.Offset >= len(data) {
+		return nil
+	}
+	lineStart := pos.Offset - (pos.Column - 1)
+	if lineStart <= 0 || lineStart > len(data) {
+		return nil
+	}
+	return parseDoc(leadingComment(data, lineStart))
+}
+
+// trailingDoc reads a Doxygen member comment (///<, //!<, /**<, /*!<)
+// that follows the declaration at p on the same line.
+func (t *Translator) trailingDoc(p token.Pos) *CDoc {
+	if !p.IsValid() {
+		return nil
+	}
+	pos := xc.FileSet.Position(p)
+	data := t.docCache.source(pos.Filename)
+	if len(data) == 0 || pos.Offset >= len(data) {
+		return nil
+	}
+	return parseDoc(trailingComment(data, pos.Offset))
+}
+
+// declDoc returns the doc of a member or enumerator, preferring the comment
+// that precedes it, unless it shares the line with other declarations.
+func (t *Translator) declDoc(p token.Pos) *CDoc {
+	if !p.IsValid() {
+		return nil
+	}
+	pos := xc.FileSet.Position(p)
+	data := t.docCache.source(pos.Filename)
+	if len(data) == 0 || pos.Offset >= len(data) {
+		return nil
+	}
+	lineStart := pos.Offset - (pos.Column - 1)
+	if lineStart > 0 && !bytes.ContainsAny(data[lineStart:pos.Offset], "{,;(") {
+		if doc := parseDoc(leadingComment(data, lineStart)); doc != nil {
+			return doc
+		}
+	}
+	return parseDoc(trailingComment(data, pos.Offset))
+}
+
+func isTrailingMarker(comment []byte) bool {
+	for _, prefix := range []string{"///<", "//!<", "/**<", "/*!<"} {
+		if bytes.HasPrefix(comment, []byte(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// leadingComment finds a comment that ends on the line before the offset
+// and occupies whole lines, i.e. it is not a comment trailing some code.
+func leadingComment(data []byte, lineStart int) []byte {
+	prevLine := func(end int) (int, []byte) {
+		// end points to the '\n' that terminates the line
+		start := bytes.LastIndexByte(data[:end], '\n') + 1
+		return start, bytes.TrimSpace(data[start:end])
+	}
+	end := lineStart - 1
+	start, line := prevLine(end)
+	switch {
+	case bytes.HasSuffix(line, []byte("*/")):
+		blockEnd := start + bytes.LastIndex(data[start:end], []byte("*/")) + 2
+		blockStart := bytes.LastIndex(data[:blockEnd-2], []byte("/*"))
+		if blockStart < 0 {
+			return nil
+		}
+		lineBegin := bytes.LastIndexByte(data[:blockStart], '\n') + 1
+		if len(bytes.TrimSpace(data[lineBegin:blockStart])) > 0 {
+			// trails some code
+			return nil
+		}
+		if comment := data[blockStart:blockEnd]; !isTrailingMarker(comment) {
+			return comment
+		}
+		return nil
+	case bytes.HasPrefix(line, []byte("//")):
+		var lines [][]byte
+		for bytes.HasPrefix(line, []byte("//")) && !isTrailingMarker(line) {
+			lines = append([][]byte{line}, lines...)
+			if start == 0 {
+				break
+			}
+			end = start - 1
+			start, line = prevLine(end)
+		}
+		return bytes.Join(lines, []byte("\n"))
+	}
+	return nil
+}
+
+// trailingComment looks for a member comment after the declaration at the
+// offset, it must be the first thing after the declaration terminator.
+func trailingComment(data []byte, offset int) []byte {
+	var terminated bool
+	for i := offset; i < len(data); i++ {
+		switch c := data[i]; {
+		case c == '\n':
+			return nil
+		case c == '/' && i+1 < len(data) && (data[i+1] == '/' || data[i+1] == '*'):
+			if !isTrailingMarker(data[i:]) {
+				return nil
+			}
+			if data[i+1] == '/' {
+				end := bytes.IndexByte(data[i:], '\n')
+				if end < 0 {
+					return data[i:]
+				}
+				return data[i : i+end]
+			}
+			end := bytes.Index(data[i:], []byte("*/"))
+			if end < 0 {
+				return nil
+			}
+			return data[i : i+end+2]
+		case c == ',' || c == ';' || c == ')' || c == '}':
+			terminated = true
+		case terminated && !unicode.IsSpace(rune(c)):
+			return nil
+		}
+	}
+	return nil
+}
+
+// cleanComment strips comment markers and decorations, returning the text lines.
+func cleanComment(comment []byte) []string {
+	text := string(comment)
+	var lines []string
+	if strings.HasPrefix(text, "/*") {
+		text = strings.TrimSuffix(text, "*/")
+		text = strings.TrimPrefix(text, "/*")
+		text = strings.TrimLeft(text, "*!")
+		text = strings.TrimPrefix(text, "<")
+		for _, line := range strings.Split(text, "\n") {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "*") && !strings.HasPrefix(line, "*/") {
+				line = strings.TrimLeft(line, "*")
+			}
+			lines = append(lines, strings.TrimSpace(line))
+		}
+	} else {
+		for _, line := range strings.Split(text, "\n") {
+			line = strings.TrimSpace(line)
+			line = strings.TrimLeft(line, "/")
+			line = strings.TrimPrefix(line, "!")
+			line = strings.TrimPrefix(line, "<")
+			lines = append(lines, strings.TrimSpace(line))
+		}
+	}
+	for len(lines) > 0 && len(lines[0]) == 0 {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// parseDoc sorts out the Doxygen commands of a comment, e.g.
+//
+//	@brief Adds two numbers.
+//	@param a the first one
+//	@return the sum
+func parseDoc(comment []byte) *CDoc {
+	if len(comment) == 0 {
+		return nil
+	}
+	lines := cleanComment(comment)
+	if len(lines) == 0 {
+		return nil
+	}
+	doc := &CDoc{}
+	var text []string
+	// section points to the text being continued by the next lines,
+	// it is updated after each append so reallocations are fine.
+	var section *string
+	appendTo := func(s *string, line string) {
+		if len(*s) > 0 {
+			*s += "\n"
+		}
+		*s += line
+	}
+	for _, line := range lines {
+		cmd, rest := docCommand(line)
+		switch cmd {
+		case "":
+			if len(line) == 0 {
+				section = nil
+				text = append(text, "")
+				continue
+			}
+			if section != nil {
+				appendTo(section, line)
+				continue
+			}
+			text = append(text, line)
+		case "brief", "short", "details":
+			section = nil
+			if len(rest) > 0 {
+				text = append(text, rest)
+			}
+		case "param", "tparam":
+			name, desc := splitWord(rest)
+			doc.Params = append(doc.Params, CDocParam{
+				Name: name,
+				Text: desc,
+			})
+			section = &doc.Params[len(doc.Params)-1].Text
+		case "return", "returns", "result", "retval":
+			appendTo(&doc.Return, rest)
+			section = &doc.Return
+		case "deprecated":
+			doc.IsDeprecated = true
+			appendTo(&doc.Deprecated, rest)
+			section = &doc.Deprecated
+		default:
+			doc.Notes = append(doc.Notes, CDocNote{
+				Title: docNoteTitle(cmd),
+				Text:  rest,
+			})
+			section = &doc.Notes[len(doc.Notes)-1].Text
+		}
+	}
+	doc.Text = strings.TrimSpace(squashEmptyLines(text))
+	if doc.IsEmpty() {
+		return nil
+	}
+	return doc
+}
+
+// docCommand splits a line like "@param[in] x the value" into the command
+// name and the rest of the line.
+func docCommand(line string) (cmd, rest string) {
+	if len(line) < 2 || (line[0] != '@' && line[0] != '\\') {
+		return "", line
+	}
+	end := 1
+	for end < len(line) && unicode.IsLetter(rune(line[end])) {
+		end++
+	}
+	if end == 1 {
+		return "", line
+	}
+	cmd = strings.ToLower(line[1:end])
+	rest = line[end:]
+	if strings.HasPrefix(rest, "[") {
+		// a direction spec like [in,out]
+		if idx := strings.IndexByte(rest, ']'); idx > 0 {
+			rest = rest[idx+1:]
+		}
+	}
+	return cmd, strings.TrimSpace(rest)
+}
+
+func splitWord(s string) (word, rest string) {
+	s = strings.TrimSpace(s)
+	if idx := strings.IndexFunc(s, unicode.IsSpace); idx > 0 {
+		return s[:idx], strings.TrimSpace(s[idx:])
+	}
+	return s, ""
+}
+
+var docNoteTitles = map[string]string{
+	"sa":      "See also",
+	"see":     "See also",
+	"note":    "Note",
+	"remark":  "Note",
+	"remarks": "Note",
+	"warning": "Warning",
+	"since":   "Since",
+	"todo":    "TODO",
+	"bug":     "Bug",
+	"pre":     "Precondition",
+	"post":    "Postcondition",
+	"throws":  "Throws",
+}
+
+func docNoteTitle(cmd string) string {
+	if title, ok := docNoteTitles[cmd]; ok {
+		return title
+	}
+	return strings.ToUpper(cmd[:1]) + cmd[1:]
+}
+
+func squashEmptyLines(lines []string) string {
+	buf := new(bytes.Buffer)
+	var prevEmpty bool
+	for _, line := range lines {
+		isEmpty := len(line) == 0
+		if isEmpty && prevEmpty {
+			continue
+		}
+		prevEmpty = isEmpty
+		buf.WriteString(line)
+		buf.WriteRune('\n')
+	}
+	return buf.String()
+}
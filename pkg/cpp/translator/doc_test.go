@@ -0,0 +1,191 @@
+package translator
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDoc(t *testing.T) {
+	var tests = []struct {
+		comment string
+		want    *CDoc
+	}{
+		{"/** Adds two numbers. */", &CDoc{Text: "Adds two numbers."}},
+		{"/*! Adds two numbers. */", &CDoc{Text: "Adds two numbers."}},
+		{"/// Adds two numbers.\n/// Returns the sum.", &CDoc{Text: "Adds two numbers.\nReturns the sum."}},
+		{"//! Adds two numbers.", &CDoc{Text: "Adds two numbers."}},
+		{"// Adds two numbers.", &CDoc{Text: "Adds two numbers."}},
+		{"/**\n * Adds two numbers.\n *\n *\n * Overflows wrap around.\n */", &CDoc{Text: "Adds two numbers.\n\nOverflows wrap around."}},
+		{"/** @brief Adds two numbers. */", &CDoc{Text: "Adds two numbers."}},
+		{"/**\n * \\brief Adds two numbers.\n * \\param a the first one\n * \\param[in] b the second one,\n *   never zero\n * \\return the sum\n */", &CDoc{
+			Text: "Adds two numbers.",
+			Params: []CDocParam{
+				{Name: "a", Text: "the first one"},
+				{Name: "b", Text: "the second one,\nnever zero"},
+			},
+			Return: "the sum",
+		}},
+		{"/// @returns the sum\n/// @retval -1 on failure", &CDoc{Return: "the sum\n-1 on failure"}},
+		{"/** @deprecated */", &CDoc{IsDeprecated: true}},
+		{"/** Old.\n * @deprecated Use add2 instead. */", &CDoc{Text: "Old.", Deprecated: "Use add2 instead.", IsDeprecated: true}},
+		{"/** @note Not thread-safe.\n * @see add2 */", &CDoc{Notes: []CDocNote{
+			{Title: "Note", Text: "Not thread-safe."},
+			{Title: "See also", Text: "add2"},
+		}}},
+		{"/** @custom A command. */", &CDoc{Notes: []CDocNote{{Title: "Custom", Text: "A command."}}}},
+		{"/**\n *\n */", nil},
+		{"", nil},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, parseDoc([]byte(test.comment)), test.comment)
+	}
+}
+
+func TestLeadingComment(t *testing.T) {
+	var tests = []struct {
+		src  string
+		want string
+	}{
+		{"/** Adds. */\nint add(int a, int b);", "/** Adds. */"},
+		{"/**\n * Adds.\n */\nint add(int a, int b);", "/**\n * Adds.\n */"},
+		{"// one\n// two\nint add(int a, int b);", "// one\n// two"},
+		{"/// one\nint add(int a, int b);", "/// one"},
+		// a comment trailing the code above isn't the doc of the declaration
+		{"int x; /* the x */\nint add(int a, int b);", ""},
+		{"int x; ///< the x\nint add(int a, int b);", ""},
+		// there must be no blank line in between
+		{"/** Adds. */\n\nint add(int a, int b);", ""},
+	}
+	for _, test := range tests {
+		lineStart := strings.LastIndex(test.src, "\n") + 1
+		assert.Equal(t, test.want, string(leadingComment([]byte(test.src), lineStart)), test.src)
+	}
+}
+
+func TestTrailingComment(t *testing.T) {
+	var tests = []struct {
+		src  string
+		want string
+	}{
+		{"int x; ///< the x\n", "///< the x"},
+		{"int x; //!< the x\n", "//!< the x"},
+		{"int x; /**< the x */\n", "/**< the x */"},
+		{"int x, /*!< the x */ y;", "/*!< the x */"},
+		{"RED = 1, ///< red", "///< red"},
+		// plain comments are not member docs
+		{"int x; // the x\n", ""},
+		{"int x; /** the next one */\n", ""},
+		// the comment must follow the terminator of the declaration
+		{"int x; int y; ///< the y\n", ""},
+		{"int x;\n///< the x\n", ""},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, string(trailingComment([]byte(test.src), 0)), test.src)
+	}
+}
+
+func TestDeclDocs(t *testing.T) {
+	const src = `
+/**
+ * A point on the screen.
+ */
+struct point {
+	/// The horizontal position.
+	int x;
+	int y; ///< The vertical position.
+};
+
+/**
+ * @brief Moves the point.
+ * @param p the point
+ * @param dx the offset
+ * @return 0 on success
+ */
+int point_move(struct point *p, int dx);
+
+// Colors of the points.
+enum color {
+	RED,   ///< The red one.
+	GREEN, ///< The green one.
+};
+`
+	tr, _ := learnSource(t, src, nil)
+	var move *CDecl
+	for _, decl := range tr.Declares() {
+		if decl.Name == "point_move" {
+			move = decl
+		}
+	}
+	require.NotNil(t, move)
+	assert.Equal(t, &CDoc{
+		Text: "Moves the point.",
+		Params: []CDocParam{
+			{Name: "p", Text: "the point"},
+			{Name: "dx", Text: "the offset"},
+		},
+		Return: "0 on success",
+	}, move.Doc)
+
+	require.Contains(t, tr.TagMap(), "point")
+	point, ok := tr.TagMap()["point"].Spec.(*CStructSpec)
+	require.True(t, ok)
+	require.Len(t, point.Members, 2)
+	assert.Equal(t, &CDoc{Text: "The horizontal position."}, point.Members[0].Doc)
+	assert.Equal(t, &CDoc{Text: "The vertical position."}, point.Members[1].Doc)
+
+	require.Contains(t, tr.TagMap(), "color")
+	color, ok := tr.TagMap()["color"].Spec.(*CEnumSpec)
+	require.True(t, ok)
+	require.Len(t, color.Members, 2)
+	assert.Equal(t, &CDoc{Text: "The red one."}, color.Members[0].Doc)
+	assert.Equal(t, &CDoc{Text: "The green one."}, color.Members[1].Doc)
+}
+
+func TestDefineDocs(t *testing.T) {
+	const src = `
+/// The largest size of a buffer.
+#define BUF_MAX 4096
+
+/** The name of the library. */
+#define LIB_NAME "lib"
+
+#define NO_DOC 1
+`
+	for _, cfg := range []*Config{
+		{Rules: Rules{TargetConst: []RuleSpec{{Action: ActionAccept, From: "^[A-Z]"}}}},
+		evalConfig(),
+	} {
+		tr, _ := learnSource(t, src, cfg)
+		docs := make(map[string]*CDoc)
+		for _, decl := range tr.Defines() {
+			docs[decl.Name] = decl.Doc
+		}
+		require.Len(t, docs, 3, cfg.ConstRules)
+		assert.Equal(t, &CDoc{Text: "The largest size of a buffer."}, docs["BUF_MAX"], cfg.ConstRules)
+		assert.Equal(t, &CDoc{Text: "The name of the library."}, docs["LIB_NAME"], cfg.ConstRules)
+		assert.Nil(t, docs["NO_DOC"], cfg.ConstRules)
+	}
+}
@@ -29,6 +29,7 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/bhojpur/build/pkg/cpp/diag"
 	"modernc.org/xc"
 )
 
@@ -80,6 +81,24 @@ func replaceBytes(buf []byte, idx []int, piece []byte) []byte {
 
 var srcReferenceRx = regexp.MustCompile(`(?P<path>[^;]+);(?P<file>[^;]+);(?P<line>[^;]+);(?P<name>[^;]+);(?P<goname>[^;]+);`)
 
+// SetDiagnostics sets the handler of the problems found while learning,
+// they are dropped when there's none.
+func (t *Translator) SetDiagnostics(h diag.Handler) {
+	t.diagnostics = h
+}
+
+func (t *Translator) warn(p token.Pos, code, format string, args ...interface{}) {
+	if t.diagnostics == nil {
+		return
+	}
+	t.diagnostics(diag.Diagnostic{
+		Severity: diag.Warning,
+		Pos:      diag.FromPos(xc.FileSet.Position(p)),
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
 func (t *Translator) IsTokenIgnored(p token.Pos) bool {
 	if len(t.ignoredFiles) == 0 {
 		return false
@@ -0,0 +1,631 @@
+package translator
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/bhojpur/build/pkg/cpp/diag"
+	"modernc.org/cc"
+	"modernc.org/xc"
+)
+
+// collectMacros translates the function-like macros, that's enabled when
+// there are accept rules for the macro target.
+func (t *Translator) collectMacros(defines map[int]*cc.Macro) {
+	if len(t.compiledRxs[ActionAccept][TargetMacro]) == 0 {
+		return
+	}
+	mt := &macroTranslator{
+		t:      t,
+		e:      newConstEvaluator(t, defines),
+		consts: make(map[string]bool, len(t.defines)+len(t.valueMap)),
+		done:   make(map[string]*CMacro),
+		errs:   make(map[string]error),
+		busy:   make(map[string]bool),
+	}
+	for _, decl := range t.defines {
+		if decl.Value != nil || len(decl.Expression) > 0 {
+			mt.consts[decl.Name] = true
+		}
+	}
+	for name := range t.valueMap {
+		if t.IsAcceptableName(TargetConst, name) {
+			mt.consts[name] = true
+		}
+	}
+
+	for _, macro := range sortedMacros(defines) {
+		if !macro.IsFnLike || t.IsTokenIgnored(macro.DefTok.Pos()) {
+			continue
+		}
+		name := string(macro.DefTok.S())
+		if !t.IsAcceptableName(TargetMacro, name) {
+			continue
+		}
+		m, err := mt.translate(name)
+		if err != nil {
+			t.warn(macro.DefTok.Pos(), diag.CodeMacroFunc, "cannot translate the function-like macro %s, skipping: %v", name, err)
+			continue
+		}
+		t.macros = append(t.macros, m)
+	}
+	sort.Sort(macroList(t.macros))
+}
+
+type macroTranslator struct {
+	t      *Translator
+	e      *constEvaluator
+	consts map[string]bool
+	done   map[string]*CMacro
+	errs   map[string]error
+	busy   map[string]bool
+}
+
+func (mt *macroTranslator) translate(name string) (*CMacro, error) {
+	if m, ok := mt.done[name]; ok {
+		return m, nil
+	} else if err, ok := mt.errs[name]; ok {
+		return nil, err
+	} else if mt.busy[name] {
+		return nil, errors.New("the macro is recursive")
+	}
+	mt.busy[name] = true
+	m, err := mt.translateMacro(name, mt.e.macros[name])
+	delete(mt.busy, name)
+	if err != nil {
+		mt.errs[name] = err
+		return nil, err
+	}
+	mt.done[name] = m
+	return m, nil
+}
+
+func (mt *macroTranslator) translateMacro(name string, macro *cc.Macro) (*CMacro, error) {
+	tokens := macro.ReplacementToks()
+	srcParts := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		src := cc.TokSrc(token)
+		if src == "__VA_ARGS__" {
+			return nil, errors.New("variadic macros are not supported")
+		}
+		srcParts = append(srcParts, src)
+	}
+	m := &CMacro{
+		Name:   name,
+		Params: make([]string, 0, len(macro.Args)),
+		Src:    strings.Join(srcParts, " "),
+		Pos:    macro.DefTok.Pos(),
+		Doc:    mt.t.leadingDoc(macro.DefTok.Pos()),
+	}
+	params := make(map[string]int, len(macro.Args))
+	for i, id := range macro.Args {
+		arg := xc.Dict.S(id)
+		if string(arg) == "__VA_ARGS__" {
+			return nil, errors.New("variadic macros are not supported")
+		}
+		params[string(arg)] = i
+		switch goName := blessName(arg); goName {
+		case "C", "T":
+			// the cgo package and the type parameter
+			m.Params = append(m.Params, "_"+goName)
+		default:
+			m.Params = append(m.Params, goName)
+		}
+	}
+	if err := mt.resolveTypes(m); err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("empty replacement list")
+	}
+
+	expr, err := mt.translateBody(m, params, tokens)
+	switch {
+	case err != nil && m.Result == nil:
+		return nil, fmt.Errorf("%v, a type tip is required to wrap it in C", err)
+	case err != nil, m.Result != nil && m.Result.IsVoid():
+		m.Shim = true
+		return m, nil
+	}
+	m.Expression = expr
+	return m, nil
+}
+
+// resolveTypes reads the types of parameters and result from the type tips in the
+// macro scope, e.g. {target: ^MAKE_VERSION$, tips: [int, int, int], self: unsigned}.
+// Parameters without a tip get the result type, the result type defaults to int.
+func (mt *macroTranslator) resolveTypes(m *CMacro) error {
+	var rx TipSpecRx
+	var found bool
+	for _, specRx := range mt.t.compiledTypeTipRxs[TipScopeMacro] {
+		if specRx.Target.MatchString(m.Name) {
+			rx, found = specRx, true
+			break
+		}
+	}
+	if !found {
+		return nil
+	}
+	resultName := rx.CTypeSelf()
+	if len(resultName) == 0 {
+		resultName = "int"
+	}
+	result, err := mt.e.macroType(resultName)
+	if err != nil {
+		return fmt.Errorf("result type tip: %v", err)
+	}
+	m.Result = result
+	m.ParamTypes = make([]*CMacroType, 0, len(m.Params))
+	for i := range m.Params {
+		name := rx.CTypeAt(i)
+		if len(name) == 0 {
+			if result.IsVoid() {
+				name = "int"
+			} else {
+				name = result.C
+			}
+		}
+		typ, err := mt.e.macroType(name)
+		if err != nil {
+			return fmt.Errorf("type tip of %s: %v", m.Params[i], err)
+		} else if typ.IsVoid() {
+			return fmt.Errorf("type tip of %s: void is not a parameter type", m.Params[i])
+		}
+		m.ParamTypes = append(m.ParamTypes, typ)
+	}
+	return nil
+}
+
+func (mt *macroTranslator) translateBody(m *CMacro, params map[string]int, tokens []xc.Token) (string, error) {
+	list, err := evalTokenize(tokens)
+	if err != nil {
+		return "", err
+	}
+	p := &macroParser{
+		evalParser: &evalParser{e: mt.e, toks: list},
+		mt:         mt,
+		m:          m,
+		params:     params,
+		typ:        "T",
+	}
+	if m.Result != nil {
+		if m.Result.IsVoid() {
+			return "", errors.New("the macro has no result")
+		}
+		p.typ = m.Result.Go
+	}
+	x, err := p.expr()
+	if err != nil {
+		return "", err
+	} else if p.pos < len(p.toks) {
+		return "", fmt.Errorf("unexpected %q", p.peek().Src)
+	}
+	if m.Result != nil {
+		if x.constant {
+			return p.typ + "(" + x.text + ")", nil
+		}
+		return x.text, nil
+	}
+	switch {
+	case len(m.Params) == 0:
+		return "", errors.New("the result type is unknown")
+	case p.negConsts:
+		return "", errors.New("negative constants don't fit unsigned types")
+	case p.bigConsts:
+		return "", errors.New("constants overflow 32-bit types")
+	case p.intOps && p.floats:
+		return "", errors.New("mixes integer operations with floating-point constants")
+	case p.intOps:
+		m.Constraint = MacroConstraintInteger
+	case p.floats:
+		m.Constraint = MacroConstraintFloat
+	default:
+		m.Constraint = MacroConstraintNumber
+	}
+	m.Result = p.result
+	if x.constant {
+		return p.typ + "(" + x.text + ")", nil
+	}
+	return x.text, nil
+}
+
+// macroType resolves a C type name from a type tip.
+func (e *constEvaluator) macroType(name string) (*CMacroType, error) {
+	name = strings.TrimSpace(name)
+	if name == "void" {
+		return &CMacroType{C: name}, nil
+	} else if strings.Contains(name, "*") {
+		return nil, fmt.Errorf("%s: pointer types are not supported", name)
+	}
+	words := strings.Fields(name)
+	if len(words) == 0 {
+		return nil, errors.New("empty type name")
+	}
+	toks := make([]evalToken, 0, len(words))
+	for _, word := range words {
+		if !isWord(word) {
+			return nil, fmt.Errorf("%s: invalid type name", name)
+		}
+		toks = append(toks, evalToken{Kind: cc.IDENTIFIER, Src: word})
+	}
+	p := &evalParser{e: e, toks: toks}
+	typ, err := p.typeName()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	} else if p.pos < len(toks) {
+		return nil, fmt.Errorf("%s: invalid type name", name)
+	}
+	return &CMacroType{
+		C:   strings.Join(words, " "),
+		Go:  typ.GoType(),
+		CGo: cgoTypeName(words, typ),
+	}, nil
+}
+
+// cgoTypeName returns the name cgo uses for the type.
+func cgoTypeName(words []string, typ evalType) string {
+	if len(words) == 1 && !evalTypeKeywords[words[0]] {
+		// a typedef
+		return "C." + words[0]
+	}
+	var longs int
+	var unsigned, signed, isBool bool
+	for _, word := range words {
+		switch word {
+		case "long":
+			longs++
+		case "unsigned":
+			unsigned = true
+		case "signed":
+			signed = true
+		case "_Bool":
+			isBool = true
+		}
+	}
+	switch {
+	case typ.Float && typ.Size == 4:
+		return "C.float"
+	case typ.Float:
+		return "C.double"
+	case isBool:
+		return "C._Bool"
+	case typ.Size == 1 && unsigned:
+		return "C.uchar"
+	case typ.Size == 1 && signed:
+		return "C.schar"
+	case typ.Size == 1:
+		return "C.char"
+	case typ.Size == 2 && unsigned:
+		return "C.ushort"
+	case typ.Size == 2:
+		return "C.short"
+	case longs > 1 && unsigned:
+		return "C.ulonglong"
+	case longs > 1:
+		return "C.longlong"
+	case longs == 1 && unsigned:
+		return "C.ulong"
+	case longs == 1:
+		return "C.long"
+	case unsigned:
+		return "C.uint"
+	}
+	return "C.int"
+}
+
+// goExpr is a translated part of the macro body.
+type goExpr struct {
+	text string
+	// binary is set for binary expressions that need parens as operands,
+	// C and Go have different operator precedence.
+	binary bool
+	// constant is set for untyped constants.
+	constant bool
+}
+
+func (x goExpr) operand() string {
+	if x.binary {
+		return "(" + x.text + ")"
+	}
+	return x.text
+}
+
+// macroParser translates the body of a macro into a Go expression of a single type,
+// that is either the result type or the type parameter T. All the operands are
+// converted to that type, because Go has no implicit conversions.
+type macroParser struct {
+	*evalParser
+	mt     *macroTranslator
+	m      *CMacro
+	params map[string]int
+	typ    string
+
+	intOps    bool
+	floats    bool
+	negConsts bool
+	bigConsts bool
+	// result is the type of a cast that makes up the whole body of a generic macro.
+	result *CMacroType
+}
+
+func (p *macroParser) isGeneric() bool {
+	return p.m.Result == nil
+}
+
+// spansBody reports whether the tokens from start to end make up the whole body,
+// apart from the parens around them.
+func (p *macroParser) spansBody(start, end int) bool {
+	if start != len(p.toks)-end {
+		return false
+	}
+	for i := 0; i < start; i++ {
+		if p.toks[i].Kind != 0 || p.toks[i].Src != "(" || p.toks[end+i].Src != ")" {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *macroParser) convert(goType string, x goExpr) goExpr {
+	return goExpr{text: goType + "(" + x.text + ")"}
+}
+
+func (p *macroParser) expr() (goExpr, error) {
+	x, err := p.binary(1)
+	if err != nil {
+		return goExpr{}, err
+	}
+	switch tok := p.peek(); {
+	case tok.Kind != 0:
+	case tok.Src == "?":
+		return goExpr{}, errors.New("conditional expressions have no Go equivalent")
+	case tok.Src == ",":
+		return goExpr{}, errors.New("comma expressions have no Go equivalent")
+	}
+	return x, nil
+}
+
+var macroIntOps = map[string]bool{
+	"%": true, "<<": true, ">>": true, "&": true, "|": true, "^": true,
+}
+
+func (p *macroParser) binary(minPrec int) (goExpr, error) {
+	x, err := p.unary()
+	if err != nil {
+		return goExpr{}, err
+	}
+	for {
+		tok := p.peek()
+		prec, ok := evalPrecedence[tok.Src]
+		if tok.Kind != 0 || !ok || prec < minPrec {
+			return x, nil
+		}
+		if prec < 3 || prec == 6 || prec == 7 {
+			// logical and comparison operators
+			return goExpr{}, fmt.Errorf("the %s operator yields bool in Go", tok.Src)
+		}
+		p.pos++
+		y, err := p.binary(prec + 1)
+		if err != nil {
+			return goExpr{}, err
+		}
+		if macroIntOps[tok.Src] {
+			p.intOps = true
+		}
+		x = goExpr{
+			text:     x.operand() + " " + tok.Src + " " + y.operand(),
+			binary:   true,
+			constant: x.constant && y.constant,
+		}
+	}
+}
+
+func (p *macroParser) unary() (goExpr, error) {
+	tok := p.peek()
+	if tok.Kind == cc.IDENTIFIER && tok.Src == "sizeof" {
+		p.pos++
+		if p.peek().Src != "(" || !p.isTypeName(p.peekAt(1)) {
+			return goExpr{}, errors.New("sizeof of an expression is not supported")
+		}
+		v, err := p.sizeof()
+		if err != nil {
+			return goExpr{}, err
+		}
+		return goExpr{text: fmt.Sprint(v.Int), constant: true}, nil
+	}
+	if tok.Kind != 0 {
+		return p.primary()
+	}
+	switch tok.Src {
+	case "+", "-", "~":
+		p.pos++
+		x, err := p.unary()
+		if err != nil {
+			return goExpr{}, err
+		}
+		op := tok.Src
+		if op == "~" {
+			op = "^"
+			p.intOps = true
+		} else if op == "-" && x.constant {
+			p.negConsts = true
+		}
+		return goExpr{text: op + x.operand(), constant: x.constant}, nil
+	case "!":
+		return goExpr{}, errors.New("the ! operator yields bool in Go")
+	case "(":
+		if p.isTypeName(p.peekAt(1)) {
+			start := p.pos
+			p.pos++
+			typ, err := p.typeName()
+			if err != nil {
+				return goExpr{}, err
+			}
+			typeEnd := p.pos
+			if err := p.expect(")"); err != nil {
+				return goExpr{}, err
+			}
+			x, err := p.unary()
+			if err != nil {
+				return goExpr{}, err
+			}
+			if typ.Float {
+				p.floats = true
+			}
+			if p.isGeneric() && p.spansBody(start, p.pos) {
+				// the cast gives the result type, the params stay generic
+				words := make([]string, 0, typeEnd-start-1)
+				for _, tok := range p.toks[start+1 : typeEnd] {
+					words = append(words, tok.Src)
+				}
+				result, err := p.mt.e.macroType(strings.Join(words, " "))
+				if err != nil {
+					return goExpr{}, err
+				} else if result.IsVoid() {
+					return goExpr{}, errors.New("the macro has no result")
+				}
+				p.result = result
+				return p.convert(result.Go, x), nil
+			}
+			if goType := typ.GoType(); goType != p.typ {
+				x = p.convert(goType, x)
+			}
+			return p.convert(p.typ, x), nil
+		}
+	}
+	return p.primary()
+}
+
+func (p *macroParser) primary() (goExpr, error) {
+	tok := p.peek()
+	p.pos++
+	switch tok.Kind {
+	case cc.INTCONST:
+		v, err := parseIntConst(tok.Src, p.e.long.Size)
+		if err != nil {
+			return goExpr{}, err
+		}
+		if v.Int > math.MaxInt32 {
+			p.bigConsts = true
+		}
+		return goExpr{text: strings.TrimRight(tok.Src, "uUlL"), constant: true}, nil
+	case cc.FLOATCONST:
+		v, err := parseFloatConst(tok.Src)
+		if err != nil {
+			return goExpr{}, err
+		}
+		p.floats = true
+		str, _ := evalValue{Type: evalDouble, Flt: v.Flt}.GoString()
+		return goExpr{text: str, constant: true}, nil
+	case cc.CHARCONST, cc.LONGCHARCONST:
+		v, err := parseCharConst(tok.Src, p.e.char)
+		if err != nil {
+			return goExpr{}, err
+		}
+		str, _ := v.GoString()
+		return goExpr{text: str, constant: true}, nil
+	case cc.IDENTIFIER:
+		return p.identifier(tok.Src)
+	}
+	switch tok.Src {
+	case "(":
+		x, err := p.expr()
+		if err != nil {
+			return goExpr{}, err
+		}
+		if err := p.expect(")"); err != nil {
+			return goExpr{}, err
+		}
+		return x, nil
+	case "":
+		return goExpr{}, errors.New("unexpected end of expression")
+	}
+	return goExpr{}, fmt.Errorf("unexpected %q", tok.Src)
+}
+
+func (p *macroParser) identifier(name string) (goExpr, error) {
+	if i, ok := p.params[name]; ok {
+		x := goExpr{text: p.m.Params[i]}
+		if p.isGeneric() || p.m.ParamTypes[i].Go == p.typ {
+			return x, nil
+		}
+		return p.convert(p.typ, x), nil
+	}
+	if macro, ok := p.mt.e.macros[name]; ok && macro.IsFnLike {
+		if p.peek().Src != "(" {
+			return goExpr{}, fmt.Errorf("%s is used without arguments", name)
+		}
+		return p.call(name)
+	}
+	if p.mt.consts[name] {
+		goName := string(p.mt.t.TransformName(TargetConst, name))
+		return p.convert(p.typ, goExpr{text: goName}), nil
+	}
+	return goExpr{}, fmt.Errorf("%s is not available in Go", name)
+}
+
+func (p *macroParser) call(name string) (goExpr, error) {
+	callee, err := p.mt.translate(name)
+	if err != nil {
+		return goExpr{}, fmt.Errorf("calls %s: %v", name, err)
+	} else if callee.Shim && callee.Result.IsVoid() {
+		return goExpr{}, fmt.Errorf("calls %s that has no result", name)
+	}
+	p.pos++ // (
+	args := make([]string, 0, len(callee.Params))
+	for !p.accept(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return goExpr{}, err
+			}
+		}
+		x, err := p.binary(1)
+		if err != nil {
+			return goExpr{}, err
+		}
+		if callee.IsGeneric() {
+			args = append(args, p.convert(p.typ, x).text)
+			continue
+		}
+		args = append(args, p.convert(callee.ParamTypes[len(args)].Go, x).text)
+	}
+	if len(args) != len(callee.Params) {
+		return goExpr{}, fmt.Errorf("calls %s with %d arguments instead of %d",
+			name, len(args), len(callee.Params))
+	}
+	goName := string(p.mt.t.TransformName(TargetMacro, name))
+	x := goExpr{text: goName + "(" + strings.Join(args, ", ") + ")"}
+	switch callee.Constraint {
+	case MacroConstraintInteger:
+		p.intOps = true
+	case MacroConstraintFloat:
+		p.floats = true
+	}
+	if callee.Result != nil && callee.Result.Go != p.typ {
+		return p.convert(p.typ, x), nil
+	}
+	return x, nil
+}
@@ -0,0 +1,110 @@
+package translator
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+
+	"github.com/bhojpur/build/pkg/cpp/diag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMacros(t *testing.T) {
+	const src = `
+#define SHIFT 8
+#define MAKE_VERSION(major, minor, patch) (((major) << 16) | ((minor) << SHIFT) | (patch))
+#define FLAG_BIT(n) (1 << (n))
+#define SQUARE(x) ((x) * (x))
+#define HALF(x) ((x) / 2.0)
+#define TO_U32(x) ((uint32_t)(x))
+#define TO_UINT(x) ((uint)(x))
+#define AREA(w, h) (SQUARE(w) * (h))
+#define MASK(x) ((x) & 0xff)
+#define BIGGER(a, b) ((a) > (b) ? (a) : (b))
+#define CLAMP(x) ((x) > 10 ? 10 : (x))
+#define IS_SET(x) ((x) != 0)
+#define LOG(msg, ...) printf(msg, __VA_ARGS__)
+`
+	tr, diags := learnSource(t, src, &Config{
+		Rules: Rules{
+			TargetConst: []RuleSpec{{Action: ActionAccept, From: "^[A-Z]"}},
+			TargetMacro: []RuleSpec{{Action: ActionAccept, From: "^[A-Z]"}},
+		},
+		TypeTips: TypeTips{
+			TipScopeMacro: []TipSpec{
+				{Target: "^MAKE_VERSION$", Tips: Tips{"int", "int", "int"}, Self: "unsigned"},
+				{Target: "^MASK$", Self: "uint"},
+				{Target: "^CLAMP$", Tips: Tips{"long"}, Self: "long"},
+			},
+		},
+	})
+	macros := make(map[string]*CMacro)
+	for _, m := range tr.Macros() {
+		macros[m.Name] = m
+	}
+	var tests = []struct {
+		name       string
+		constraint string
+		result     string
+		expr       string
+		shim       bool
+	}{
+		// typed by the type tips
+		{name: "MAKE_VERSION", result: "uint32", expr: "((uint32(major) << 16) | (uint32(minor) << uint32(SHIFT))) | uint32(patch)"},
+		{name: "MASK", result: "uint32", expr: "x & 0xff"},
+		// generic, the constraint follows the operators and the constants
+		{name: "FLAG_BIT", constraint: MacroConstraintInteger, expr: "1 << n"},
+		{name: "SQUARE", constraint: MacroConstraintNumber, expr: "x * x"},
+		{name: "HALF", constraint: MacroConstraintFloat, expr: "x / 2.0"},
+		{name: "AREA", constraint: MacroConstraintNumber, expr: "SQUARE(T(w)) * h"},
+		// a cast as the whole body gives the result type
+		{name: "TO_U32", constraint: MacroConstraintNumber, result: "uint32", expr: "uint32(x)"},
+		{name: "TO_UINT", constraint: MacroConstraintNumber, result: "uint32", expr: "uint32(x)"},
+		// not expressible in Go, wrapped in C
+		{name: "CLAMP", result: "int64", shim: true},
+	}
+	for _, test := range tests {
+		m, ok := macros[test.name]
+		if !assert.True(t, ok, test.name) {
+			continue
+		}
+		var result string
+		if m.Result != nil {
+			result = m.Result.Go
+		}
+		assert.Equal(t, test.constraint, m.Constraint, test.name)
+		assert.Equal(t, test.result, result, test.name)
+		assert.Equal(t, test.expr, m.Expression, test.name)
+		assert.Equal(t, test.shim, m.Shim, test.name)
+	}
+	assert.Equal(t, "C.uint", macros["MASK"].Result.CGo)
+	assert.Equal(t, []string{"C.long"}, []string{macros["CLAMP"].ParamTypes[0].CGo})
+
+	// the macros that can't be translated are reported
+	require.Len(t, diags, 3)
+	for i, name := range []string{"BIGGER", "IS_SET", "LOG"} {
+		assert.Equal(t, diag.CodeMacroFunc, diags[i].Code)
+		assert.Contains(t, diags[i].Message, name)
+	}
+	assert.Contains(t, diags[0].Message, "a type tip is required to wrap it in C")
+	assert.Contains(t, diags[2].Message, "variadic macros are not supported")
+}
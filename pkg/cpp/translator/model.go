@@ -0,0 +1,743 @@
+package translator
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/token"
+	"io"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"modernc.org/xc"
+)
+
+// ModelVersion is the version of the Model format, it's increased on the changes
+// that break the readers, so they should reject the versions they don't know.
+const ModelVersion = 1
+
+// Model is the serializable form of what the translator has learned from the headers,
+// that is the declarations with their C types, positions, Go names, tips and whether
+// the rules accept them.
+type Model struct {
+	Version  int                   `json:"version"`
+	Arch     string                `json:"arch,omitempty"`
+	Declares []*ModelDecl          `json:"declares"`
+	Typedefs []*ModelDecl          `json:"typedefs"`
+	Defines  []*ModelDecl          `json:"defines"`
+	Tags     map[string]*ModelDecl `json:"tags"`
+	Macros   []*ModelMacro         `json:"macros,omitempty"`
+}
+
+// ModelDecl is a CDecl in the Model, the Go name, the acceptance status and the tips
+// are only set for the top level declarations, not for the members and params.
+type ModelDecl struct {
+	Name       string         `json:"name,omitempty"`
+	GoName     string         `json:"goName,omitempty"`
+	Accepted   bool           `json:"accepted,omitempty"`
+	Spec       *ModelType     `json:"spec"`
+	Value      interface{}    `json:"value,omitempty"`
+	ValueType  string         `json:"valueType,omitempty"`
+	Expression string         `json:"expression,omitempty"`
+	IsStatic   bool           `json:"isStatic,omitempty"`
+	IsTypedef  bool           `json:"isTypedef,omitempty"`
+	IsDefine   bool           `json:"isDefine,omitempty"`
+	Position   *ModelPosition `json:"position,omitempty"`
+	Src        string         `json:"src,omitempty"`
+	Doc        *CDoc          `json:"doc,omitempty"`
+	BitField   *CBitField     `json:"bitField,omitempty"`
+	Tips       *ModelTips     `json:"tips,omitempty"`
+}
+
+// ModelType is a CType in the Model, Class tells which one of CTypeSpec, CStructSpec,
+// CFunctionSpec and CEnumSpec it is and so which of the fields are set.
+type ModelType struct {
+	Class    string       `json:"class"`
+	Kind     string       `json:"kind"`
+	GoType   string       `json:"goType,omitempty"`
+	Raw      string       `json:"raw,omitempty"`
+	Base     string       `json:"base,omitempty"`
+	Tag      string       `json:"tag,omitempty"`
+	Typedef  string       `json:"typedef,omitempty"`
+	Const    bool         `json:"const,omitempty"`
+	Signed   bool         `json:"signed,omitempty"`
+	Unsigned bool         `json:"unsigned,omitempty"`
+	Short    bool         `json:"short,omitempty"`
+	Long     bool         `json:"long,omitempty"`
+	Complex  bool         `json:"complex,omitempty"`
+	Opaque   bool         `json:"opaque,omitempty"`
+	IsUnion  bool         `json:"isUnion,omitempty"`
+	Pointers uint8        `json:"pointers,omitempty"`
+	InnerArr string       `json:"innerArr,omitempty"`
+	OuterArr string       `json:"outerArr,omitempty"`
+	Members  []*ModelDecl `json:"members,omitempty"`
+	EnumType *ModelType   `json:"enumType,omitempty"`
+	Return   *ModelType   `json:"return,omitempty"`
+	Params   []*ModelDecl `json:"params,omitempty"`
+}
+
+// Classes of ModelType.
+const (
+	ModelClassType     = "type"
+	ModelClassStruct   = "struct"
+	ModelClassFunction = "function"
+	ModelClassEnum     = "enum"
+)
+
+// ModelPosition is the position of a declaration in the headers.
+type ModelPosition struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column,omitempty"`
+}
+
+// ModelTips are the tips applied to a declaration, the tips of its params or members
+// are listed in order, the self tips apply to the declaration itself.
+type ModelTips struct {
+	Ptr      Tips `json:"ptr,omitempty"`
+	PtrSelf  Tip  `json:"ptrSelf,omitempty"`
+	Type     Tips `json:"type,omitempty"`
+	TypeSelf Tip  `json:"typeSelf,omitempty"`
+	Mem      Tips `json:"mem,omitempty"`
+	MemSelf  Tip  `json:"memSelf,omitempty"`
+}
+
+// ModelMacro is a CMacro in the Model.
+type ModelMacro struct {
+	Name       string         `json:"name"`
+	GoName     string         `json:"goName,omitempty"`
+	Params     []string       `json:"params,omitempty"`
+	ParamTypes []*CMacroType  `json:"paramTypes,omitempty"`
+	Result     *CMacroType    `json:"result,omitempty"`
+	Constraint string         `json:"constraint,omitempty"`
+	Expression string         `json:"expression,omitempty"`
+	Shim       bool           `json:"shim,omitempty"`
+	Position   *ModelPosition `json:"position,omitempty"`
+	Src        string         `json:"src,omitempty"`
+	Doc        *CDoc          `json:"doc,omitempty"`
+}
+
+var kindNames = map[CTypeKind]string{
+	TypeKind:         "type",
+	PlainTypeKind:    "plain",
+	StructKind:       "struct",
+	OpaqueStructKind: "opaque",
+	UnionKind:        "union",
+	FunctionKind:     "function",
+	EnumKind:         "enum",
+}
+
+// Model returns the serializable form of the declarations learned from the headers.
+func (t *Translator) Model() *Model {
+	model := &Model{
+		Version:  ModelVersion,
+		Arch:     t.arch,
+		Declares: make([]*ModelDecl, 0, len(t.declares)),
+		Typedefs: make([]*ModelDecl, 0, len(t.typedefs)),
+		Defines:  make([]*ModelDecl, 0, len(t.defines)),
+		Tags:     make(map[string]*ModelDecl, len(t.tagMap)),
+		Macros:   make([]*ModelMacro, 0, len(t.macros)),
+	}
+	for _, decl := range t.declares {
+		target := TargetPublic
+		if decl.Spec.Kind() == FunctionKind {
+			target = TargetFunction
+		}
+		model.Declares = append(model.Declares, t.modelDeclAt(decl, target))
+	}
+	for _, decl := range t.typedefs {
+		model.Typedefs = append(model.Typedefs, t.modelDeclAt(decl, TargetType))
+	}
+	for _, decl := range t.defines {
+		model.Defines = append(model.Defines, t.modelDeclAt(decl, TargetConst))
+	}
+	for tag, decl := range t.tagMap {
+		model.Tags[tag] = t.modelDeclAt(decl, TargetType)
+	}
+	for _, m := range t.macros {
+		model.Macros = append(model.Macros, &ModelMacro{
+			Name:       m.Name,
+			GoName:     string(t.TransformName(TargetMacro, m.Name)),
+			Params:     m.Params,
+			ParamTypes: m.ParamTypes,
+			Result:     m.Result,
+			Constraint: m.Constraint,
+			Expression: m.Expression,
+			Shim:       m.Shim,
+			Position:   modelPosition(m.Pos),
+			Src:        m.Src,
+			Doc:        m.Doc,
+		})
+	}
+	return model
+}
+
+// modelDeclAt converts a top level declaration, the name is transformed and checked
+// by the rules of the target.
+func (t *Translator) modelDeclAt(decl *CDecl, target RuleTarget) *ModelDecl {
+	d := t.modelDecl(decl)
+	name := decl.Name
+	if len(name) == 0 && decl.Spec != nil {
+		name = decl.Spec.GetBase()
+	}
+	if len(name) == 0 {
+		return d
+	}
+	d.GoName = string(t.TransformName(target, name, true))
+	d.Accepted = t.IsAcceptableName(target, name)
+	if target == TargetPublic && !d.Accepted {
+		d.Accepted = t.IsAcceptableName(TargetType, name)
+	}
+	if decl.Spec == nil {
+		return d
+	}
+
+	scope := TipScopeType
+	switch decl.Spec.Kind() {
+	case FunctionKind:
+		scope = TipScopeFunction
+	case StructKind, OpaqueStructKind, UnionKind:
+		scope = TipScopeStruct
+	}
+	ptr, typ, mem := t.TipRxsForSpec(scope, name, decl.Spec)
+	var n int
+	switch spec := decl.Spec.(type) {
+	case *CFunctionSpec:
+		n = len(spec.Params)
+	case *CStructSpec:
+		n = len(spec.Members)
+	}
+	tips := &ModelTips{
+		PtrSelf:  ptr.Self(),
+		TypeSelf: typ.Self(),
+		MemSelf:  mem.Self(),
+	}
+	for i := 0; i < n; i++ {
+		tips.Ptr = append(tips.Ptr, ptr.TipAt(i))
+		tips.Type = append(tips.Type, typ.TipAt(i))
+		tips.Mem = append(tips.Mem, mem.TipAt(i))
+	}
+	if !tips.isEmpty() {
+		d.Tips = tips
+	}
+	return d
+}
+
+func (m *ModelTips) isEmpty() bool {
+	if len(m.PtrSelf)+len(m.TypeSelf)+len(m.MemSelf) > 0 {
+		return false
+	}
+	for _, list := range []Tips{m.Ptr, m.Type, m.Mem} {
+		for _, tip := range list {
+			if len(tip) > 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (t *Translator) modelDecl(decl *CDecl) *ModelDecl {
+	d := &ModelDecl{
+		Name:       decl.Name,
+		Spec:       t.modelType(decl.Spec),
+		Expression: decl.Expression,
+		IsStatic:   decl.IsStatic,
+		IsTypedef:  decl.IsTypedef,
+		IsDefine:   decl.IsDefine,
+		Position:   modelPosition(decl.Pos),
+		Src:        decl.Src,
+		Doc:        decl.Doc,
+		BitField:   decl.BitField,
+	}
+	d.Value, d.ValueType = modelValue(decl.Value)
+	return d
+}
+
+func (t *Translator) modelDecls(decls []*CDecl) []*ModelDecl {
+	if len(decls) == 0 {
+		return nil
+	}
+	list := make([]*ModelDecl, 0, len(decls))
+	for _, decl := range decls {
+		list = append(list, t.modelDecl(decl))
+	}
+	return list
+}
+
+func (t *Translator) modelType(spec CType) *ModelType {
+	if spec == nil {
+		return nil
+	}
+	m := &ModelType{
+		Kind: kindNames[spec.Kind()],
+	}
+	switch spec := spec.(type) {
+	case *CTypeSpec:
+		m.Class = ModelClassType
+		m.Raw = spec.Raw
+		m.Base = spec.Base
+		m.Const = spec.Const
+		m.Signed = spec.Signed
+		m.Unsigned = spec.Unsigned
+		m.Short = spec.Short
+		m.Long = spec.Long
+		m.Complex = spec.Complex
+		m.Opaque = spec.Opaque
+		m.Pointers = spec.Pointers
+		m.InnerArr = string(spec.InnerArr)
+		m.OuterArr = string(spec.OuterArr)
+	case *CStructSpec:
+		m.Class = ModelClassStruct
+		m.Tag = spec.Tag
+		m.Typedef = spec.Typedef
+		m.IsUnion = spec.IsUnion
+		m.Members = t.modelDecls(spec.Members)
+		m.Pointers = spec.Pointers
+		m.InnerArr = string(spec.InnerArr)
+		m.OuterArr = string(spec.OuterArr)
+	case *CFunctionSpec:
+		m.Class = ModelClassFunction
+		m.Raw = spec.Raw
+		m.Typedef = spec.Typedef
+		m.Return = t.modelType(spec.Return)
+		m.Params = t.modelDecls(spec.Params)
+		m.Pointers = spec.Pointers
+		return m
+	case *CEnumSpec:
+		m.Class = ModelClassEnum
+		m.Tag = spec.Tag
+		m.Typedef = spec.Typedef
+		m.Members = t.modelDecls(spec.Members)
+		m.EnumType = t.modelType(&spec.Type)
+		m.Pointers = spec.Pointers
+		m.InnerArr = string(spec.InnerArr)
+		m.OuterArr = string(spec.OuterArr)
+	}
+	m.GoType = t.TranslateSpec(spec).String()
+	return m
+}
+
+// modelValue returns the value along with its Go type, so the numbers
+// can be told apart when they're read back.
+func modelValue(v Value) (interface{}, string) {
+	switch v := v.(type) {
+	case nil:
+		return nil, ""
+	case float32:
+		if math.IsInf(float64(v), 0) || math.IsNaN(float64(v)) {
+			return fmt.Sprint(v), "float32"
+		}
+		return v, "float32"
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return fmt.Sprint(v), "float64"
+		}
+		return v, "float64"
+	case bool, string, int8, int16, int32, int64, int, uint8, uint16, uint32, uint64, uint:
+		return v, fmt.Sprintf("%T", v)
+	default:
+		return fmt.Sprint(v), "string"
+	}
+}
+
+// modelPosition returns the position with an absolute file path,
+// so the model can be used from any dir.
+func modelPosition(p token.Pos) *ModelPosition {
+	if !p.IsValid() {
+		return nil
+	}
+	pos := xc.FileSet.Position(p)
+	if abs, err := filepath.Abs(pos.Filename); err == nil {
+		pos.Filename = abs
+	}
+	return &ModelPosition{
+		File:   pos.Filename,
+		Line:   pos.Line,
+		Column: pos.Column,
+	}
+}
+
+// ReadModel reads a model written as JSON, the numbers are kept as written
+// so the values don't lose precision.
+func ReadModel(r io.Reader) (*Model, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var model Model
+	if err := dec.Decode(&model); err != nil {
+		return nil, fmt.Errorf("translator: cannot read model: %v", err)
+	}
+	if model.Version != ModelVersion {
+		return nil, fmt.Errorf("translator: model version %d is not supported, expected %d", model.Version, ModelVersion)
+	}
+	return &model, nil
+}
+
+// NewFromModel creates a translator that has learned the declarations from a model
+// instead of the headers, so the headers don't have to be parsed again.
+func NewFromModel(cfg *Config, model *Model) (*Translator, error) {
+	if model == nil {
+		return nil, errors.New("translator: no model provided")
+	} else if model.Version != ModelVersion {
+		return nil, fmt.Errorf("translator: model version %d is not supported, expected %d", model.Version, ModelVersion)
+	}
+	t, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(t.arch) == 0 {
+		t.arch = model.Arch
+	}
+	r := &modelReader{
+		files: make(map[string]*modelFile),
+	}
+	r.scan(model)
+	r.addFiles()
+	if t.declares, err = r.decls(model.Declares); err != nil {
+		return nil, err
+	}
+	t.mapDeclares()
+	if t.typedefs, err = r.decls(model.Typedefs); err != nil {
+		return nil, err
+	}
+	if t.defines, err = r.decls(model.Defines); err != nil {
+		return nil, err
+	}
+	for tag, d := range model.Tags {
+		decl, err := r.decl(d)
+		if err != nil {
+			return nil, err
+		}
+		t.tagMap[tag] = decl
+	}
+	for _, m := range model.Macros {
+		t.macros = append(t.macros, &CMacro{
+			Name:       m.Name,
+			Params:     m.Params,
+			ParamTypes: m.ParamTypes,
+			Result:     m.Result,
+			Constraint: m.Constraint,
+			Expression: m.Expression,
+			Shim:       m.Shim,
+			Src:        m.Src,
+			Pos:        r.pos(m.Position),
+			Doc:        m.Doc,
+		})
+	}
+	for _, decl := range t.typedefs {
+		t.typedefsSet[decl.Name] = struct{}{}
+	}
+	for _, decl := range t.declares {
+		if decl.Value != nil || len(decl.Expression) > 0 {
+			t.valueMap[decl.Name] = decl.Value
+			t.exprMap[decl.Name] = decl.Expression
+		}
+	}
+	for _, list := range [][]*CDecl{t.declares, t.typedefs} {
+		for _, decl := range list {
+			if spec, ok := decl.Spec.(*CEnumSpec); ok {
+				for _, m := range spec.Members {
+					t.valueMap[m.Name] = m.Value
+					t.exprMap[m.Name] = m.Expression
+				}
+			}
+		}
+	}
+	t.resolveTypedefs(t.typedefs)
+	return t, nil
+}
+
+// modelFile is a source file known from the positions in a model, it's registered in the
+// file set with the lines of the same width, so the positions map back to the same lines and columns.
+type modelFile struct {
+	lines, width int
+	file         *token.File
+}
+
+type modelReader struct {
+	names []string
+	files map[string]*modelFile
+}
+
+func (r *modelReader) scan(model *Model) {
+	for _, list := range [][]*ModelDecl{model.Declares, model.Typedefs, model.Defines} {
+		for _, d := range list {
+			r.scanDecl(d)
+		}
+	}
+	tags := make([]string, 0, len(model.Tags))
+	for tag := range model.Tags {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	for _, tag := range tags {
+		r.scanDecl(model.Tags[tag])
+	}
+	for _, m := range model.Macros {
+		r.scanPosition(m.Position)
+	}
+}
+
+func (r *modelReader) scanDecl(d *ModelDecl) {
+	if d == nil {
+		return
+	}
+	r.scanPosition(d.Position)
+	r.scanType(d.Spec)
+}
+
+func (r *modelReader) scanType(m *ModelType) {
+	if m == nil {
+		return
+	}
+	for _, list := range [][]*ModelDecl{m.Members, m.Params} {
+		for _, d := range list {
+			r.scanDecl(d)
+		}
+	}
+	r.scanType(m.EnumType)
+	r.scanType(m.Return)
+}
+
+func (r *modelReader) scanPosition(p *ModelPosition) {
+	if p == nil {
+		return
+	}
+	f, ok := r.files[p.File]
+	if !ok {
+		f = &modelFile{}
+		r.files[p.File] = f
+		r.names = append(r.names, p.File)
+	}
+	if p.Line > f.lines {
+		f.lines = p.Line
+	}
+	if p.Column+1 > f.width {
+		f.width = p.Column + 1
+	}
+}
+
+func (r *modelReader) addFiles() {
+	for _, name := range r.names {
+		f := r.files[name]
+		if f.width < 2 {
+			f.width = 2
+		}
+		f.file = xc.FileSet.AddFile(name, -1, f.lines*f.width+1)
+		lines := make([]int, f.lines)
+		for i := range lines {
+			lines[i] = i * f.width
+		}
+		f.file.SetLines(lines)
+	}
+}
+
+func (r *modelReader) pos(p *ModelPosition) token.Pos {
+	if p == nil || p.Line < 1 {
+		return token.NoPos
+	}
+	f, ok := r.files[p.File]
+	if !ok || f.file == nil {
+		return token.NoPos
+	}
+	column := p.Column
+	if column < 1 {
+		column = 1
+	}
+	return f.file.Pos((p.Line-1)*f.width + column - 1)
+}
+
+func (r *modelReader) decls(list []*ModelDecl) ([]*CDecl, error) {
+	if len(list) == 0 {
+		return nil, nil
+	}
+	decls := make([]*CDecl, 0, len(list))
+	for _, d := range list {
+		decl, err := r.decl(d)
+		if err != nil {
+			return nil, err
+		}
+		decls = append(decls, decl)
+	}
+	return decls, nil
+}
+
+func (r *modelReader) decl(d *ModelDecl) (*CDecl, error) {
+	if d == nil {
+		return nil, errors.New("translator: model: empty declaration")
+	}
+	spec, err := r.spec(d.Spec)
+	if err != nil {
+		return nil, fmt.Errorf("translator: model: %s: %v", d.Name, err)
+	}
+	value, err := valueFromModel(d.Value, d.ValueType)
+	if err != nil {
+		return nil, fmt.Errorf("translator: model: %s: %v", d.Name, err)
+	}
+	return &CDecl{
+		Spec:       spec,
+		Name:       d.Name,
+		Value:      value,
+		Expression: d.Expression,
+		IsStatic:   d.IsStatic,
+		IsTypedef:  d.IsTypedef,
+		IsDefine:   d.IsDefine,
+		Pos:        r.pos(d.Position),
+		Src:        d.Src,
+		Doc:        d.Doc,
+		BitField:   d.BitField,
+	}, nil
+}
+
+func (r *modelReader) spec(m *ModelType) (CType, error) {
+	if m == nil {
+		return nil, nil
+	}
+	switch m.Class {
+	case ModelClassType:
+		return &CTypeSpec{
+			Raw:      m.Raw,
+			Base:     m.Base,
+			Const:    m.Const,
+			Signed:   m.Signed,
+			Unsigned: m.Unsigned,
+			Short:    m.Short,
+			Long:     m.Long,
+			Complex:  m.Complex,
+			Opaque:   m.Opaque,
+			Pointers: m.Pointers,
+			InnerArr: ArraySpec(m.InnerArr),
+			OuterArr: ArraySpec(m.OuterArr),
+		}, nil
+	case ModelClassStruct:
+		members, err := r.decls(m.Members)
+		if err != nil {
+			return nil, err
+		}
+		return &CStructSpec{
+			Tag:      m.Tag,
+			Typedef:  m.Typedef,
+			IsUnion:  m.IsUnion,
+			Members:  members,
+			Pointers: m.Pointers,
+			InnerArr: ArraySpec(m.InnerArr),
+			OuterArr: ArraySpec(m.OuterArr),
+		}, nil
+	case ModelClassFunction:
+		ret, err := r.spec(m.Return)
+		if err != nil {
+			return nil, err
+		}
+		params, err := r.decls(m.Params)
+		if err != nil {
+			return nil, err
+		}
+		return &CFunctionSpec{
+			Raw:      m.Raw,
+			Typedef:  m.Typedef,
+			Return:   ret,
+			Params:   params,
+			Pointers: m.Pointers,
+		}, nil
+	case ModelClassEnum:
+		members, err := r.decls(m.Members)
+		if err != nil {
+			return nil, err
+		}
+		spec := &CEnumSpec{
+			Tag:      m.Tag,
+			Typedef:  m.Typedef,
+			Members:  members,
+			Pointers: m.Pointers,
+			InnerArr: ArraySpec(m.InnerArr),
+			OuterArr: ArraySpec(m.OuterArr),
+		}
+		if m.EnumType != nil {
+			typ, err := r.spec(m.EnumType)
+			if err != nil {
+				return nil, err
+			}
+			if typ, ok := typ.(*CTypeSpec); ok {
+				spec.Type = *typ
+			}
+		}
+		return spec, nil
+	default:
+		return nil, fmt.Errorf("unknown type class %q", m.Class)
+	}
+}
+
+// valueFromModel converts the value read from a model back into its Go type.
+func valueFromModel(v interface{}, typ string) (Value, error) {
+	if v == nil || len(typ) == 0 {
+		return nil, nil
+	}
+	str := fmt.Sprint(v)
+	switch typ {
+	case "string":
+		return str, nil
+	case "bool":
+		return strconv.ParseBool(str)
+	case "int8", "int16", "int32", "int64", "int":
+		n, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case "int8":
+			return int8(n), nil
+		case "int16":
+			return int16(n), nil
+		case "int32":
+			return int32(n), nil
+		case "int":
+			return int(n), nil
+		}
+		return n, nil
+	case "uint8", "uint16", "uint32", "uint64", "uint":
+		n, err := strconv.ParseUint(str, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case "uint8":
+			return uint8(n), nil
+		case "uint16":
+			return uint16(n), nil
+		case "uint32":
+			return uint32(n), nil
+		case "uint":
+			return uint(n), nil
+		}
+		return n, nil
+	case "float32":
+		f, err := strconv.ParseFloat(str, 32)
+		return float32(f), err
+	case "float64":
+		return strconv.ParseFloat(str, 64)
+	default:
+		return nil, fmt.Errorf("unknown value type %s", typ)
+	}
+}
@@ -75,6 +75,9 @@ type CDecl struct {
 	IsDefine   bool
 	Pos        token.Pos
 	Src        string
+	Doc        *CDoc
+	// BitField is set for the struct members declared with a width.
+	BitField *CBitField
 }
 
 func (c CDecl) String() string {
@@ -0,0 +1,84 @@
+package translator
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import "go/token"
+
+// CMacro is a function-like macro that is translated into a Go function.
+// Macros that have type tips get typed functions, others get generic functions
+// over the Constraint type set. Macros that cannot be expressed in Go are
+// called through a C shim, these require type tips.
+type CMacro struct {
+	Name       string
+	Params     []string
+	ParamTypes []*CMacroType
+	Result     *CMacroType
+	Constraint string
+	Expression string
+	Shim       bool
+	Src        string
+	Pos        token.Pos
+	Doc        *CDoc
+}
+
+// IsGeneric reports whether the macro is translated into a generic Go function,
+// the result is of the type parameter as well unless Result is set.
+func (m *CMacro) IsGeneric() bool {
+	return len(m.Constraint) > 0
+}
+
+// ShimName returns the name of the static inline C function that wraps the macro.
+func (m *CMacro) ShimName() string {
+	return "cgo_macro_" + m.Name
+}
+
+// CMacroType is a type of a macro parameter or result declared with a type tip.
+type CMacroType struct {
+	// C is the type name as it's written in C.
+	C string `json:"c"`
+	// Go is the corresponding Go type, it's empty for void.
+	Go string `json:"go,omitempty"`
+	// CGo is the type name referenced from Go, such as C.uint.
+	CGo string `json:"cgo,omitempty"`
+}
+
+// IsVoid reports whether it's the void result type.
+func (t *CMacroType) IsVoid() bool {
+	return len(t.Go) == 0
+}
+
+// Generic type constraints of the functions translated from macros.
+const (
+	MacroConstraintInteger = "cgoInteger"
+	MacroConstraintFloat   = "cgoFloat"
+	MacroConstraintNumber  = "cgoNumber"
+)
+
+type macroList []*CMacro
+
+func (s macroList) Len() int      { return len(s) }
+func (s macroList) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s macroList) Less(i, j int) bool {
+	if s[i].Pos != s[j].Pos {
+		return s[i].Pos < s[j].Pos
+	}
+	return s[i].Name < s[j].Name
+}
@@ -25,6 +25,10 @@ type ConstRules map[ConstScope]ConstRule
 type PtrTips map[TipScope][]TipSpec
 type TypeTips map[TipScope][]TipSpec
 type MemTips []TipSpec
+type ErrorRules []ErrorRule
+type Deallocators []Deallocator
+type Handles []Handle
+type Methods []Method
 
 type RuleSpec struct {
 	From, To  string
@@ -58,9 +62,36 @@ const (
 	ActionDocument RuleAction = "doc"
 )
 
-var ruleActions = []RuleAction{
-	ActionAccept, ActionIgnore, ActionReplace, ActionDocument,
-}
+// The values accepted in the config, the settings may be left empty as well.
+var (
+	ValidRuleActions = []RuleAction{
+		ActionAccept, ActionIgnore, ActionReplace, ActionDocument,
+	}
+	ValidRuleTransforms = []RuleTransform{
+		TransformLower, TransformTitle, TransformExport, TransformUnexport, TransformUpper,
+	}
+	ValidRuleTargets = []RuleTarget{
+		TargetGlobal, TargetPostGlobal, TargetConst, TargetType,
+		TargetFunction, TargetMacro, TargetPublic, TargetPrivate,
+	}
+	ValidConstScopes = []ConstScope{
+		ConstEnum, ConstDecl, ConstDefines,
+	}
+	ValidConstRules = []ConstRule{
+		ConstCGOAlias, ConstExpand, ConstEval,
+	}
+	ValidTipScopes = []TipScope{
+		TipScopeAny, TipScopeStruct, TipScopeType, TipScopeFunction, TipScopeMacro,
+	}
+	ValidTips = []Tip{
+		TipPtrSRef, TipPtrRef, TipPtrArr, TipPtrInst, TipPtrUserData, TipPtrOut,
+		TipPtrInOut, TipTypeNamed, TipTypePlain, TipTypeString, TipMemRaw,
+	}
+	// ValidSelfTips are the tips that describe a call, they're valid as self tips only.
+	ValidSelfTips = []Tip{
+		TipPtrErrno, TipPtrOwned, TipPtrBorrowed,
+	}
+)
 
 type RuleTransform string
 
@@ -82,6 +113,7 @@ const (
 	TargetConst    RuleTarget = "const"
 	TargetType     RuleTarget = "type"
 	TargetFunction RuleTarget = "function"
+	TargetMacro    RuleTarget = "macro"
 	//
 	TargetPublic  RuleTarget = "public"
 	TargetPrivate RuleTarget = "private"
@@ -106,15 +138,21 @@ const (
 type Tip string
 
 const (
-	TipPtrSRef    Tip = "sref"
-	TipPtrRef     Tip = "ref"
-	TipPtrArr     Tip = "arr"
-	TipPtrInst    Tip = "inst"
-	TipMemRaw     Tip = "raw"
-	TipTypeNamed  Tip = "named"
-	TipTypePlain  Tip = "plain"
-	TipTypeString Tip = "string"
-	NoTip         Tip = ""
+	TipPtrSRef     Tip = "sref"
+	TipPtrRef      Tip = "ref"
+	TipPtrArr      Tip = "arr"
+	TipPtrInst     Tip = "inst"
+	TipPtrUserData Tip = "userdata"
+	TipPtrOut      Tip = "out"
+	TipPtrInOut    Tip = "inout"
+	TipPtrErrno    Tip = "errno"
+	TipPtrOwned    Tip = "owned"
+	TipPtrBorrowed Tip = "borrowed"
+	TipMemRaw      Tip = "raw"
+	TipTypeNamed   Tip = "named"
+	TipTypePlain   Tip = "plain"
+	TipTypeString  Tip = "string"
+	NoTip          Tip = ""
 )
 
 type TipKind string
@@ -128,7 +166,8 @@ const (
 
 func (t Tip) Kind() TipKind {
 	switch t {
-	case TipPtrArr, TipPtrRef, TipPtrSRef, TipPtrInst:
+	case TipPtrArr, TipPtrRef, TipPtrSRef, TipPtrInst, TipPtrUserData,
+		TipPtrOut, TipPtrInOut, TipPtrErrno, TipPtrOwned, TipPtrBorrowed:
 		return TipKindPtr
 	case TipTypePlain, TipTypeNamed, TipTypeString:
 		return TipKindType
@@ -141,7 +180,8 @@ func (t Tip) Kind() TipKind {
 
 func (t Tip) IsValid() bool {
 	switch t {
-	case TipPtrArr, TipPtrRef, TipPtrSRef, TipPtrInst:
+	case TipPtrArr, TipPtrRef, TipPtrSRef, TipPtrInst, TipPtrUserData,
+		TipPtrOut, TipPtrInOut, TipPtrErrno, TipPtrOwned, TipPtrBorrowed:
 		return true
 	case TipTypePlain, TipTypeNamed, TipTypeString:
 		return true
@@ -152,11 +192,69 @@ func (t Tip) IsValid() bool {
 	}
 }
 
+// IsSelfOnly reports whether the tip describes a call rather than a value.
+func (t Tip) IsSelfOnly() bool {
+	switch t {
+	case TipPtrErrno, TipPtrOwned, TipPtrBorrowed:
+		return true
+	default:
+		return false
+	}
+}
+
 type TipSpec struct {
 	Target  string
 	Tips    Tips
 	Self    Tip
 	Default Tip
+	// Failure is the condition on the return value that reports errno,
+	// e.g. "== -1", it's used along with the errno tip of a function.
+	Failure string
+	// Slices link the pointer params of a function to their length params.
+	Slices []SliceTip
+}
+
+// Deallocator names the C function that frees the memory returned by the matching
+// functions or the memory of the matching types, free is used by default.
+type Deallocator struct {
+	// Target is a regexp that matches the function or the type names.
+	Target string
+	// Free is the C function that takes the pointer to free.
+	Free string
+	// Finalizer makes the owned handles freed by the garbage collector
+	// if Close hasn't been called.
+	Finalizer bool
+}
+
+// Handle binds the pointers to an opaque type as a Go handle type, the handles are
+// created by the constructors, released by Close that calls the destructor and
+// the functions that take a handle as the first param become its methods.
+type Handle struct {
+	// Target is a regexp that matches the name or the tag of the opaque type.
+	Target string
+	// Constructor is a regexp that matches the functions returning a new handle, _create$ by default.
+	Constructor string
+	// Destructor is a regexp that matches the function releasing a handle, _destroy$ by default.
+	Destructor string
+}
+
+// Method binds the functions named prefix_<type>_<verb> as the methods of the Go type
+// their first param points to, so foo_window_set_title becomes (*FooWindow).SetTitle.
+type Method struct {
+	// Target is a regexp that matches the function names.
+	Target string
+	// Prefix is the part of the function names before the type name, e.g. foo_.
+	Prefix string
+}
+
+// SliceTip links a pointer parameter to the parameter that holds its length,
+// so both are bound as a single Go slice. The params are referred to by index or name.
+type SliceTip struct {
+	Ptr string
+	Len string
+	// Out marks a buffer that is filled by C, the Go function accepts
+	// its capacity instead and returns the written part.
+	Out bool
 }
 
 type TipScope string
@@ -166,10 +264,30 @@ const (
 	TipScopeStruct   TipScope = "struct"
 	TipScopeType     TipScope = "type"
 	TipScopeFunction TipScope = "function"
+	TipScopeMacro    TipScope = "macro"
 )
 
 type Tips []Tip
 
+// ErrorRule maps the status codes returned by the matching functions to Go errors.
+type ErrorRule struct {
+	// Target is a regexp that matches the function names.
+	Target string
+	// Success is the condition that holds for the successful return values,
+	// e.g. "== 0" or ">= 0", the value may be a C constant as well.
+	Success string
+	// Message is an optional C function that describes the code, e.g. strerror.
+	Message string
+	// Type is the name of the Go error type, Error is used if not set.
+	Type string
+}
+
+// IsBuiltinRule reports whether a rule can be loaded by the name.
+func IsBuiltinRule(name string) bool {
+	_, ok := builtinRules[name]
+	return ok
+}
+
 var builtinRules = map[string]RuleSpec{
 	"snakecase":  RuleSpec{Action: ActionReplace, From: "_([^_]+)", To: "$1", Transform: TransformTitle},
 	"doc.file":   RuleSpec{Action: ActionDocument, To: "$path:$line"},
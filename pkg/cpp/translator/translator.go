@@ -22,22 +22,32 @@ package translator
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
+	"github.com/bhojpur/build/pkg/cpp/diag"
 	"modernc.org/cc"
 	"modernc.org/xc"
 )
 
 type Translator struct {
+	arch               string
+	typeModel          *cc.Model
 	rules              Rules
 	prefixEnums        bool
 	compiledRxs        map[RuleAction]RxMap
 	compiledPtrTipRxs  PtrTipRxMap
 	compiledTypeTipRxs TypeTipRxMap
 	compiledMemTipRxs  MemTipRxList
+	compiledErrorRxs   []ErrorRuleRx
+	compiledFreeRxs    []DeallocatorRx
+	compiledHandleRxs  []HandleRx
+	compiledMethodRxs  []MethodRx
 	constRules         ConstRules
 	typemap            CTypeMap
 	builtinTypemap     CTypeMap
@@ -50,8 +60,10 @@ type Translator struct {
 	valueMap map[string]Value
 	exprMap  map[string]string
 	tagMap   map[string]*CDecl
+	declMap  map[string]*CDecl
 
 	defines  []*CDecl
+	macros   []*CMacro
 	typedefs []*CDecl
 	declares []*CDecl
 
@@ -62,6 +74,9 @@ type Translator struct {
 	ptrTipCache  *TipCache
 	typeTipCache *TipCache
 	memTipCache  *TipCache
+	docCache     *DocCache
+
+	diagnostics diag.Handler
 }
 
 type RxMap map[RuleTarget][]Rx
@@ -82,6 +97,8 @@ type TipSpecRx struct {
 	Default Tip
 	tips    Tips
 	self    Tip
+	failure []string
+	slices  []SliceTip
 }
 
 func (t TipSpecRx) TipAt(i int) Tip {
@@ -100,17 +117,59 @@ func (t TipSpecRx) Self() Tip {
 	return t.Default
 }
 
+// Failure returns the operator and the value of the failure condition,
+// ok is false if the condition has not been set.
+func (t TipSpecRx) Failure() (op, value string, ok bool) {
+	if len(t.failure) != 2 {
+		return "", "", false
+	}
+	return t.failure[0], t.failure[1], true
+}
+
+// Slices returns the pointer and length params that are bound as slices.
+func (t TipSpecRx) Slices() []SliceTip {
+	return t.slices
+}
+
+// CTypeAt returns the tip at i as a C type name, tips in the macro
+// scope declare types of parameters rather than the usual tips.
+func (t TipSpecRx) CTypeAt(i int) string {
+	if i < len(t.tips) && len(t.tips[i]) > 0 {
+		return string(t.tips[i])
+	}
+	return string(t.Default)
+}
+
+// CTypeSelf returns the self tip as a C type name, see CTypeAt.
+func (t TipSpecRx) CTypeSelf() string {
+	if len(t.self) > 0 {
+		return string(t.self)
+	}
+	return string(t.Default)
+}
+
 type Config struct {
-	Rules              Rules      `yaml:"Rules"`
-	ConstRules         ConstRules `yaml:"ConstRules"`
-	PtrTips            PtrTips    `yaml:"PtrTips"`
-	TypeTips           TypeTips   `yaml:"TypeTips"`
-	MemTips            MemTips    `yaml:"MemTips"`
-	Typemap            CTypeMap   `yaml:"Typemap"`
-	ConstCharIsString  *bool      `yaml:"ConstCharIsString"`
-	ConstUCharIsString *bool      `yaml:"ConstUCharIsString"`
+	Rules              Rules        `yaml:"Rules"`
+	ConstRules         ConstRules   `yaml:"ConstRules"`
+	PtrTips            PtrTips      `yaml:"PtrTips"`
+	TypeTips           TypeTips     `yaml:"TypeTips"`
+	MemTips            MemTips      `yaml:"MemTips"`
+	ErrorRules         ErrorRules   `yaml:"ErrorRules"`
+	Deallocators       Deallocators `yaml:"Deallocators"`
+	Handles            Handles      `yaml:"Handles"`
+	Methods            Methods      `yaml:"Methods"`
+	Typemap            CTypeMap     `yaml:"Typemap"`
+	ConstCharIsString  *bool        `yaml:"ConstCharIsString"`
+	ConstUCharIsString *bool        `yaml:"ConstUCharIsString"`
 
 	IgnoredFiles []string `yaml:"-"`
+	// Arch is the name of the target architecture.
+	Arch string `yaml:"-"`
+	// TypeModel defines the sizes and alignments of C types on the target,
+	// the 64-bit model is assumed when not set.
+	TypeModel *cc.Model `yaml:"-"`
+	// WcharType is the kind of wchar_t on the target, int is assumed when not set.
+	WcharType cc.Kind `yaml:"-"`
 }
 
 func New(cfg *Config) (*Translator, error) {
@@ -133,11 +192,13 @@ func New(cfg *Config) (*Translator, error) {
 	}
 
 	t := &Translator{
+		arch:               cfg.Arch,
+		typeModel:          cfg.TypeModel,
 		rules:              cfg.Rules,
 		constRules:         cfg.ConstRules,
 		typemap:            cfg.Typemap,
-		builtinTypemap:     getCTypeMap(constCharAsString, constUCharAsString),
-		builtinTypemap2:    getCTypeMap(true, false),
+		builtinTypemap:     getCTypeMap(constCharAsString, constUCharAsString, cfg.TypeModel, cfg.WcharType),
+		builtinTypemap2:    getCTypeMap(true, false, cfg.TypeModel, cfg.WcharType),
 		compiledRxs:        make(map[RuleAction]RxMap),
 		compiledPtrTipRxs:  make(PtrTipRxMap),
 		compiledTypeTipRxs: make(TypeTipRxMap),
@@ -151,11 +212,12 @@ func New(cfg *Config) (*Translator, error) {
 		ptrTipCache:        &TipCache{},
 		typeTipCache:       &TipCache{},
 		memTipCache:        &TipCache{},
+		docCache:           &DocCache{},
 	}
 	for _, p := range cfg.IgnoredFiles {
 		t.ignoredFiles[p] = struct{}{}
 	}
-	for _, action := range ruleActions {
+	for _, action := range ValidRuleActions {
 		if rxMap, err := getRuleActionRxs(t.rules, action); err != nil {
 			return nil, err
 		} else {
@@ -177,6 +239,26 @@ func New(cfg *Config) (*Translator, error) {
 	} else {
 		t.compiledMemTipRxs = rxList
 	}
+	if rxList, err := getErrorRuleRxs(cfg.ErrorRules); err != nil {
+		return nil, err
+	} else {
+		t.compiledErrorRxs = rxList
+	}
+	if rxList, err := getDeallocatorRxs(cfg.Deallocators); err != nil {
+		return nil, err
+	} else {
+		t.compiledFreeRxs = rxList
+	}
+	if rxList, err := getHandleRxs(cfg.Handles); err != nil {
+		return nil, err
+	} else {
+		t.compiledHandleRxs = rxList
+	}
+	if rxList, err := getMethodRxs(cfg.Methods); err != nil {
+		return nil, err
+	} else {
+		t.compiledMethodRxs = rxList
+	}
 	return t, nil
 }
 
@@ -236,6 +318,15 @@ func getPtrTipRxs(tips PtrTips) (PtrTipRxMap, error) {
 				Default: spec.Default,
 				tips:    spec.Tips,
 				self:    spec.Self,
+				slices:  spec.Slices,
+			}
+			if len(spec.Failure) > 0 {
+				m := conditionRx.FindStringSubmatch(spec.Failure)
+				if m == nil {
+					return nil, fmt.Errorf("translator: ptr tip %s: invalid failure condition %q",
+						spec.Target, spec.Failure)
+				}
+				specRx.failure = m[1:]
 			}
 			rxMap[scope] = append(rxMap[scope], specRx)
 			if scope == TipScopeStruct {
@@ -264,6 +355,14 @@ func getTypeTipRxs(tips TypeTips) (TypeTipRxMap, error) {
 				tips:    spec.Tips,
 				self:    spec.Self,
 			}
+			if len(spec.Failure) > 0 {
+				m := conditionRx.FindStringSubmatch(spec.Failure)
+				if m == nil {
+					return nil, fmt.Errorf("translator: ptr tip %s: invalid failure condition %q",
+						spec.Target, spec.Failure)
+				}
+				specRx.failure = m[1:]
+			}
 			rxMap[scope] = append(rxMap[scope], specRx)
 			if scope == TipScopeStruct {
 				rxMap[TipScopeType] = append(rxMap[TipScopeType], specRx)
@@ -294,6 +393,161 @@ func getMemTipRxs(tips MemTips) (MemTipRxList, error) {
 	return list, nil
 }
 
+// ErrorRuleRx is a compiled ErrorRule.
+type ErrorRuleRx struct {
+	Target *regexp.Regexp
+	// Op and Value form the success condition, e.g. >= and 0.
+	Op      string
+	Value   string
+	Message string
+	Type    string
+}
+
+// KeepsValue reports whether more than one value counts as success, so the
+// value returned is meaningful and is returned along with the error.
+func (r ErrorRuleRx) KeepsValue() bool {
+	return r.Op != "=="
+}
+
+var conditionRx = regexp.MustCompile(`^\s*(==|!=|>=|<=|>|<)\s*([A-Za-z_0-9-]+)\s*$`)
+
+// IsCondition reports whether cond compares a return value with a value, e.g. "== 0".
+func IsCondition(cond string) bool {
+	return conditionRx.MatchString(cond)
+}
+
+func getErrorRuleRxs(rules ErrorRules) ([]ErrorRuleRx, error) {
+	var list []ErrorRuleRx
+	// the rules of a type share its Error method
+	messages := make(map[string]string)
+	for _, rule := range rules {
+		if len(rule.Target) == 0 {
+			continue
+		}
+		rx, err := regexp.Compile(rule.Target)
+		if err != nil {
+			return nil, fmt.Errorf("translator: error rule: invalid regexp %s", rule.Target)
+		}
+		cond := rule.Success
+		if len(cond) == 0 {
+			cond = "== 0"
+		}
+		m := conditionRx.FindStringSubmatch(cond)
+		if m == nil {
+			return nil, fmt.Errorf("translator: error rule %s: invalid success condition %q", rule.Target, rule.Success)
+		}
+		typeName := rule.Type
+		if len(typeName) == 0 {
+			typeName = "Error"
+		}
+		if msg, ok := messages[typeName]; ok && msg != rule.Message {
+			return nil, fmt.Errorf("translator: error rule %s: type %s is described by %q already, not %q",
+				rule.Target, typeName, msg, rule.Message)
+		}
+		messages[typeName] = rule.Message
+		list = append(list, ErrorRuleRx{
+			Target:  rx,
+			Op:      m[1],
+			Value:   m[2],
+			Message: rule.Message,
+			Type:    typeName,
+		})
+	}
+	return list, nil
+}
+
+// DeallocatorRx is a compiled Deallocator.
+type DeallocatorRx struct {
+	Target    *regexp.Regexp
+	Free      string
+	Finalizer bool
+}
+
+func getDeallocatorRxs(specs Deallocators) ([]DeallocatorRx, error) {
+	var list []DeallocatorRx
+	for _, spec := range specs {
+		if len(spec.Target) == 0 {
+			continue
+		}
+		rx, err := regexp.Compile(spec.Target)
+		if err != nil {
+			return nil, fmt.Errorf("translator: deallocator: invalid regexp %s", spec.Target)
+		}
+		free := spec.Free
+		if len(free) == 0 {
+			free = "free"
+		}
+		list = append(list, DeallocatorRx{
+			Target:    rx,
+			Free:      free,
+			Finalizer: spec.Finalizer,
+		})
+	}
+	return list, nil
+}
+
+// HandleRx is a compiled Handle.
+type HandleRx struct {
+	Target      *regexp.Regexp
+	Constructor *regexp.Regexp
+	Destructor  *regexp.Regexp
+}
+
+func getHandleRxs(specs Handles) ([]HandleRx, error) {
+	var list []HandleRx
+	for _, spec := range specs {
+		if len(spec.Target) == 0 {
+			continue
+		}
+		constructor := spec.Constructor
+		if len(constructor) == 0 {
+			constructor = "_create$"
+		}
+		destructor := spec.Destructor
+		if len(destructor) == 0 {
+			destructor = "_destroy$"
+		}
+		var rxs [3]*regexp.Regexp
+		for i, expr := range []string{spec.Target, constructor, destructor} {
+			rx, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("translator: handle: invalid regexp %s", expr)
+			}
+			rxs[i] = rx
+		}
+		list = append(list, HandleRx{
+			Target:      rxs[0],
+			Constructor: rxs[1],
+			Destructor:  rxs[2],
+		})
+	}
+	return list, nil
+}
+
+// MethodRx is a compiled Method.
+type MethodRx struct {
+	Target *regexp.Regexp
+	Prefix string
+}
+
+func getMethodRxs(specs Methods) ([]MethodRx, error) {
+	var list []MethodRx
+	for _, spec := range specs {
+		if len(spec.Target) == 0 {
+			continue
+		}
+		rx, err := regexp.Compile(spec.Target)
+		if err != nil {
+			return nil, fmt.Errorf("translator: method: invalid regexp %s", spec.Target)
+		}
+		list = append(list, MethodRx{
+			Target: rx,
+			Prefix: spec.Prefix,
+		})
+	}
+	return list, nil
+}
+
 type declList []*CDecl
 
 func (s declList) Len() int      { return len(s) }
@@ -311,8 +565,10 @@ func (t *Translator) Learn(unit *cc.TranslationUnit) {
 	t.resolveTypedefs(t.typedefs)
 	sort.Sort(declList(t.declares))
 	sort.Sort(declList(t.typedefs))
+	t.mapDeclares()
 	t.collectDefines(t.declares, unit.Macros)
 	sort.Sort(declList(t.defines))
+	t.collectMacros(unit.Macros)
 }
 
 // This has been left intentionally.
@@ -339,6 +595,22 @@ func (t *Translator) Learn(unit *cc.TranslationUnit) {
 // 	fmt.Printf("\n)\n\n")
 // }
 
+// sortedMacros returns the macros in the order they have been defined in,
+// so they are processed the same way on every run.
+func sortedMacros(defines map[int]*cc.Macro) []*cc.Macro {
+	macros := make([]*cc.Macro, 0, len(defines))
+	for _, macro := range defines {
+		macros = append(macros, macro)
+	}
+	sort.Slice(macros, func(i, j int) bool {
+		if pi, pj := macros[i].DefTok.Pos(), macros[j].DefTok.Pos(); pi != pj {
+			return pi < pj
+		}
+		return string(macros[i].DefTok.S()) < string(macros[j].DefTok.S())
+	})
+	return macros
+}
+
 func (t *Translator) collectDefines(declares []*CDecl, defines map[int]*cc.Macro) {
 	seen := make(map[string]struct{}, len(defines)+len(declares))
 
@@ -361,7 +633,8 @@ func (t *Translator) collectDefines(declares []*CDecl, defines map[int]*cc.Macro
 
 	// double traverse because macros can depend on each other and the map
 	// brings a randomized order of them.
-	for _, macro := range defines {
+	macros := sortedMacros(defines)
+	for _, macro := range macros {
 		if t.IsTokenIgnored(macro.DefTok.Pos()) {
 			continue
 		} else if macro.IsFnLike {
@@ -374,7 +647,12 @@ func (t *Translator) collectDefines(declares []*CDecl, defines map[int]*cc.Macro
 		seen[name] = struct{}{}
 	}
 
-	for _, macro := range defines {
+	var evaluator *constEvaluator
+	if t.constRules[ConstDefines] == ConstEval {
+		evaluator = newConstEvaluator(t, defines)
+	}
+
+	for _, macro := range macros {
 		if t.IsTokenIgnored(macro.DefTok.Pos()) {
 			continue
 		}
@@ -382,6 +660,12 @@ func (t *Translator) collectDefines(declares []*CDecl, defines map[int]*cc.Macro
 		if _, ok := seen[name]; !ok {
 			continue
 		}
+		if evaluator != nil {
+			if err := t.evalDefine(evaluator, name, macro); err != nil {
+				t.warn(macro.DefTok.Pos(), diag.CodeMacroEval, "cannot evaluate the macro %s as a constant, skipping: %v", name, err)
+			}
+			continue
+		}
 		expand := false
 		if t.constRules[ConstDefines] == ConstExpand {
 			expand = true
@@ -402,6 +686,7 @@ func (t *Translator) collectDefines(declares []*CDecl, defines map[int]*cc.Macro
 					Name:     name,
 					Value:    Value(macro.Value),
 					Pos:      macro.DefTok.Pos(),
+					Doc:      t.leadingDoc(macro.DefTok.Pos()),
 				})
 				continue
 			}
@@ -485,6 +770,7 @@ func (t *Translator) collectDefines(declares []*CDecl, defines map[int]*cc.Macro
 					Name:     name,
 					Value:    Value(macro.Value),
 					Pos:      macro.DefTok.Pos(),
+					Doc:      t.leadingDoc(macro.DefTok.Pos()),
 				})
 			}
 			continue
@@ -495,8 +781,164 @@ func (t *Translator) collectDefines(declares []*CDecl, defines map[int]*cc.Macro
 			Expression: strings.Join(exprParts, " "),
 			Src:        strings.Join(srcParts, " "),
 			Pos:        macro.DefTok.Pos(),
+			Doc:        t.leadingDoc(macro.DefTok.Pos()),
+		})
+	}
+}
+
+// evalDefine evaluates the macro as a C constant expression and adds a define with
+// the typed Go constant, it returns the reason of failure if that's not possible.
+func (t *Translator) evalDefine(evaluator *constEvaluator, name string, macro *cc.Macro) error {
+	tokens := macro.ReplacementToks()
+	if _, ok := macro.Value.(bool); ok {
+		// ban bools
+		return nil
+	}
+	if len(tokens) == 0 {
+		// a flag macro like an include guard
+		return nil
+	}
+	if lit, ok, err := joinStringLiterals(tokens); err != nil {
+		return err
+	} else if ok {
+		t.defines = append(t.defines, &CDecl{
+			IsDefine: true,
+			Name:     name,
+			Value:    Value(lit),
+			Pos:      macro.DefTok.Pos(),
+			Doc:      t.leadingDoc(macro.DefTok.Pos()),
 		})
+		return nil
+	}
+	srcParts := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		srcParts = append(srcParts, cc.TokSrc(token))
 	}
+	v, err := evaluator.Eval(name)
+	var expr string
+	if err == nil {
+		expr, err = v.GoString()
+	}
+	if err != nil {
+		// not falling back to the value computed by the preprocessor,
+		// since it treats unknown identifiers as zeros.
+		return fmt.Errorf("%s: %v", strings.Join(srcParts, " "), err)
+	}
+	t.defines = append(t.defines, &CDecl{
+		IsDefine:   true,
+		Name:       name,
+		Expression: expr,
+		Src:        strings.Join(srcParts, " "),
+		Pos:        macro.DefTok.Pos(),
+		Doc:        t.leadingDoc(macro.DefTok.Pos()),
+	})
+	return nil
+}
+
+// joinStringLiterals joins the adjacent string literals of a replacement list
+// into one, like C does, and returns it as a Go string literal. It's not ok
+// if there are other tokens in the list, the wide literals are an error.
+func joinStringLiterals(tokens []xc.Token) (string, bool, error) {
+	var data []byte
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		src := cc.TokSrc(token)
+		if token.Rune == cc.IDENTIFIER && i+1 < len(tokens) && tokens[i+1].Rune == cc.STRINGLITERAL &&
+			int(tokens[i+1].Pos()) == int(token.Pos())+len(src) {
+			// the prefixes of the literals are lexed as identifiers
+			next := cc.TokSrc(tokens[i+1])
+			switch src {
+			case "u8":
+				i++
+				token, src = tokens[i], next
+			case "u", "U":
+				return "", false, fmt.Errorf("%s%s: wide string literals are not supported", src, next)
+			default:
+				return "", false, nil
+			}
+		}
+		switch token.Rune {
+		case cc.STRINGLITERAL:
+		case cc.LONGSTRINGLITERAL:
+			return "", false, fmt.Errorf("%s: wide string literals are not supported", src)
+		default:
+			return "", false, nil
+		}
+		if len(src) < 2 || src[0] != '"' || src[len(src)-1] != '"' {
+			return "", false, fmt.Errorf("invalid string literal %s", src)
+		}
+		b, err := decodeCString(src[1 : len(src)-1])
+		if err != nil {
+			return "", false, fmt.Errorf("%s: %v", src, err)
+		}
+		data = append(data, b...)
+	}
+	return strconv.Quote(string(data)), true, nil
+}
+
+// decodeCString returns the bytes of the body of a C string literal.
+func decodeCString(body string) ([]byte, error) {
+	var data []byte
+	for i := 0; i < len(body); i++ {
+		if body[i] != '\\' {
+			data = append(data, body[i])
+			continue
+		}
+		i++
+		if i == len(body) {
+			return nil, errors.New("unterminated escape sequence")
+		}
+		switch c := body[i]; {
+		case c >= '0' && c <= '7':
+			// up to three octal digits
+			var n uint64
+			j := i
+			for ; j < len(body) && j < i+3 && body[j] >= '0' && body[j] <= '7'; j++ {
+				n = n<<3 | uint64(body[j]-'0')
+			}
+			if n > 0xff {
+				return nil, fmt.Errorf("octal escape \\%s is out of range", body[i:j])
+			}
+			data = append(data, byte(n))
+			i = j - 1
+		case c == 'x':
+			// as many hex digits as there are
+			j := i + 1
+			for ; j < len(body) && isHexDigit(body[j]); j++ {
+			}
+			n, err := strconv.ParseUint(body[i+1:j], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid hex escape \\%s", body[i:j])
+			}
+			data = append(data, byte(n))
+			i = j - 1
+		case c == 'u' || c == 'U':
+			size := 4
+			if c == 'U' {
+				size = 8
+			}
+			if i+size >= len(body) {
+				return nil, fmt.Errorf("invalid universal character name \\%s", body[i:])
+			}
+			n, err := strconv.ParseUint(body[i+1:i+1+size], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(n)) {
+				return nil, fmt.Errorf("invalid universal character name \\%s", body[i:i+1+size])
+			}
+			data = append(data, string(rune(n))...)
+			i += size
+		default:
+			v, ok := charEscapes[c]
+			if !ok {
+				return nil, fmt.Errorf("unknown escape sequence \\%c", c)
+			}
+			data = append(data, byte(v))
+		}
+	}
+	return data, nil
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
 }
 
 func (t *Translator) resolveTypedefs(typedefs []*CDecl) {
@@ -640,6 +1082,57 @@ func (t *Translator) PtrTipRx(scope TipScope, name string) (TipSpecRx, bool) {
 	return TipSpecRx{}, false
 }
 
+// ErrorRule returns the first error rule that matches the function name.
+func (t *Translator) ErrorRule(name string) (ErrorRuleRx, bool) {
+	for _, rule := range t.compiledErrorRxs {
+		if rule.Target.MatchString(name) {
+			return rule, true
+		}
+	}
+	return ErrorRuleRx{}, false
+}
+
+// Deallocator returns the deallocator for the first of the names that matches a rule,
+// so a function name may be given before the names of its return type.
+func (t *Translator) Deallocator(names ...string) DeallocatorRx {
+	for _, name := range names {
+		if len(name) == 0 {
+			continue
+		}
+		for _, rx := range t.compiledFreeRxs {
+			if rx.Target.MatchString(name) {
+				return rx
+			}
+		}
+	}
+	return DeallocatorRx{Free: "free"}
+}
+
+// HandleRx returns the first handle rule that matches one of the type names.
+func (t *Translator) HandleRx(names ...string) (HandleRx, bool) {
+	for _, name := range names {
+		if len(name) == 0 {
+			continue
+		}
+		for _, rx := range t.compiledHandleRxs {
+			if rx.Target.MatchString(name) {
+				return rx, true
+			}
+		}
+	}
+	return HandleRx{}, false
+}
+
+// MethodRx returns the first method rule that matches the function name.
+func (t *Translator) MethodRx(name string) (MethodRx, bool) {
+	for _, rx := range t.compiledMethodRxs {
+		if rx.Target.MatchString(name) {
+			return rx, true
+		}
+	}
+	return MethodRx{}, false
+}
+
 func (t *Translator) TypeTipRx(scope TipScope, name string) (TipSpecRx, bool) {
 	if rx, ok := t.typeTipCache.Get(scope, name); ok {
 		return rx, true
@@ -1038,6 +1531,20 @@ func (t *Translator) TagMap() map[string]*CDecl {
 	return t.tagMap
 }
 
+// DeclareMap returns the declarations by name, the first one of a name is kept.
+func (t *Translator) DeclareMap() map[string]*CDecl {
+	return t.declMap
+}
+
+func (t *Translator) mapDeclares() {
+	t.declMap = make(map[string]*CDecl, len(t.declares))
+	for _, decl := range t.declares {
+		if _, ok := t.declMap[decl.Name]; !ok {
+			t.declMap[decl.Name] = decl
+		}
+	}
+}
+
 func (t *Translator) ExpressionMap() map[string]string {
 	return t.exprMap
 }
@@ -1050,6 +1557,31 @@ func (t *Translator) Defines() []*CDecl {
 	return t.defines
 }
 
+// Arch returns the name of the target architecture.
+func (t *Translator) Arch() string {
+	return t.arch
+}
+
+// TypeModel returns the model of the target, it's nil when the default one is used.
+func (t *Translator) TypeModel() *cc.Model {
+	return t.typeModel
+}
+
+// LongSize returns the size of long in bytes on the target.
+func (t *Translator) LongSize() int {
+	return modelSize(t.typeModel, cc.Long, 8)
+}
+
+// PointerSize returns the size of pointers in bytes on the target.
+func (t *Translator) PointerSize() int {
+	return modelSize(t.typeModel, cc.Ptr, 8)
+}
+
+// Macros returns the function-like macros translated into Go functions.
+func (t *Translator) Macros() []*CMacro {
+	return t.macros
+}
+
 func (t *Translator) Declares() []*CDecl {
 	return t.declares
 }
@@ -20,6 +20,8 @@ package translator
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
+import "modernc.org/cc"
+
 type CTypeMap map[CTypeSpec]GoTypeSpec
 type GoTypeMap map[string]GoTypeSpec
 
@@ -50,12 +52,33 @@ var (
 	InterfaceSliceSpec = GoTypeSpec{Base: "[]interface{}"}
 )
 
-func getCTypeMap(constCharIsString, constUCharIsString bool) CTypeMap {
-	config := make(CTypeMap, len(builtinCTypeMap)+2)
+func getCTypeMap(constCharIsString, constUCharIsString bool, model *cc.Model, wchar cc.Kind) CTypeMap {
+	config := make(CTypeMap, len(builtinCTypeMap)+len(evalPtrTypes)+3)
 	for k, v := range builtinCTypeMap {
 		config[k] = v
 	}
 
+	// size_t and the like have the size of a pointer
+	ptrSize := modelSize(model, cc.Ptr, 8)
+	for name, unsigned := range evalPtrTypes {
+		config[CTypeSpec{Base: name}] = intSpec(ptrSize, unsigned)
+	}
+	if wchar == cc.Undefined {
+		wchar = cc.Int
+	}
+	config[CTypeSpec{Base: "wchar_t"}] = intSpec(modelSize(model, wchar, 4), unsignedKinds[wchar])
+
+	if modelSize(model, cc.Long, 8) == 8 {
+		// long is 64-bit on LP64 targets
+		for _, spec := range longCTypes {
+			if spec.Unsigned {
+				config[spec] = Uint64Spec
+				continue
+			}
+			config[spec] = Int64Spec
+		}
+	}
+
 	if constCharIsString {
 		// const char* -> string
 		config[CTypeSpec{Base: "char", Const: true, Pointers: 1}] = StringSpec
@@ -69,6 +92,41 @@ func getCTypeMap(constCharIsString, constUCharIsString bool) CTypeMap {
 	return config
 }
 
+// longCTypes are the spellings of long, their size depends on the target.
+var longCTypes = []CTypeSpec{
+	{Base: "long"},
+	{Base: "long", Unsigned: true},
+	{Base: "long", Signed: true},
+	{Base: "int", Long: true},
+	{Base: "int", Long: true, Unsigned: true},
+	{Base: "int", Long: true, Signed: true},
+}
+
+// unsignedKinds are the unsigned integer kinds of the model.
+var unsignedKinds = map[cc.Kind]bool{
+	cc.UChar:     true,
+	cc.UShort:    true,
+	cc.UInt:      true,
+	cc.ULong:     true,
+	cc.ULongLong: true,
+}
+
+// intSpec returns the Go integer of the size in bytes.
+func intSpec(size int, unsigned bool) GoTypeSpec {
+	return GoTypeSpec{Base: "int", Bits: uint16(size * 8), Unsigned: unsigned}
+}
+
+// modelSize returns the size of the kind in the model, or def if there is no model.
+func modelSize(model *cc.Model, kind cc.Kind, def int) int {
+	if model == nil {
+		return def
+	}
+	if item, ok := model.Items[kind]; ok {
+		return item.Size
+	}
+	return def
+}
+
 // https://en.wikipedia.org/wiki/C_data_types
 var builtinCTypeMap = CTypeMap{
 	// char -> byte
@@ -81,11 +139,11 @@ var builtinCTypeMap = CTypeMap{
 	CTypeSpec{Base: "short"}: Int16Spec,
 	// unsigned short -> uint16
 	CTypeSpec{Base: "short", Unsigned: true}: Uint16Spec,
-	// long -> int
+	// long -> int32 (int64 on LP64)
 	CTypeSpec{Base: "long"}: Int32Spec,
-	// unsigned long -> uint
+	// unsigned long -> uint32 (uint64 on LP64)
 	CTypeSpec{Base: "long", Unsigned: true}: Uint32Spec,
-	// signed long -> int
+	// signed long -> int32 (int64 on LP64)
 	CTypeSpec{Base: "long", Signed: true}: Int32Spec,
 	// long long -> int64
 	CTypeSpec{Base: "long", Long: true}: Int64Spec,
@@ -105,11 +163,11 @@ var builtinCTypeMap = CTypeMap{
 	CTypeSpec{Base: "int", Short: true, Unsigned: true}: Uint16Spec,
 	// signed short int -> uint16
 	CTypeSpec{Base: "int", Short: true, Signed: true}: Int16Spec,
-	// long int -> int
+	// long int -> int32 (int64 on LP64)
 	CTypeSpec{Base: "int", Long: true}: Int32Spec,
-	// unsigned long int -> uint
+	// unsigned long int -> uint32 (uint64 on LP64)
 	CTypeSpec{Base: "int", Long: true, Unsigned: true}: Uint32Spec,
-	// signed long int -> uint
+	// signed long int -> int32 (int64 on LP64)
 	CTypeSpec{Base: "int", Long: true, Signed: true}: Int32Spec,
 	// float -> float32
 	CTypeSpec{Base: "float"}: Float32Spec,
@@ -0,0 +1,60 @@
+package translator
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bhojpur/build/pkg/cpp/parser"
+)
+
+func TestTargetTypemap(t *testing.T) {
+	var tests = []struct {
+		arch  string
+		sizeT string
+		wchar string
+	}{
+		{"amd64", "uint64", "int32"},
+		{"386", "uint32", "int32"},
+		{"x86_64-windows", "uint64", "uint16"},
+		{"arm", "uint32", "uint32"},
+	}
+	for _, test := range tests {
+		parserCfg := &parser.Config{Arch: test.arch}
+		model, err := parserCfg.TypeModel()
+		require.NoError(t, err)
+		wchar, err := parserCfg.WcharType()
+		require.NoError(t, err)
+		tr, err := New(&Config{Arch: test.arch, TypeModel: model, WcharType: wchar})
+		require.NoError(t, err)
+		assert.Equal(t, test.sizeT, tr.TranslateSpec(&CTypeSpec{Base: "size_t"}).String(), test.arch)
+		assert.Equal(t, test.wchar, tr.TranslateSpec(&CTypeSpec{Base: "wchar_t"}).String(), test.arch)
+	}
+
+	// the 64-bit model is assumed without a target
+	tr, err := New(&Config{})
+	require.NoError(t, err)
+	assert.Equal(t, "int64", tr.TranslateSpec(&CTypeSpec{Base: "ptrdiff_t"}).String())
+	assert.Equal(t, "int32", tr.TranslateSpec(&CTypeSpec{Base: "wchar_t"}).String())
+}
@@ -0,0 +1,441 @@
+package build
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/bhojpur/build/pkg"
+	"github.com/bhojpur/build/pkg/cpp/diag"
+	"github.com/bhojpur/build/pkg/cpp/generator"
+	"github.com/bhojpur/build/pkg/cpp/parser"
+	"github.com/bhojpur/build/pkg/cpp/translator"
+	"golang.org/x/tools/imports"
+)
+
+type Buf int
+
+const (
+	BufDoc Buf = iota
+	BufConst
+	BufTypes
+	BufUnions
+	BufHelpers
+	BufMain
+	BufLayoutTests
+	BufLeakCheck
+	BufNoLeakCheck
+)
+
+var goBufferNames = map[Buf]string{
+	BufDoc:         "doc",
+	BufConst:       "const",
+	BufTypes:       "types",
+	BufUnions:      "unions",
+	BufHelpers:     "cgo_helpers",
+	BufLayoutTests: "layout_test",
+	BufLeakCheck:   "handles_leakcheck",
+	BufNoLeakCheck: "handles_noleakcheck",
+}
+
+// process parses and translates the headers of a package and generates its files.
+type process struct {
+	opts         Options
+	cfg          Config
+	gen          *generator.Generator
+	tr           *translator.Translator
+	genSync      sync.WaitGroup
+	goBuffers    map[Buf]*bytes.Buffer
+	chHelpersBuf *bytes.Buffer
+	ccHelpersBuf *bytes.Buffer
+	outputPath   string
+	// multi-arch generation
+	goOS, goArch string
+	targets      []*process
+	archBuffers  map[string]*bytes.Buffer
+	stats        Stats
+	diags        *collector
+}
+
+// Config is the YAML config of a package.
+type Config struct {
+	Generator  *generator.Config  `yaml:"GENERATOR"`
+	Translator *translator.Config `yaml:"TRANSLATOR"`
+	Parser     *parser.Config     `yaml:"PARSER"`
+}
+
+func newProcessFor(opts Options, diags *collector) (*process, error) {
+	cfg, err := loadConfig(opts, diags)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.FromModel) > 0 {
+		if len(cfg.Parser.Arches) > 0 {
+			return nil, errorAt(opts.ConfigPath, diag.CodeConfig,
+				errors.New("a model holds a single target, Arches cannot be used with it"))
+		}
+		return newProcessFromModel(cfg, opts, diags)
+	}
+	if len(cfg.Parser.Arches) == 0 {
+		return newProcess(cfg, opts, diags)
+	}
+	if len(cfg.Parser.Arch) > 0 {
+		return nil, errorAt(opts.ConfigPath, diag.CodeConfig,
+			errors.New("Arch and Arches cannot be specified together"))
+	}
+	return newMultiArchProcess(cfg, opts, diags)
+}
+
+// LoadConfig reads the config of the package, the include paths are completed
+// with the ones of pkg-config packages and the dir of the config.
+// The warnings about pkg-config are dropped, Generate reports them.
+func LoadConfig(opts Options) (Config, error) {
+	return loadConfig(opts, new(collector))
+}
+
+func loadConfig(opts Options, diags *collector) (Config, error) {
+	cfgData, err := ioutil.ReadFile(opts.ConfigPath)
+	if err != nil {
+		return Config{}, errorAt(opts.ConfigPath, diag.CodeConfig, err)
+	}
+	// the validation makes sure there's a generator config
+	cfg, errs := decodeConfig(opts.ConfigPath, cfgData, opts)
+	if len(errs) > 0 {
+		return cfg, errs
+	}
+	paths := includePathsFromPkgConfig(cfg.Generator.PkgConfigOpts, func(format string, args ...interface{}) {
+		diags.warn(diag.Position{File: opts.ConfigPath}, diag.CodePkgConfig, format, args...)
+	})
+	if cfg.Parser == nil {
+		cfg.Parser = &parser.Config{}
+	}
+	cfg.Parser.CCDefs = opts.CCDefs
+	cfg.Parser.CCIncl = opts.CCIncl
+	cfg.Parser.Diagnostics = diags.report
+	cfg.Parser.IncludePaths = append(cfg.Parser.IncludePaths, paths...)
+	cfg.Parser.IncludePaths = append(cfg.Parser.IncludePaths, filepath.Dir(opts.ConfigPath))
+	return cfg, nil
+}
+
+func newProcess(cfg Config, opts Options, diags *collector) (*process, error) {
+	// parse the headers
+	unit, err := parser.ParseWith(cfg.Parser)
+	if err != nil {
+		return nil, diag.FromError(err, diag.CodeParse)
+	}
+
+	if cfg.Translator == nil {
+		cfg.Translator = &translator.Config{}
+	}
+	cfg.Translator.IgnoredFiles = cfg.Parser.IgnoredPaths
+	arch, err := cfg.Parser.TargetArch()
+	if err != nil {
+		return nil, errorAt(opts.ConfigPath, diag.CodeConfig, err)
+	}
+	cfg.Translator.Arch = string(arch)
+	if cfg.Translator.TypeModel, err = cfg.Parser.TypeModel(); err != nil {
+		return nil, errorAt(opts.ConfigPath, diag.CodeConfig, err)
+	}
+	if cfg.Translator.WcharType, err = cfg.Parser.WcharType(); err != nil {
+		return nil, errorAt(opts.ConfigPath, diag.CodeConfig, err)
+	}
+	// learn the model
+	tl, err := translator.New(cfg.Translator)
+	if err != nil {
+		return nil, errorAt(opts.ConfigPath, diag.CodeTranslate, err)
+	}
+	tl.SetDiagnostics(diags.report)
+	tl.Learn(unit)
+	return newProcessWith(cfg, tl, opts, diags)
+}
+
+// newProcessFromModel rehydrates the translator from a model written by -dump-model,
+// the target is the one the model has been learned for.
+func newProcessFromModel(cfg Config, opts Options, diags *collector) (*process, error) {
+	f, err := os.Open(opts.FromModel)
+	if err != nil {
+		return nil, errorAt(opts.FromModel, diag.CodeModel, err)
+	}
+	model, err := translator.ReadModel(f)
+	f.Close()
+	if err != nil {
+		return nil, errorAt(opts.FromModel, diag.CodeModel, err)
+	}
+	if cfg.Translator == nil {
+		cfg.Translator = &translator.Config{}
+	}
+	cfg.Translator.IgnoredFiles = cfg.Parser.IgnoredPaths
+	if len(cfg.Parser.Arch) == 0 {
+		cfg.Parser.Arch = model.Arch
+	}
+	arch, err := cfg.Parser.TargetArch()
+	if err != nil {
+		return nil, errorAt(opts.ConfigPath, diag.CodeConfig, err)
+	}
+	if len(model.Arch) > 0 && string(arch) != model.Arch {
+		return nil, errorAt(opts.FromModel, diag.CodeModel,
+			fmt.Errorf("the model has been learned for %s, not %s", model.Arch, arch))
+	}
+	cfg.Translator.Arch = string(arch)
+	if cfg.Translator.TypeModel, err = cfg.Parser.TypeModel(); err != nil {
+		return nil, errorAt(opts.ConfigPath, diag.CodeConfig, err)
+	}
+	if cfg.Translator.WcharType, err = cfg.Parser.WcharType(); err != nil {
+		return nil, errorAt(opts.ConfigPath, diag.CodeConfig, err)
+	}
+	tl, err := translator.NewFromModel(cfg.Translator, model)
+	if err != nil {
+		return nil, errorAt(opts.FromModel, diag.CodeModel, err)
+	}
+	tl.SetDiagnostics(diags.report)
+	return newProcessWith(cfg, tl, opts, diags)
+}
+
+func newProcessWith(cfg Config, tl *translator.Translator, opts Options, diags *collector) (*process, error) {
+	// begin generation
+	pkg := filepath.Base(cfg.Generator.PackageName)
+	gen, err := generator.New(pkg, cfg.Generator, tl)
+	if err != nil {
+		return nil, errorAt(opts.ConfigPath, diag.CodeGenerate, err)
+	}
+	gen.SetDiagnostics(diags.report)
+	maxMem := opts.MaxMem
+	if len(maxMem) == 0 {
+		maxMem = DefaultMaxMem
+	}
+	gen.SetMaxMemory(generator.NewMemSpec(maxMem))
+
+	if opts.NoStamp {
+		gen.DisableTimestamps()
+	}
+	c := &process{
+		opts:         opts,
+		diags:        diags,
+		cfg:          cfg,
+		gen:          gen,
+		tr:           tl,
+		goBuffers:    make(map[Buf]*bytes.Buffer),
+		chHelpersBuf: new(bytes.Buffer),
+		ccHelpersBuf: new(bytes.Buffer),
+		outputPath:   opts.OutputPath,
+	}
+	c.goBuffers[BufMain] = new(bytes.Buffer)
+	for opt := range goBufferNames {
+		c.goBuffers[opt] = new(bytes.Buffer)
+	}
+	goHelpersBuf := c.goBuffers[BufHelpers]
+	go func() {
+		c.genSync.Add(1)
+		c.gen.MonitorAndWriteHelpers(goHelpersBuf, c.chHelpersBuf, c.ccHelpersBuf)
+		c.genSync.Done()
+	}()
+	return c, nil
+}
+
+func (c *process) generateAll(noCGO bool) {
+	if len(c.targets) > 0 {
+		for _, t := range c.targets {
+			t.generate(noCGO)
+		}
+		return
+	}
+	c.generate(noCGO)
+}
+
+func (c *process) generate(noCGO bool) {
+	main := c.goBuffers[BufMain]
+	if wr, ok := c.goBuffers[BufDoc]; ok {
+		if !c.gen.WriteDoc(wr) {
+			c.goBuffers[BufDoc] = nil
+		}
+		c.gen.WritePackageHeader(main)
+	} else {
+		c.gen.WriteDoc(main)
+	}
+	if !noCGO {
+		c.gen.WriteIncludes(main)
+	}
+	if wr, ok := c.goBuffers[BufConst]; ok {
+		c.gen.WritePackageHeader(wr)
+		if !noCGO {
+			c.gen.WriteIncludes(wr)
+		}
+		if n := c.gen.WriteConst(wr); n == 0 {
+			c.goBuffers[BufConst] = nil
+		}
+	} else {
+		c.gen.WriteConst(main)
+	}
+	if wr, ok := c.goBuffers[BufTypes]; ok {
+		c.gen.WritePackageHeader(wr)
+		if !noCGO {
+			c.gen.WriteIncludes(wr)
+		}
+		if n := c.gen.WriteTypedefs(wr); n == 0 {
+			c.goBuffers[BufTypes] = nil
+		}
+	} else {
+		c.gen.WriteTypedefs(main)
+	}
+	if !noCGO {
+		if wr, ok := c.goBuffers[BufUnions]; ok {
+			c.gen.WritePackageHeader(wr)
+			c.gen.WriteIncludes(wr)
+			if n := c.gen.WriteUnions(wr); n == 0 {
+				c.goBuffers[BufUnions] = nil
+			}
+		} else {
+			c.gen.WriteUnions(main)
+		}
+		c.gen.WriteDeclares(main)
+		c.gen.WriteMacros(main)
+	}
+	if wr, ok := c.goBuffers[BufLayoutTests]; ok {
+		if noCGO || c.gen.WriteLayoutTests(wr) == 0 {
+			c.goBuffers[BufLayoutTests] = nil
+		}
+	}
+	if noCGO || c.gen.WriteHandleLeakCheck(c.goBuffers[BufLeakCheck], true) == 0 {
+		c.goBuffers[BufLeakCheck] = nil
+	}
+	if noCGO || c.gen.WriteHandleLeakCheck(c.goBuffers[BufNoLeakCheck], false) == 0 {
+		c.goBuffers[BufNoLeakCheck] = nil
+	}
+}
+
+// close stops the generators and waits for their helpers to be written.
+func (c *process) close() {
+	if len(c.targets) > 0 {
+		for _, t := range c.targets {
+			t.gen.Close()
+			t.genSync.Wait()
+		}
+		return
+	}
+	c.gen.Close()
+	c.genSync.Wait()
+}
+
+// render finishes the generation and returns the files of the package along with their dir.
+func (c *process) render(noCGO bool) (string, []outputFile, error) {
+	c.close()
+	if len(c.targets) > 0 {
+		if err := c.mergeTargets(noCGO); err != nil {
+			return "", nil, err
+		}
+	}
+	filePrefix := filepath.Join(c.outputPath, c.cfg.Generator.PackageName)
+	return filePrefix, c.files(filePrefix, noCGO), nil
+}
+
+// outputFile is a file of the package with its final contents.
+type outputFile struct {
+	name string
+	data []byte
+}
+
+// files renders the buffers into the files of the package in dir, the Go files are formatted.
+func (c *process) files(dir string, noCGO bool) []outputFile {
+	var files []outputFile
+	addGoFile := func(buf *bytes.Buffer, name string) {
+		if buf != nil && buf.Len() > 0 {
+			name += ".go"
+			data := c.formatBuffer(filepath.Join(dir, name), buf.Bytes())
+			files = append(files, outputFile{name: name, data: data})
+		}
+	}
+	if !noCGO {
+		addGoFile(c.goBuffers[BufMain], filepath.Base(c.cfg.Generator.PackageName))
+	}
+	for opt := BufDoc; opt <= BufNoLeakCheck; opt++ {
+		if name, ok := goBufferNames[opt]; ok {
+			addGoFile(c.goBuffers[opt], name)
+		}
+	}
+	for _, name := range sortedBufferNames(c.archBuffers) {
+		addGoFile(c.archBuffers[name], name)
+	}
+	if noCGO {
+		return files
+	}
+	if c.chHelpersBuf.Len() > 0 {
+		files = append(files, outputFile{name: "cgo_helpers.h", data: c.chHelpersBuf.Bytes()})
+	}
+	if c.ccHelpersBuf.Len() > 0 {
+		files = append(files, outputFile{name: "cgo_helpers.c", data: c.ccHelpersBuf.Bytes()})
+	}
+	return files
+}
+
+func (c *process) formatBuffer(name string, buf []byte) []byte {
+	fmtBuf, err := imports.Process(name, buf, nil)
+	if err != nil {
+		// the syntax errors point into the generated file
+		for _, d := range diag.FromError(err, diag.CodeGofmt) {
+			d.Severity = diag.Warning
+			if !d.Pos.IsValid() {
+				d.Pos.File = name
+			}
+			d.Message = "cannot gofmt: " + d.Message
+			c.diags.report(d)
+		}
+		return buf
+	}
+	return fmtBuf
+}
+
+func includePathsFromPkgConfig(opts []string, warnf func(format string, args ...interface{})) []string {
+	if len(opts) == 0 {
+		return nil
+	}
+	pc, err := pkg.NewConfig(nil)
+	if err != nil {
+		warnf("%v", err)
+		return nil
+	}
+	for _, opt := range opts {
+		if strings.HasPrefix(opt, "-") || strings.HasPrefix(opt, "--") {
+			continue
+		}
+		if pcPath, err := pc.Locate(opt); err == nil {
+			if err := pc.Load(pcPath, true); err != nil {
+				warnf("pkg-config: %v", err)
+			}
+		} else {
+			warnf("%s.pc referenced in pkg-config options but cannot be found: %s", opt, err.Error())
+		}
+	}
+	flags := pc.CFlags()
+	includePaths := make([]string, 0, len(flags))
+	for _, flag := range flags {
+		if idx := strings.Index(flag, "-I"); idx >= 0 {
+			includePaths = append(includePaths, strings.TrimSpace(flag[idx+2:]))
+		}
+	}
+	return includePaths
+}
@@ -0,0 +1,41 @@
+#ifndef DET_H
+#define DET_H
+
+#define DET_VERSION 2
+#define DET_MASK (1u << DET_VERSION)
+#define DET_NAME "det"
+#define DET_LIMIT (DET_VERSION * 100)
+#define DET_FIRST (DET_RED + 1)
+#define DET_SQUARE(x) ((x) * (x))
+#define DET_PACK(a, b) (((a) << 8) | (b))
+
+typedef enum det_color {
+    DET_RED,
+    DET_GREEN = 4,
+    DET_BLUE,
+} det_color_t;
+
+/** A sample with a few values. */
+typedef struct det_sample {
+    int id;
+    double *values;
+    unsigned int count;
+    unsigned int flags : 3;
+    unsigned int ready : 1;
+} det_sample_t;
+
+typedef void (*det_cb)(double *values, int n, const char *name, void *user_data);
+
+typedef struct det_ctx det_ctx_t;
+det_ctx_t *det_ctx_create(int n);
+void det_ctx_destroy(det_ctx_t *c);
+int det_ctx_size(det_ctx_t *c);
+
+void det_subscribe(det_cb cb, void *user_data);
+int det_fill(det_sample_t *s, double *values, unsigned int n);
+double *det_values(det_sample_t *s);
+int det_read(char *buf, unsigned int cap);
+const char *det_name(int id);
+int det_sum(int **rows, int n);
+
+#endif